@@ -9,7 +9,6 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
@@ -31,12 +30,63 @@ func main() {
 	txRepo := repo.NewTransactionRepo(db)
 	credRepo := repo.NewCreditRepo(db)
 	schedRepo := repo.NewScheduleRepo(db)
+	ledgerRepo := repo.NewLedgerRepo(db)
+	idemRepo := repo.NewIdempotencyRepo(db)
+	accessRepo := repo.NewAccessRepo(db)
+	sessionRepo := repo.NewSessionRepo(db)
+	recoveryRepo := repo.NewRecoveryCodeRepo(db)
+	userTokenRepo := repo.NewUserTokenRepo(db)
+	loginAttemptRepo := repo.NewLoginAttemptRepo(db)
+	auditRepo := repo.NewAuditRepo(db)
+	fxRateRepo := repo.NewFXRateRepo(db)
+	productRepo := repo.NewAccountProductRepo(db)
+	standingOrderRepo := repo.NewStandingOrderRepo(db)
+	phoneRepo := repo.NewPhoneVerificationRepo(db)
+	rateLimitRepo := repo.NewRateLimitRepo(db)
+
+	// ключи JWT
+	jwtKeys, err := services.LoadJWTKeySet(cfg)
+	if err != nil {
+		logrus.Fatalf("jwt keys: %v", err)
+	}
 
 	// Сервис
 	svc := services.NewBankService(
-		userRepo, accRepo, cardRepo, txRepo, credRepo, schedRepo, cfg,
+		userRepo, accRepo, cardRepo, txRepo, credRepo, schedRepo, ledgerRepo, idemRepo, accessRepo, sessionRepo, recoveryRepo, userTokenRepo, loginAttemptRepo, auditRepo, fxRateRepo, productRepo, standingOrderRepo, phoneRepo, rateLimitRepo, cfg, jwtKeys,
 	)
 
+	// курсы ЦБ за пропущенные дни — сразу при старте и дальше каждый час:
+	// /rates отдаёт только загруженные дни, так что новый день должен
+	// появиться вскоре после полуночи
+	go func() {
+		refreshRates(svc)
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			refreshRates(svc)
+		}
+	}()
+
+	// маски номеров и HMAC по номеру для карт, выпущенных до них
+	go func() {
+		if n, err := svc.BackfillCardData(); err != nil {
+			logrus.Errorf("дозаполнение карт: %v", err)
+		} else if n > 0 {
+			logrus.Infof("дозаполнение карт: обработано %d", n)
+		}
+	}()
+
+	// очередь аудита -> цепочка хешей, раз в секунду
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := svc.SealAudit(); err != nil {
+				logrus.Errorf("audit seal: %v", err)
+			}
+		}
+	}()
+
 	// Запускаем шедулер: проверяет каждые сутки все просроченные платежи
 	go func() {
 		ticker := time.NewTicker(24 * time.Hour)
@@ -46,29 +96,31 @@ func main() {
 			if err := svc.ProcessScheduledPayments(); err != nil {
 				logrus.Errorf("scheduler error: %v", err)
 			}
+			if err := svc.ExpireCards(); err != nil {
+				logrus.Errorf("card expiry: %v", err)
+			}
+			if err := svc.ProcessStandingOrders(); err != nil {
+				logrus.Errorf("standing orders: %v", err)
+			}
+			if err := svc.AccrueInterest(); err != nil {
+				logrus.Errorf("interest accrual: %v", err)
+			}
+			// о расхождении ReportLedger сам пишет в аудит и шлёт письмо
+			_ = svc.ReportLedger()
+			if n, err := svc.PurgeIdempotencyKeys(); err != nil {
+				logrus.Errorf("idempotency purge: %v", err)
+			} else if n > 0 {
+				logrus.Infof("idempotency purge: удалено %d ключей", n)
+			}
+			if _, err := svc.PurgeRateLimits(); err != nil {
+				logrus.Errorf("rate limit purge: %v", err)
+			}
 		}
 	}()
 
 	// HTTP
-	h := handlers.NewHandler(svc)
-	r := mux.NewRouter()
-
-	r.HandleFunc("/register", h.Register).Methods("POST")
-	r.HandleFunc("/login", h.Login).Methods("POST")
-
-	auth := r.PathPrefix("/").Subrouter()
-	auth.Use(h.AuthMiddleware)
-
-	auth.HandleFunc("/accounts", h.CreateAccount).Methods("POST")
-	auth.HandleFunc("/accounts", h.GetAccounts).Methods("GET")
-	auth.HandleFunc("/accounts/{id}/cards", h.GenerateCard).Methods("POST")
-	auth.HandleFunc("/accounts/{id}/cards", h.GetCards).Methods("GET")
-	auth.HandleFunc("/payments", h.PayWithCard).Methods("POST")
-	auth.HandleFunc("/transfers", h.Transfer).Methods("POST")
-	auth.HandleFunc("/deposits", h.Deposit).Methods("POST")
-	auth.HandleFunc("/credits", h.ApplyCredit).Methods("POST")
-	auth.HandleFunc("/credits", h.GetCredits).Methods("GET")
-	auth.HandleFunc("/schedule/{credit_id}", h.GetSchedule).Methods("GET")
+	h := handlers.NewHandler(svc, cfg)
+	r := handlers.NewRouter(h)
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	logrus.Infof("starting server on %s", addr)
@@ -76,3 +128,11 @@ func main() {
 		logrus.Fatalf("listen: %v", err)
 	}
 }
+
+func refreshRates(svc *services.BankService) {
+	if n, err := svc.RefreshRates(); err != nil {
+		logrus.Errorf("курсы ЦБ: %v", err)
+	} else if n > 0 {
+		logrus.Infof("курсы ЦБ: загружено дней %d", n)
+	}
+}
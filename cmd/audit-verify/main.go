@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"bankapp/internal/config"
+	"bankapp/internal/repo"
+	"bankapp/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// проверка цепочки хешей журнала аудита:
+//
+//	go run ./cmd/audit-verify
+//
+// код выхода 1, если найден хотя бы один разрыв
+func main() {
+	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+
+	cfg := config.Load()
+	db := repo.NewDB(cfg)
+	defer db.Close()
+
+	rep, err := services.VerifyAuditChain(repo.NewAuditRepo(db))
+	if err != nil {
+		logrus.Fatalf("audit verify: %v", err)
+	}
+	fmt.Printf("проверено записей: %d\n", rep.Checked)
+	if rep.Pending > 0 {
+		fmt.Printf("событий в очереди (ещё не в цепочке): %d\n", rep.Pending)
+	}
+	if rep.Unsealed > 0 {
+		fmt.Printf("записей до начала цепочки (без хеша): %d\n", rep.Unsealed)
+	}
+	for _, b := range rep.Breaks {
+		fmt.Printf("РАЗРЫВ id=%d: %s\n", b.ID, b.Reason)
+	}
+	if len(rep.Breaks) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("цепочка цела")
+}
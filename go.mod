@@ -3,7 +3,9 @@ module bankapp
 go 1.23.8
 
 require (
+	github.com/beevik/etree v1.5.1
 	github.com/go-mail/mail/v2 v2.3.0
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
@@ -16,6 +18,7 @@ require (
 )
 
 require (
-	github.com/beevik/etree v1.5.1 // indirect
+	golang.org/x/sys v0.32.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
+	gopkg.in/mail.v2 v2.3.1 // indirect
 )
@@ -2,8 +2,10 @@ package config
 
 import (
 	"log"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -27,14 +29,83 @@ type Config struct {
 	// HMAC
 	HMACSecret string
 
-	// JWT
-	JWTSecret string
+	// JWT: закрытый ключ RS256/EdDSA и открытые ключи прошлых ротаций;
+	// без ключа — HS256 на JWTSecret
+	JWTSigningKeyPath   string
+	JWTVerifyKeyPaths   []string
+	JWTSecret           string
+	JWTAudience         string // aud access-токенов, его сверяют и сервисы, проверяющие по JWKS
+	AccessTokenTTLMin   int
+	RefreshTokenTTLHour int
 
 	// SMTP
 	SMTPHost string
 	SMTPPort int
 	SMTPUser string
 	SMTPPass string
+
+	// куда слать письмо о расхождении в книге проводок
+	LedgerAlertEmail string
+
+	// защита входа от перебора
+	LoginMaxFailures      int // неудач подряд по имени до блокировки
+	LoginMaxFailuresIP    int // то же по IP клиента
+	LoginLockoutMin       int
+	LoginFailureWindowMin int // через сколько минут без неудач счётчик сбрасывается
+	LoginBackoffBaseSec   int // задержка после первой неудачи, дальше удваивается
+	LoginBackoffMaxSec    int
+	// заголовок с IP клиента от reverse proxy; пусто — берём адрес соединения.
+	// Заголовку верим только от адресов из TrustedProxies
+	ClientIPHeader string
+	TrustedProxies []netip.Prefix
+
+	// адрес приложения для ссылок в письмах
+	AppBaseURL string
+	// сроки жизни токенов из писем
+	PasswordResetTTLMin int
+	EmailVerifyTTLHours int
+	// запросов /password/forgot в час на один email и на один IP
+	PasswordForgotPerHour   int
+	PasswordForgotPerHourIP int
+
+	// срок хранения ключей Idempotency-Key
+	IdempotencyTTLHours int
+
+	// TTF-шрифт с кириллицей для PDF-выписок
+	StatementFontPath string
+
+	// ЦБ РФ: ключевая ставка (SOAP) и ежедневные курсы XML_daily;
+	// пустые адреса — адреса ЦБ по умолчанию из services
+	CBREndpoint   string
+	CBRDailyURL   string
+	CBRTimeoutSec int
+
+	// курсы для конвертации: "file" — JSON-файл «рублей за единицу»,
+	// "cbr" — сохранённые официальные курсы ЦБ; спред банка в б.п.
+	FXSource    string
+	FXRatesPath string
+	FXSpreadBps int
+	// за сколько дней назад шедулер догружает пропущенные курсы ЦБ
+	FXBackfillDays int
+	// запросов /rates и /rates/convert в минуту с одного IP
+	RatesPerMinIP int
+
+	// сколько дней повторять постоянное поручение при нехватке средств
+	StandingOrderRetryDays int
+
+	// SMS-шлюз для кодов подтверждения телефона; пусто — SMS в лог
+	SMSGatewayURL   string
+	PhoneCodeTTLMin int
+
+	// сколько раз в час пользователь может смотреть получателя перевода
+	TransferPreviewPerHour int
+
+	// после скольких неверных CVV подряд карта блокируется
+	CardCVVMaxAttempts int
+	// после скольких неверных PIN подряд карта блокируется
+	CardPINMaxAttempts int
+	// сколько раз в час клиент может посмотреть полные реквизиты карт
+	CardRevealPerHour int
 }
 
 func Load() *Config {
@@ -58,29 +129,115 @@ func Load() *Config {
 		return def
 	}
 
+	getList := func(key string) []string {
+		var out []string
+		for _, v := range strings.Split(os.Getenv(key), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+
+	// подсети через запятую; одиночный адрес — подсеть из одного адреса
+	getPrefixes := func(key string) []netip.Prefix {
+		var out []netip.Prefix
+		for _, v := range getList(key) {
+			if !strings.Contains(v, "/") {
+				addr, err := netip.ParseAddr(v)
+				if err != nil {
+					log.Fatalf("invalid %s: %v", key, err)
+				}
+				out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				log.Fatalf("invalid %s: %v", key, err)
+			}
+			out = append(out, p.Masked())
+		}
+		return out
+	}
+
 	cfg := &Config{
-		Port:              getInt("SERVER_PORT", 8080),
-		DBHost:            getStr("DB_HOST", ""),
-		DBPort:            getInt("DB_PORT", 5432),
-		DBUser:            getStr("DB_USER", ""),
-		DBPass:            getStr("DB_PASS", ""),
-		DBName:            getStr("DB_NAME", ""),
-		PGPPublicKeyPath:  getStr("PGP_PUBLIC_KEY_PATH", "keys/pub.asc"),
-		PGPPrivateKeyPath: getStr("PGP_PRIVATE_KEY_PATH", "keys/private.asc"),
-		PGPPrivatePass:    getStr("PGP_PASSPHRASE", ""),
-		HMACSecret:        getStr("HMAC_SECRET", ""),
-		JWTSecret:         getStr("JWT_SECRET", ""),
-		SMTPHost:          getStr("SMTP_HOST", ""),
-		SMTPPort:          getInt("SMTP_PORT", 587),
-		SMTPUser:          getStr("SMTP_USER", ""),
-		SMTPPass:          getStr("SMTP_PASS", ""),
+		Port:                    getInt("SERVER_PORT", 8080),
+		DBHost:                  getStr("DB_HOST", ""),
+		DBPort:                  getInt("DB_PORT", 5432),
+		DBUser:                  getStr("DB_USER", ""),
+		DBPass:                  getStr("DB_PASS", ""),
+		DBName:                  getStr("DB_NAME", ""),
+		PGPPublicKeyPath:        getStr("PGP_PUBLIC_KEY_PATH", "keys/pub.asc"),
+		PGPPrivateKeyPath:       getStr("PGP_PRIVATE_KEY_PATH", "keys/private.asc"),
+		PGPPrivatePass:          getStr("PGP_PASSPHRASE", ""),
+		HMACSecret:              getStr("HMAC_SECRET", ""),
+		JWTSigningKeyPath:       getStr("JWT_SIGNING_KEY_PATH", ""),
+		JWTVerifyKeyPaths:       getList("JWT_VERIFY_KEY_PATHS"),
+		JWTSecret:               getStr("JWT_SECRET", ""),
+		JWTAudience:             getStr("JWT_AUDIENCE", "bankapp"),
+		SMTPHost:                getStr("SMTP_HOST", ""),
+		SMTPPort:                getInt("SMTP_PORT", 587),
+		SMTPUser:                getStr("SMTP_USER", ""),
+		SMTPPass:                getStr("SMTP_PASS", ""),
+		LedgerAlertEmail:        getStr("LEDGER_ALERT_EMAIL", ""),
+		LoginMaxFailures:        getInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxFailuresIP:      getInt("LOGIN_MAX_FAILURES_IP", 20),
+		LoginLockoutMin:         getInt("LOGIN_LOCKOUT_MIN", 15),
+		LoginFailureWindowMin:   getInt("LOGIN_FAILURE_WINDOW_MIN", 15),
+		LoginBackoffBaseSec:     getInt("LOGIN_BACKOFF_BASE_SEC", 1),
+		LoginBackoffMaxSec:      getInt("LOGIN_BACKOFF_MAX_SEC", 60),
+		ClientIPHeader:          getStr("CLIENT_IP_HEADER", ""),
+		TrustedProxies:          getPrefixes("TRUSTED_PROXIES"),
+		AppBaseURL:              getStr("APP_BASE_URL", "http://localhost:8080"),
+		PasswordResetTTLMin:     getInt("PASSWORD_RESET_TTL_MIN", 30),
+		EmailVerifyTTLHours:     getInt("EMAIL_VERIFY_TTL_HOURS", 48),
+		PasswordForgotPerHour:   getInt("PASSWORD_FORGOT_PER_HOUR", 3),
+		PasswordForgotPerHourIP: getInt("PASSWORD_FORGOT_PER_HOUR_IP", 20),
+		IdempotencyTTLHours:     getInt("IDEMPOTENCY_TTL_HOURS", 24),
+		StatementFontPath:       getStr("STATEMENT_FONT_PATH", "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"),
+		CBREndpoint:             getStr("CBR_ENDPOINT", ""),
+		CBRDailyURL:             getStr("CBR_DAILY_URL", ""),
+		CBRTimeoutSec:           getInt("CBR_TIMEOUT_SEC", 5),
+		FXSource:                getStr("FX_SOURCE", "file"),
+		FXRatesPath:             getStr("FX_RATES_PATH", "fx_rates.json"),
+		FXSpreadBps:             getInt("FX_SPREAD_BPS", 100),
+		FXBackfillDays:          getInt("FX_BACKFILL_DAYS", 30),
+		RatesPerMinIP:           getInt("RATES_PER_MIN_IP", 60),
+		StandingOrderRetryDays:  getInt("STANDING_ORDER_RETRY_DAYS", 3),
+		SMSGatewayURL:           getStr("SMS_GATEWAY_URL", ""),
+		PhoneCodeTTLMin:         getInt("PHONE_CODE_TTL_MIN", 10),
+		TransferPreviewPerHour:  getInt("TRANSFER_PREVIEW_PER_HOUR", 30),
+		CardCVVMaxAttempts:      getInt("CARD_CVV_MAX_ATTEMPTS", 3),
+		CardRevealPerHour:       getInt("CARD_REVEAL_PER_HOUR", 5),
+		CardPINMaxAttempts:      getInt("CARD_PIN_MAX_ATTEMPTS", 3),
 	}
 
 	if cfg.DBHost == "" || cfg.DBUser == "" || cfg.DBPass == "" || cfg.DBName == "" {
 		log.Fatal("database configuration is not complete")
 	}
-	if cfg.HMACSecret == "" || cfg.JWTSecret == "" {
-		log.Fatal("HMAC_SECRET and JWT_SECRET must be set")
+	if cfg.HMACSecret == "" {
+		log.Fatal("HMAC_SECRET must be set")
+	}
+	if cfg.JWTSigningKeyPath == "" && cfg.JWTSecret == "" {
+		log.Fatal("JWT_SIGNING_KEY_PATH or JWT_SECRET must be set")
+	}
+	if cfg.ClientIPHeader != "" && len(cfg.TrustedProxies) == 0 {
+		log.Fatal("CLIENT_IP_HEADER requires TRUSTED_PROXIES")
+	}
+	if cfg.FXSource != "file" && cfg.FXSource != "cbr" {
+		log.Fatal("FX_SOURCE must be file or cbr")
+	}
+	if cfg.FXSpreadBps < 0 || cfg.FXSpreadBps >= 10000 {
+		log.Fatal("FX_SPREAD_BPS must be in [0, 10000)")
+	}
+	if cfg.StandingOrderRetryDays < 0 {
+		log.Fatal("STANDING_ORDER_RETRY_DAYS must be >= 0")
+	}
+	if cfg.CardCVVMaxAttempts <= 0 {
+		log.Fatal("CARD_CVV_MAX_ATTEMPTS must be > 0")
+	}
+	if cfg.CardPINMaxAttempts <= 0 {
+		log.Fatal("CARD_PIN_MAX_ATTEMPTS must be > 0")
 	}
 	return cfg
 }
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// пропускает только роли с правом perm; ставится после AuthMiddleware
+func (h *Handler) RequirePermission(perm string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := userIDFromCtx(r.Context())
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "missing token")
+			return
+		}
+		role, err := h.svc.Authorize(uid, perm)
+		if err != nil {
+			respondError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxRole, role)))
+	})
+}
+
+// сотрудник, выполняющий запрос, — для журнала аудита
+func (h *Handler) actor(r *http.Request) models.Actor {
+	uid, _ := userIDFromCtx(r.Context())
+	role, _ := r.Context().Value(ctxRole).(string)
+	return models.Actor{
+		UserID:    uid,
+		Role:      role,
+		IP:        h.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+func pathUUID(r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)[name])
+	return id, err == nil
+}
+
+// GET /admin/users?q=...&limit=...
+func (h *Handler) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	list, err := h.svc.AdminSearchUsers(h.actor(r), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// GET /admin/users/{id}
+func (h *Handler) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	view, err := h.svc.AdminGetUser(h.actor(r), id)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, view)
+}
+
+// PUT /admin/users/{id}/role
+func (h *Handler) AdminSetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var req models.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.AdminSetRole(h.actor(r), id, req.Role); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /admin/accounts/{id}
+func (h *Handler) AdminGetAccount(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	acc, err := h.svc.AdminGetAccount(h.actor(r), id)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, acc)
+}
+
+// GET /admin/accounts/{id}/transactions — те же фильтры, что у клиента
+func (h *Handler) AdminAccountTransactions(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	q := r.URL.Query()
+	f, err := parseTransactionFilter(q)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := h.svc.AdminAccountTransactions(h.actor(r), id, f, q.Get("cursor"))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, page)
+}
+
+// POST /admin/accounts/{id}/freeze и /unfreeze
+func (h *Handler) AdminSetAccountStatus(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathUUID(r, "id")
+		if !ok {
+			respondError(w, http.StatusBadRequest, "invalid account id")
+			return
+		}
+		var req models.StatusChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		acc, err := h.svc.AdminSetAccountStatus(h.actor(r), id, status, req.Reason)
+		if err != nil {
+			respondServiceError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, acc)
+	}
+}
+
+// POST /admin/cards/{id}/block, /unblock и /block-permanently
+func (h *Handler) AdminSetCardStatus(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathUUID(r, "id")
+		if !ok {
+			respondError(w, http.StatusBadRequest, "invalid card id")
+			return
+		}
+		var req models.StatusChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		card, err := h.svc.AdminSetCardStatus(h.actor(r), id, status, req.Reason)
+		if err != nil {
+			respondServiceError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, card)
+	}
+}
+
+// PUT /admin/account-products/{code}
+func (h *Handler) AdminSetProductRate(w http.ResponseWriter, r *http.Request) {
+	var req models.SetProductRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	p, err := h.svc.AdminSetProductRate(h.actor(r), mux.Vars(r)["code"], req)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+// POST /admin/scheduler/run
+func (h *Handler) AdminRunScheduler(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.AdminRunScheduler(h.actor(r)); err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /admin/login/unlock
+func (h *Handler) UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	var req models.UnlockLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.AdminUnlockLogin(h.actor(r), req); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /admin/audit?before_id=...&limit=...
+func (h *Handler) AdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	before, _ := strconv.ParseInt(q.Get("before_id"), 10, 64)
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	list, err := h.svc.AdminAuditLog(h.actor(r), before, limit)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
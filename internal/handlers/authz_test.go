@@ -0,0 +1,237 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bankapp/internal/handlers"
+	"bankapp/internal/models"
+	"bankapp/internal/testutil"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// маршруты без чужого ресурса в пути или теле: вход, свой профиль, списки
+// своих объектов, публичные курсы. Остальные обязаны быть в cases ниже
+var ownOnlyRoutes = map[string]bool{
+	"GET /.well-known/jwks.json": true,
+	"POST /register":             true,
+	"POST /login":                true,
+	"POST /login/mfa":            true,
+	"POST /token/refresh":        true,
+	"POST /password/forgot":      true,
+	"POST /password/reset":       true,
+	"GET /email/verify":          true,
+	"GET /rates":                 true,
+	"GET /rates/convert":         true,
+	"POST /logout":               true,
+	"POST /logout-all":           true,
+	"POST /email/verify/resend":  true,
+	"POST /2fa/enroll":           true,
+	"POST /2fa/confirm":          true,
+	"POST /2fa/disable":          true,
+	"POST /step-up":              true,
+	"POST /phone":                true,
+	"POST /phone/verify":         true,
+	"POST /accounts":             true,
+	"GET /accounts":              true,
+	"GET /account-products":      true,
+	"GET /standing-orders":       true,
+	"GET /credits":               true,
+}
+
+type crossUserCase struct {
+	route  string // метод и шаблон маршрута, как в NewRouter
+	path   string
+	body   string
+	header map[string]string
+	// допустимые коды; по умолчанию 403 или 404
+	want []int
+}
+
+// каждый маршрут с чужим счётом, картой, кредитом или поручением отвечает
+// другому клиенту 403/404 и ничего не меняет у владельца
+func TestCrossUserAccessDenied(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	router := handlers.NewRouter(handlers.NewHandler(env.Svc, env.Cfg))
+
+	owner := env.User(t)
+	ownerAcc := env.Account(t, owner, "1000")
+	ownerAcc2 := env.Account(t, owner, "0")
+	card, err := env.Svc.GenerateCard(testutil.Actor(owner), ownerAcc.ID, nil)
+	if err != nil {
+		t.Fatalf("карта: %v", err)
+	}
+	credit, _, err := env.Svc.ApplyCredit(testutil.Actor(owner), models.ApplyCreditRequest{
+		AccountID: ownerAcc.ID, Principal: decimal.NewFromInt(1000), TermMonths: 3,
+	}, nil)
+	if err != nil {
+		t.Fatalf("кредит: %v", err)
+	}
+	day := 1
+	order, err := env.Svc.CreateStandingOrder(owner.ID, models.StandingOrderRequest{
+		FromAccountID: ownerAcc.ID, ToAccountID: ownerAcc2.ID, Amount: decimal.NewFromInt(1),
+		Rule: models.RuleMonthly, DayOfMonth: &day,
+	}, nil)
+	if err != nil {
+		t.Fatalf("поручение: %v", err)
+	}
+	ownerStepUp, err := env.Svc.StepUp(testutil.Actor(owner), models.StepUpRequest{Password: testutil.Password})
+	if err != nil {
+		t.Fatalf("step-up владельца: %v", err)
+	}
+	details, err := env.Svc.RevealCardDetails(testutil.Actor(owner), card.ID, ownerStepUp.Token)
+	if err != nil {
+		t.Fatalf("реквизиты: %v", err)
+	}
+
+	mallory := env.User(t)
+	malloryAcc := env.Account(t, mallory, "100")
+	token := env.Token(t, mallory)
+	malloryStepUp, err := env.Svc.StepUp(testutil.Actor(mallory), models.StepUpRequest{Password: testutil.Password})
+	if err != nil {
+		t.Fatalf("step-up: %v", err)
+	}
+
+	acc, acc2, mAcc := ownerAcc.ID.String(), ownerAcc2.ID.String(), malloryAcc.ID.String()
+	cardID, creditID, orderID := card.ID.String(), credit.ID.String(), order.ID.String()
+	orderBody := `{"from_account_id":"` + acc + `","to_account_id":"` + mAcc + `","amount":"1","rule":"monthly","day_of_month":1}`
+	cases := []crossUserCase{
+		{route: "PUT /default-account", path: "/default-account", body: `{"account_id":"` + acc + `"}`},
+		{route: "POST /accounts/{id}/terminate", path: "/accounts/" + acc + "/terminate", body: `{"to_account_id":"` + mAcc + `"}`},
+		{route: "POST /accounts/{id}/close", path: "/accounts/" + acc + "/close", body: `{"to_account_id":"` + mAcc + `"}`},
+		{route: "POST /standing-orders", path: "/standing-orders", body: orderBody},
+		{route: "GET /standing-orders/{id}", path: "/standing-orders/" + orderID},
+		{route: "PUT /standing-orders/{id}", path: "/standing-orders/" + orderID, body: `{"from_account_id":"` + acc + `","to_account_id":"` + acc2 + `","amount":"5","rule":"monthly","day_of_month":2}`},
+		{route: "DELETE /standing-orders/{id}", path: "/standing-orders/" + orderID},
+		{route: "POST /accounts/{id}/cards", path: "/accounts/" + acc + "/cards"},
+		{route: "GET /accounts/{id}/cards", path: "/accounts/" + acc + "/cards"},
+		{route: "GET /accounts/{id}/transactions", path: "/accounts/" + acc + "/transactions"},
+		{route: "GET /accounts/{id}/statement", path: "/accounts/" + acc + "/statement"},
+		{route: "GET /accounts/{id}/access", path: "/accounts/" + acc + "/access"},
+		{route: "PUT /accounts/{id}/access/{user_id}", path: "/accounts/" + acc + "/access/" + mallory.ID.String(), body: `{"level":"operate"}`},
+		{route: "DELETE /accounts/{id}/access/{user_id}", path: "/accounts/" + acc + "/access/" + mallory.ID.String()},
+		{route: "GET /cards/{id}/details", path: "/cards/" + cardID + "/details", header: map[string]string{"X-Step-Up-Token": malloryStepUp.Token}},
+		{route: "GET /cards/{id}/controls", path: "/cards/" + cardID + "/controls"},
+		{route: "PUT /cards/{id}/controls", path: "/cards/" + cardID + "/controls", body: `{"daily_limit":"1000000"}`},
+		{route: "POST /cards/{id}/pin", path: "/cards/" + cardID + "/pin", body: `{"pin":"4829"}`},
+		{route: "PUT /cards/{id}/pin", path: "/cards/" + cardID + "/pin", body: `{"old_pin":"4829","new_pin":"7391"}`},
+		{route: "POST /cards/{id}/block", path: "/cards/" + cardID + "/block"},
+		{route: "POST /cards/{id}/unblock", path: "/cards/" + cardID + "/unblock"},
+		{route: "POST /cards/{id}/close", path: "/cards/" + cardID + "/close"},
+		{route: "POST /cards/{id}/reissue", path: "/cards/" + cardID + "/reissue"},
+		// номер и срок известны, CVV подбирается: отказ тот же, что при
+		// неверных реквизитах, и попытки владельца не тратятся
+		{route: "POST /payments", path: "/payments", body: `{"card_number":"` + details.Number + `","expiry":"` + details.Expiry + `","cvv":"000","amount":"1","merchant":"shop"}`, want: []int{http.StatusBadRequest}},
+		{route: "POST /transfers", path: "/transfers", body: `{"from_account_id":"` + acc + `","to_account_id":"` + mAcc + `","amount":"1"}`},
+		{route: "POST /transfers/preview", path: "/transfers/preview", body: `{"from_account_id":"` + acc + `","to_account_id":"` + mAcc + `","amount":"1"}`},
+		// получатель по имени ищется только после проверки счёта списания
+		{route: "POST /transfers", path: "/transfers", body: `{"from_account_id":"` + acc + `","to_username":"no-such-user","amount":"1"}`},
+		{route: "POST /deposits", path: "/deposits", body: `{"to_account_id":"` + acc + `","amount":"1"}`},
+		{route: "POST /credits", path: "/credits", body: `{"account_id":"` + acc + `","principal":"1000","term_months":3}`},
+		{route: "GET /schedule/{credit_id}", path: "/schedule/" + creditID},
+		// бэк-офис клиенту недоступен целиком
+		{route: "GET /admin/users", path: "/admin/users"},
+		{route: "GET /admin/users/{id}", path: "/admin/users/" + owner.ID.String()},
+		{route: "PUT /admin/users/{id}/role", path: "/admin/users/" + mallory.ID.String() + "/role", body: `{"role":"admin"}`},
+		{route: "GET /admin/accounts/{id}", path: "/admin/accounts/" + acc},
+		{route: "GET /admin/accounts/{id}/transactions", path: "/admin/accounts/" + acc + "/transactions"},
+		{route: "POST /admin/accounts/{id}/freeze", path: "/admin/accounts/" + acc + "/freeze", body: `{"reason":"x"}`},
+		{route: "POST /admin/accounts/{id}/unfreeze", path: "/admin/accounts/" + acc + "/unfreeze", body: `{"reason":"x"}`},
+		{route: "POST /admin/cards/{id}/block", path: "/admin/cards/" + cardID + "/block", body: `{"reason":"x"}`},
+		{route: "POST /admin/cards/{id}/unblock", path: "/admin/cards/" + cardID + "/unblock", body: `{"reason":"x"}`},
+		{route: "POST /admin/cards/{id}/block-permanently", path: "/admin/cards/" + cardID + "/block-permanently", body: `{"reason":"x"}`},
+		{route: "POST /admin/login/unlock", path: "/admin/login/unlock", body: `{"username":"` + owner.Username + `"}`},
+		{route: "PUT /admin/account-products/{code}", path: "/admin/account-products/savings", body: `{"annual_rate":"0.5"}`},
+		{route: "POST /admin/scheduler/run", path: "/admin/scheduler/run"},
+		{route: "GET /admin/audit", path: "/admin/audit"},
+	}
+
+	covered := map[string]bool{}
+	for _, c := range cases {
+		covered[c.route] = true
+		method := strings.SplitN(c.route, " ", 2)[0]
+		req := httptest.NewRequest(method, c.path, strings.NewReader(c.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if c.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		want := c.want
+		if want == nil {
+			want = []int{http.StatusForbidden, http.StatusNotFound}
+		}
+		ok := false
+		for _, code := range want {
+			ok = ok || rec.Code == code
+		}
+		if !ok {
+			t.Errorf("%s %s: код %d, ждали %v; ответ %s", method, c.path, rec.Code, want, rec.Body.String())
+		}
+	}
+
+	// новый маршрут должен попасть либо в cases, либо в ownOnlyRoutes
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, m := range methods {
+			name := m + " " + tpl
+			if !covered[name] && !ownOnlyRoutes[name] {
+				t.Errorf("маршрут %s не проверен на доступ чужого клиента", name)
+			}
+		}
+		return nil
+	})
+
+	// у владельца ничего не изменилось
+	var st struct {
+		Balance     decimal.Decimal `db:"balance"`
+		Status      string          `db:"status"`
+		CardStatus  string          `db:"card_status"`
+		CVVFailures int             `db:"cvv_failures"`
+		PINSet      bool            `db:"pin_set"`
+		OrderStatus string          `db:"order_status"`
+		Grants      int             `db:"grants"`
+	}
+	if err := env.DB.Get(&st, `
+        SELECT a.balance, a.status, c.status AS card_status, c.cvv_failures, c.pin_offset IS NOT NULL AS pin_set,
+               o.status AS order_status,
+               (SELECT COUNT(*) FROM account_access WHERE account_id = a.id) AS grants
+        FROM accounts a, cards c, standing_orders o
+        WHERE a.id=$1 AND c.id=$2 AND o.id=$3
+    `, ownerAcc.ID, card.ID, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !st.Balance.Equal(decimal.NewFromInt(2000)) {
+		t.Errorf("остаток владельца %s, ждали 2000", st.Balance)
+	}
+	if st.Status != models.AccountActive || st.CardStatus != models.CardActive || st.OrderStatus != models.StandingOrderActive {
+		t.Errorf("статусы изменились: счёт %s, карта %s, поручение %s", st.Status, st.CardStatus, st.OrderStatus)
+	}
+	if st.CVVFailures != 0 || st.PINSet || st.Grants != 0 {
+		t.Errorf("карта или доступ изменены: cvv_failures=%d pin_set=%v доступов=%d", st.CVVFailures, st.PINSet, st.Grants)
+	}
+
+	// а свой счёт тем же токеном доступен
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/accounts/"+mAcc+"/cards", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("свой счёт: код %d, ответ %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,83 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bankapp/internal/handlers"
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/shopspring/decimal"
+)
+
+// каждое ограничение карты даёт в ответе POST /payments свой code
+func TestPaymentDeclineCodes(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	router := handlers.NewRouter(handlers.NewHandler(env.Svc, env.Cfg))
+	u := env.User(t)
+	acc := env.Account(t, u, "10000")
+	card, err := env.Svc.GenerateCard(testutil.Actor(u), acc.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := env.Svc.StepUp(testutil.Actor(u), models.StepUpRequest{Password: testutil.Password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err := env.Svc.RevealCardDetails(testutil.Actor(u), card.ID, st.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := env.Token(t, u)
+
+	hundred := decimal.NewFromInt(100)
+	off := false
+	cases := []struct {
+		code     string
+		controls models.CardControlsRequest
+		extra    string // поля запроса оплаты сверх реквизитов и суммы 150
+	}{
+		{services.DeclinePerTxLimit, models.CardControlsRequest{PerTxLimit: &hundred}, ""},
+		{services.DeclineDailyLimit, models.CardControlsRequest{DailyLimit: &hundred}, ""},
+		{services.DeclineMonthlyLimit, models.CardControlsRequest{MonthlyLimit: &hundred}, ""},
+		{services.DeclineMCCBlocked, models.CardControlsRequest{BlockedMCC: []string{"5411"}}, `,"mcc":"5411"`},
+		{services.DeclineMCCNotAllowed, models.CardControlsRequest{AllowedMCC: []string{"5411"}}, `,"mcc":"5812"`},
+		{services.DeclineOnline, models.CardControlsRequest{OnlineEnabled: &off}, ""},
+		{services.DeclineForeign, models.CardControlsRequest{ForeignEnabled: &off}, `,"country":"US"`},
+	}
+	for _, c := range cases {
+		if _, err := env.Svc.SetCardControls(testutil.Actor(u), card.ID, c.controls); err != nil {
+			t.Fatalf("%s: ограничения: %v", c.code, err)
+		}
+		body := `{"card_number":"` + details.Number + `","expiry":"` + details.Expiry + `","cvv":"` + card.CVV +
+			`","amount":"150","merchant":"shop"` + c.extra + `}`
+		req := httptest.NewRequest("POST", "/payments", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		var resp struct {
+			Code string `json:"code"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusForbidden || resp.Code != c.code {
+			t.Errorf("%s: код %d, code %q; ответ %s", c.code, rec.Code, resp.Code, rec.Body.String())
+		}
+	}
+
+	// без ограничений та же оплата проходит: отказы выше — только из-за них
+	if _, err := env.Svc.SetCardControls(testutil.Actor(u), card.ID, models.CardControlsRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Svc.PayWithCard(testutil.Actor(u), models.PaymentRequest{
+		CardNumber: details.Number, Expiry: details.Expiry, CVV: card.CVV, Amount: decimal.NewFromInt(150), Merchant: "shop",
+	}, nil); err != nil {
+		t.Errorf("оплата без ограничений: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+)
+
+// POST /cards/{id}/block — временная блокировка или permanent:true (утеряна, украдена)
+func (h *Handler) BlockCard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	var req models.CardBlockRequest
+	// тело необязательно: без него блокировка временная
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	card, err := h.svc.BlockCard(h.actor(r), id, req)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, card)
+}
+
+// POST /cards/{id}/unblock — снять свою временную блокировку
+func (h *Handler) UnblockCard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	card, err := h.svc.UnblockCard(h.actor(r), id)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, card)
+}
+
+// POST /cards/{id}/close
+func (h *Handler) CloseCard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	card, err := h.svc.CloseCard(h.actor(r), id)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, card)
+}
+
+// POST /cards/{id}/reissue — новая карта к тому же счёту, старая закрывается
+func (h *Handler) ReissueCard(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	key, err := decodeIdempotent(r, uid, nil)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	card, err := h.svc.ReissueCard(h.actor(r), id, key)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	markReplayed(w, key)
+	respondJSON(w, http.StatusCreated, card)
+}
+
+// POST /step-up — пароль или код TOTP в обмен на одноразовый step-up токен
+func (h *Handler) StepUp(w http.ResponseWriter, r *http.Request) {
+	var req models.StepUpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	tok, err := h.svc.StepUp(h.actor(r), req)
+	if err != nil {
+		respondLoginError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, tok)
+}
+
+// GET /cards/{id}/details — полный номер и срок, заголовок X-Step-Up-Token обязателен
+func (h *Handler) GetCardDetails(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	details, err := h.svc.RevealCardDetails(h.actor(r), id, r.Header.Get("X-Step-Up-Token"))
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// реквизиты не должны оседать в кешах прокси и браузера
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, details)
+}
+
+// POST /cards/{id}/pin — установить PIN
+func (h *Handler) SetCardPIN(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	var req models.SetPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.SetCardPIN(h.actor(r), id, req); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// PUT /cards/{id}/pin — сменить PIN по старому
+func (h *Handler) ChangeCardPIN(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	var req models.ChangePINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.ChangeCardPIN(h.actor(r), id, req); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// машиночитаемая причина отказа в оплате; пусто — ошибка не про отказ
+func declineReason(err error) string {
+	var d *services.CardDeclineError
+	switch {
+	case errors.As(err, &d):
+		return d.Code
+	case errors.Is(err, services.ErrCardDeclined):
+		return "invalid_card_data"
+	case errors.Is(err, services.ErrCardBlocked), errors.Is(err, services.ErrCardBankBlock):
+		return "card_blocked"
+	case errors.Is(err, services.ErrCardExpired):
+		return "card_expired"
+	case errors.Is(err, services.ErrCardClosed):
+		return "card_closed"
+	case errors.Is(err, services.ErrWrongPIN):
+		return "wrong_pin"
+	case errors.Is(err, services.ErrPINLocked):
+		return "pin_tries_exceeded"
+	case errors.Is(err, services.ErrPINNotSet):
+		return "pin_not_set"
+	case errors.Is(err, services.ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, services.ErrAccountFrozen), errors.Is(err, services.ErrAccountClosed):
+		return "account_unavailable"
+	case errors.Is(err, services.ErrForbidden):
+		return "not_permitted"
+	}
+	return ""
+}
+
+// GET /cards/{id}/controls — ограничения и траты за день и месяц
+func (h *Handler) GetCardControls(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	c, err := h.svc.GetCardControls(uid, id)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, c)
+}
+
+// PUT /cards/{id}/controls — лимиты, MCC, онлайн и зарубежные оплаты
+func (h *Handler) SetCardControls(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid card id")
+		return
+	}
+	var req models.CardControlsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	c, err := h.svc.SetCardControls(h.actor(r), id, req)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, c)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"bankapp/internal/config"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32")}
+	cases := []struct {
+		name    string
+		header  string
+		trusted []netip.Prefix
+		remote  string
+		xff     []string
+		want    string
+	}{
+		{"без заголовка в конфиге", "", trusted, "10.0.0.5:443", []string{"203.0.113.7"}, "10.0.0.5"},
+		{"прямое подключение подделывает заголовок", "X-Forwarded-For", trusted, "198.51.100.9:5000", []string{"203.0.113.7"}, "198.51.100.9"},
+		{"один прокси", "X-Forwarded-For", trusted, "10.0.0.5:443", []string{"203.0.113.7"}, "203.0.113.7"},
+		// клиент дописал слева чужой адрес, прокси добавил настоящий справа
+		{"подделка слева", "X-Forwarded-For", trusted, "10.0.0.5:443", []string{"1.1.1.1, 203.0.113.7"}, "203.0.113.7"},
+		{"цепочка прокси", "X-Forwarded-For", trusted, "10.0.0.5:443", []string{"1.1.1.1, 203.0.113.7, 192.0.2.1, 10.1.2.3"}, "203.0.113.7"},
+		{"несколько строк заголовка", "X-Forwarded-For", trusted, "10.0.0.5:443", []string{"1.1.1.1", "203.0.113.7, 10.1.2.3"}, "203.0.113.7"},
+		{"мусор в цепочке", "X-Forwarded-For", trusted, "10.0.0.5:443", []string{"203.0.113.7, not-an-ip, 10.1.2.3"}, "10.1.2.3"},
+		{"все адреса свои", "X-Forwarded-For", trusted, "10.0.0.5:443", []string{"10.9.9.9"}, "10.9.9.9"},
+		{"пустой заголовок", "X-Forwarded-For", trusted, "10.0.0.5:443", nil, "10.0.0.5"},
+		{"X-Real-IP", "X-Real-IP", trusted, "10.0.0.5:443", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"IPv6", "X-Forwarded-For", []netip.Prefix{netip.MustParsePrefix("fd00::/8")}, "[fd00::1]:443", []string{"2001:db8::7"}, "2001:db8::7"},
+	}
+	for _, c := range cases {
+		h := &Handler{cfg: &config.Config{ClientIPHeader: c.header, TrustedProxies: c.trusted}}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		header := c.header
+		if header == "" {
+			header = "X-Forwarded-For"
+		}
+		for _, v := range c.xff {
+			r.Header.Add(header, v)
+		}
+		if got := h.clientIP(r); got != c.want {
+			t.Errorf("%s: %s, ждали %s", c.name, got, c.want)
+		}
+	}
+}
@@ -3,10 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
 
+	"bankapp/internal/config"
 	"bankapp/internal/models"
 	"bankapp/internal/services"
 	"github.com/google/uuid"
@@ -17,14 +22,17 @@ type key int
 
 const (
 	ctxUserID key = iota
+	ctxSessionID
+	ctxRole
 )
 
 type Handler struct {
 	svc *services.BankService
+	cfg *config.Config
 }
 
-func NewHandler(svc *services.BankService) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *services.BankService, cfg *config.Config) *Handler {
+	return &Handler{svc: svc, cfg: cfg}
 }
 
 func respondJSON(w http.ResponseWriter, code int, payload interface{}) {
@@ -37,6 +45,50 @@ func respondError(w http.ResponseWriter, code int, msg string) {
 	respondJSON(w, code, map[string]string{"error": msg})
 }
 
+// ошибка сервиса: известные ошибки получают свой статус, остальные — code
+func respondServiceError(w http.ResponseWriter, code int, err error) {
+	var rl *services.RateLimitedError
+	if errors.As(err, &rl) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(rl.RetryAfter.Seconds())+1))
+	}
+	respondError(w, serviceErrorStatus(code, err), err.Error())
+}
+
+func serviceErrorStatus(code int, err error) int {
+	var decline *services.CardDeclineError
+	switch {
+	case errors.Is(err, services.ErrIdempotencyConflict), errors.Is(err, services.ErrActiveCredit),
+		errors.Is(err, services.ErrCloseBalance), errors.Is(err, services.ErrCardReissued),
+		errors.Is(err, services.ErrCardTransition), errors.Is(err, services.ErrPINAlreadySet):
+		code = http.StatusConflict
+	case errors.Is(err, services.ErrForbidden), errors.Is(err, services.ErrEmailNotVerified),
+		errors.Is(err, services.ErrAccountFrozen), errors.Is(err, services.ErrAccountClosed),
+		errors.Is(err, services.ErrCardBlocked), errors.Is(err, services.ErrCardExpired),
+		errors.Is(err, services.ErrCardClosed), errors.Is(err, services.ErrCardBankBlock),
+		errors.Is(err, services.ErrPINLocked), errors.As(err, &decline):
+		code = http.StatusForbidden
+	case errors.Is(err, services.ErrAccountNotFound), errors.Is(err, services.ErrCreditNotFound),
+		errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrCardNotFound),
+		errors.Is(err, services.ErrStandingOrderNotFound), errors.Is(err, services.ErrRecipientNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, services.ErrPhoneTaken):
+		code = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidStepUp):
+		code = http.StatusUnauthorized
+	case errors.Is(err, services.ErrPhoneCodeResend), errors.Is(err, services.ErrPhoneCodeLocked),
+		errors.Is(err, services.ErrRevealLimit), errors.As(err, new(*services.RateLimitedError)):
+		code = http.StatusTooManyRequests
+	case errors.Is(err, services.ErrUnknownCurrency), errors.Is(err, services.ErrRatesNotPublished),
+		errors.Is(err, services.ErrRatesOutOfRange),
+		errors.Is(err, services.ErrUnknownProduct), errors.Is(err, services.ErrProductUnavailable):
+		code = http.StatusBadRequest
+	case errors.Is(err, services.ErrNoFXRate), errors.Is(err, services.ErrRatesNotLoaded):
+		// курсов нет — временная проблема источника, а не клиента
+		code = http.StatusServiceUnavailable
+	}
+	return code
+}
+
 // POST /register
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
@@ -45,6 +97,10 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user, err := h.svc.RegisterUser(req)
+	if errors.Is(err, services.ErrRegistrationConflict) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
@@ -59,12 +115,53 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	token, err := h.svc.LoginUser(req)
+	pair, err := h.svc.LoginUser(req, h.actor(r))
+	if err != nil {
+		respondLoginError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, pair)
+}
+
+// GET /.well-known/jwks.json — открытые ключи для проверки наших токенов
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, h.svc.JWKS())
+}
+
+// POST /token/refresh
+func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	pair, err := h.svc.RefreshTokens(req.RefreshToken)
 	if err != nil {
 		respondError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"token": token})
+	respondJSON(w, http.StatusOK, pair)
+}
+
+// POST /logout
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	sid, _ := r.Context().Value(ctxSessionID).(uuid.UUID)
+	if err := h.svc.Logout(sid); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// POST /logout-all
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	if err := h.svc.LogoutAll(uid); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
@@ -75,16 +172,77 @@ func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
-		userID, err := h.svc.ParseToken(tokenStr)
+		claims, err := h.svc.ParseToken(tokenStr)
 		if err != nil {
 			respondError(w, http.StatusUnauthorized, "invalid token")
 			return
 		}
-		ctx := context.WithValue(r.Context(), ctxUserID, userID)
+		ctx := context.WithValue(r.Context(), ctxUserID, claims.UserID)
+		ctx = context.WithValue(ctx, ctxSessionID, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// IP клиента. Заголовок CLIENT_IP_HEADER читается, только если соединение
+// пришло от доверенного прокси (TRUSTED_PROXIES). Левые адреса
+// X-Forwarded-For подставляет сам клиент, поэтому список идёт справа:
+// пропускаем свои прокси, первый чужой адрес и есть клиент
+func (h *Handler) clientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+	if h.cfg.ClientIPHeader == "" || !h.trustedProxy(peer) {
+		return peer
+	}
+	// заголовок мог прийти несколькими строками
+	var hops []string
+	for _, v := range r.Header.Values(h.cfg.ClientIPHeader) {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			// мусор в цепочке: дальше неё ничему не верим
+			break
+		}
+		client = hops[i]
+		if !h.trustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+func (h *Handler) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range h.cfg.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 429 с Retry-After при блокировке входа, иначе 401
+func respondLoginError(w http.ResponseWriter, err error) {
+	var te *services.LoginThrottledError
+	if errors.As(err, &te) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(te.RetryAfter.Seconds())+1))
+		respondError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	respondError(w, http.StatusUnauthorized, err.Error())
+}
+
 func userIDFromCtx(ctx context.Context) (uuid.UUID, error) {
 	v := ctx.Value(ctxUserID)
 	if v == nil {
@@ -103,11 +261,19 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
-	acc, err := h.svc.CreateAccount(uid)
+	// тело необязательно: без него открывается рублёвый счёт
+	var req models.CreateAccountRequest
+	key, err := decodeIdempotent(r, uid, optionalBody{&req})
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	acc, err := h.svc.CreateAccount(uid, req, key)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
+	markReplayed(w, key)
 	respondJSON(w, http.StatusCreated, acc)
 }
 
@@ -122,30 +288,38 @@ func (h *Handler) GetAccounts(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GenerateCard(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
 	vars := mux.Vars(r)
 	accID, err := uuid.Parse(vars["id"])
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "invalid account id")
 		return
 	}
-	card, err := h.svc.GenerateCard(accID)
+	key, err := decodeIdempotent(r, uid, nil)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	card, err := h.svc.GenerateCard(h.actor(r), accID, key)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	markReplayed(w, key)
 	respondJSON(w, http.StatusCreated, card)
 }
 
 func (h *Handler) GetCards(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
 	vars := mux.Vars(r)
 	accID, err := uuid.Parse(vars["id"])
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "invalid account id")
 		return
 	}
-	list, err := h.svc.GetAccountCards(accID)
+	list, err := h.svc.GetAccountCards(uid, accID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 	respondJSON(w, http.StatusOK, list)
@@ -153,60 +327,175 @@ func (h *Handler) GetCards(w http.ResponseWriter, r *http.Request) {
 
 // POST /payments
 func (h *Handler) PayWithCard(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
 	var req models.PaymentRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid payload")
+	key, err := decodeIdempotent(r, uid, &req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if err := h.svc.PayWithCard(req); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+	if _, err := h.svc.PayWithCard(h.actor(r), req, key); err != nil {
+		if reason := declineReason(err); reason != "" {
+			respondJSON(w, serviceErrorStatus(http.StatusBadRequest, err), map[string]string{
+				"error": err.Error(),
+				"code":  reason,
+			})
+			return
+		}
+		respondServiceError(w, http.StatusBadRequest, err)
 		return
 	}
+	markReplayed(w, key)
 	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 // POST /transfers
 func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
 	var req models.TransferRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid payload")
+	key, err := decodeIdempotent(r, uid, &req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if err := h.svc.Transfer(req); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+	if _, err := h.svc.Transfer(h.actor(r), req, key); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
 		return
 	}
+	markReplayed(w, key)
 	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 // POST /deposits
 func (h *Handler) Deposit(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
 	var req models.DepositRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid payload")
+	key, err := decodeIdempotent(r, uid, &req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if err := h.svc.Deposit(req); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+	if _, err := h.svc.Deposit(h.actor(r), req, key); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
 		return
 	}
+	markReplayed(w, key)
 	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 // POST /credits
 func (h *Handler) ApplyCredit(w http.ResponseWriter, r *http.Request) {
-	var req models.ApplyCreditRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid payload")
+	uid, err := userIDFromCtx(r.Context())
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
-	credit, sched, err := h.svc.ApplyCredit(req)
+	var req models.ApplyCreditRequest
+	key, err := decodeIdempotent(r, uid, &req)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	credit, sched, err := h.svc.ApplyCredit(h.actor(r), req, key)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	markReplayed(w, key)
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"credit":   credit,
 		"schedule": sched,
 	})
 }
+
+// GET /credits
+func (h *Handler) GetCredits(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	list, err := h.svc.GetCredits(uid)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// GET /schedule/{credit_id}
+func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	vars := mux.Vars(r)
+	creditID, err := uuid.Parse(vars["credit_id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid credit id")
+		return
+	}
+	list, err := h.svc.GetSchedule(uid, creditID)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// GET /accounts/{id}/access
+func (h *Handler) ListAccess(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	accID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	list, err := h.svc.ListAccess(uid, accID)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// PUT /accounts/{id}/access/{user_id}
+func (h *Handler) GrantAccess(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	vars := mux.Vars(r)
+	accID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	granteeID, err := uuid.Parse(vars["user_id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var req models.GrantAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	access, err := h.svc.GrantAccess(uid, accID, granteeID, req.Level)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, access)
+}
+
+// DELETE /accounts/{id}/access/{user_id}
+func (h *Handler) RevokeAccess(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	vars := mux.Vars(r)
+	accID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	granteeID, err := uuid.Parse(vars["user_id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if err := h.svc.RevokeAccess(uid, accID, granteeID); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	headerReplayed       = "Idempotent-Replayed"
+	maxIdempotencyKeyLen = 255
+)
+
+var errInvalidPayload = errors.New("invalid payload")
+
+// необязательное тело: пустой запрос оставляет dst нулевым
+type optionalBody struct {
+	dst interface{}
+}
+
+// читает JSON-тело в dst (dst == nil — тело не ожидается, optionalBody —
+// может отсутствовать) и, если клиент прислал Idempotency-Key, собирает ключ
+// с отпечатком sha256(метод, путь, тело)
+func decodeIdempotent(r *http.Request, uid uuid.UUID, dst interface{}) (*models.IdempotencyKey, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, errInvalidPayload
+	}
+	if opt, ok := dst.(optionalBody); ok {
+		dst = nil
+		if len(bytes.TrimSpace(body)) > 0 {
+			dst = opt.dst
+		}
+	}
+	if dst != nil {
+		if err := json.Unmarshal(body, dst); err != nil {
+			return nil, errInvalidPayload
+		}
+	}
+	k := r.Header.Get(headerIdempotencyKey)
+	if k == "" {
+		return nil, nil
+	}
+	if len(k) > maxIdempotencyKeyLen {
+		return nil, errors.New("Idempotency-Key too long")
+	}
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return &models.IdempotencyKey{
+		UserID:      uid,
+		Key:         k,
+		Fingerprint: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// помечает ответ, взятый из сохранённого
+func markReplayed(w http.ResponseWriter, key *models.IdempotencyKey) {
+	if key != nil && key.Replayed {
+		w.Header().Set(headerReplayed, "true")
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+)
+
+// POST /login/mfa
+func (h *Handler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	pair, err := h.svc.LoginMFA(req, h.actor(r))
+	if err != nil {
+		respondLoginError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, pair)
+}
+
+// POST /2fa/enroll
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	enr, err := h.svc.EnrollTOTP(uid)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, enr)
+}
+
+// POST /2fa/confirm
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	var req models.TOTPConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	codes, err := h.svc.ConfirmTOTP(uid, req.Code)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// POST /2fa/disable
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	var req models.TOTPDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.DisableTOTP(uid, req, h.actor(r)); err != nil {
+		var te *services.LoginThrottledError
+		if errors.As(err, &te) {
+			respondLoginError(w, err)
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
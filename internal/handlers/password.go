@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+)
+
+// POST /password/forgot — ответ одинаковый для любого email
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.ForgotPassword(req.Email, h.actor(r)); err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"status": "если адрес зарегистрирован, на него отправлено письмо со ссылкой",
+	})
+}
+
+// POST /password/reset
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.ResetPassword(req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /email/verify?token=...
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.VerifyEmail(r.URL.Query().Get("token")); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "email подтверждён"})
+}
+
+// POST /email/verify/resend
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	err := h.svc.ResendVerification(uid)
+	if errors.Is(err, services.ErrEmailAlreadyVerified) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
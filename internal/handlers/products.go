@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"bankapp/internal/models"
+)
+
+// GET /account-products — продукты и текущие ставки
+func (h *Handler) ListAccountProducts(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.ListAccountProducts()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// POST /accounts/{id}/terminate — досрочное расторжение вклада
+func (h *Handler) TerminateDeposit(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	var req models.TerminateDepositRequest
+	key, err := decodeIdempotent(r, uid, &req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res, err := h.svc.TerminateDeposit(h.actor(r), id, req, key)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	markReplayed(w, key)
+	respondJSON(w, http.StatusOK, res)
+}
+
+// POST /accounts/{id}/close — закрыть счёт, остаток перевести на to_account_id
+func (h *Handler) CloseAccount(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	// тело необязательно: пустой счёт закрывается без него
+	var req models.CloseAccountRequest
+	key, err := decodeIdempotent(r, uid, optionalBody{&req})
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res, err := h.svc.CloseAccount(h.actor(r), id, req, key)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	markReplayed(w, key)
+	respondJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// дата из ?date=YYYY-MM-DD; без параметра — сегодня
+func parseRateDate(q url.Values) (time.Time, bool) {
+	v := q.Get("date")
+	if v == "" {
+		return time.Now(), true
+	}
+	d, err := time.Parse("2006-01-02", v)
+	return d, err == nil
+}
+
+// GET /rates?date=2024-07-29 — официальные курсы ЦБ
+func (h *Handler) GetRates(w http.ResponseWriter, r *http.Request) {
+	on, ok := parseRateDate(r.URL.Query())
+	if !ok {
+		respondError(w, http.StatusBadRequest, "date: ожидается YYYY-MM-DD")
+		return
+	}
+	table, err := h.svc.RatesOn(on, h.actor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, table)
+}
+
+// GET /rates/convert?from=USD&to=EUR&amount=100&date=2024-07-29
+func (h *Handler) ConvertRates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	on, ok := parseRateDate(q)
+	if !ok {
+		respondError(w, http.StatusBadRequest, "date: ожидается YYYY-MM-DD")
+		return
+	}
+	amount, err := decimal.NewFromString(q.Get("amount"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid amount")
+		return
+	}
+	conv, err := h.svc.ConvertOfficial(q.Get("from"), q.Get("to"), amount, on, h.actor(r))
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, conv)
+}
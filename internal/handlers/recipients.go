@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bankapp/internal/models"
+)
+
+// POST /transfers/preview — кому уйдут деньги, до подтверждения перевода
+func (h *Handler) PreviewTransfer(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	var req models.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	p, err := h.svc.PreviewTransfer(uid, req)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+// POST /phone — отправить код подтверждения на номер
+func (h *Handler) StartPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	var req models.PhoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.StartPhoneVerification(uid, req); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, map[string]string{"status": "code sent"})
+}
+
+// POST /phone/verify
+func (h *Handler) ConfirmPhone(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	var req models.PhoneConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.ConfirmPhone(uid, req); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// PUT /default-account — счёт для переводов по имени и телефону
+func (h *Handler) SetDefaultAccount(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	var req models.DefaultAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.svc.SetDefaultAccount(uid, req); err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
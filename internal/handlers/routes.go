@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// все маршруты API; вынесены из cmd/api, чтобы тесты проходили по тем же
+// маршрутам, что и сервер
+func NewRouter(h *Handler) *mux.Router {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/.well-known/jwks.json", h.JWKS).Methods("GET")
+	r.HandleFunc("/register", h.Register).Methods("POST")
+	r.HandleFunc("/login", h.Login).Methods("POST")
+	r.HandleFunc("/login/mfa", h.LoginMFA).Methods("POST")
+	r.HandleFunc("/token/refresh", h.RefreshToken).Methods("POST")
+	r.HandleFunc("/password/forgot", h.ForgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", h.ResetPassword).Methods("POST")
+	r.HandleFunc("/email/verify", h.VerifyEmail).Methods("GET")
+	r.HandleFunc("/rates", h.GetRates).Methods("GET")
+	r.HandleFunc("/rates/convert", h.ConvertRates).Methods("GET")
+
+	auth := r.PathPrefix("/").Subrouter()
+	auth.Use(h.AuthMiddleware)
+
+	auth.HandleFunc("/logout", h.Logout).Methods("POST")
+	auth.HandleFunc("/logout-all", h.LogoutAll).Methods("POST")
+	auth.HandleFunc("/email/verify/resend", h.ResendVerification).Methods("POST")
+	auth.HandleFunc("/2fa/enroll", h.EnrollTOTP).Methods("POST")
+	auth.HandleFunc("/2fa/confirm", h.ConfirmTOTP).Methods("POST")
+	auth.HandleFunc("/2fa/disable", h.DisableTOTP).Methods("POST")
+	auth.HandleFunc("/step-up", h.StepUp).Methods("POST")
+	auth.HandleFunc("/phone", h.StartPhoneVerification).Methods("POST")
+	auth.HandleFunc("/phone/verify", h.ConfirmPhone).Methods("POST")
+	auth.HandleFunc("/default-account", h.SetDefaultAccount).Methods("PUT")
+	auth.HandleFunc("/accounts", h.CreateAccount).Methods("POST")
+	auth.HandleFunc("/accounts", h.GetAccounts).Methods("GET")
+	auth.HandleFunc("/account-products", h.ListAccountProducts).Methods("GET")
+	auth.HandleFunc("/accounts/{id}/terminate", h.TerminateDeposit).Methods("POST")
+	auth.HandleFunc("/accounts/{id}/close", h.CloseAccount).Methods("POST")
+	auth.HandleFunc("/standing-orders", h.CreateStandingOrder).Methods("POST")
+	auth.HandleFunc("/standing-orders", h.ListStandingOrders).Methods("GET")
+	auth.HandleFunc("/standing-orders/{id}", h.GetStandingOrder).Methods("GET")
+	auth.HandleFunc("/standing-orders/{id}", h.UpdateStandingOrder).Methods("PUT")
+	auth.HandleFunc("/standing-orders/{id}", h.CancelStandingOrder).Methods("DELETE")
+	auth.HandleFunc("/accounts/{id}/cards", h.GenerateCard).Methods("POST")
+	auth.HandleFunc("/accounts/{id}/cards", h.GetCards).Methods("GET")
+	auth.HandleFunc("/accounts/{id}/transactions", h.GetTransactions).Methods("GET")
+	auth.HandleFunc("/accounts/{id}/statement", h.GetStatement).Methods("GET")
+	auth.HandleFunc("/accounts/{id}/access", h.ListAccess).Methods("GET")
+	auth.HandleFunc("/accounts/{id}/access/{user_id}", h.GrantAccess).Methods("PUT")
+	auth.HandleFunc("/accounts/{id}/access/{user_id}", h.RevokeAccess).Methods("DELETE")
+	auth.HandleFunc("/cards/{id}/details", h.GetCardDetails).Methods("GET")
+	auth.HandleFunc("/cards/{id}/controls", h.GetCardControls).Methods("GET")
+	auth.HandleFunc("/cards/{id}/controls", h.SetCardControls).Methods("PUT")
+	auth.HandleFunc("/cards/{id}/pin", h.SetCardPIN).Methods("POST")
+	auth.HandleFunc("/cards/{id}/pin", h.ChangeCardPIN).Methods("PUT")
+	auth.HandleFunc("/cards/{id}/block", h.BlockCard).Methods("POST")
+	auth.HandleFunc("/cards/{id}/unblock", h.UnblockCard).Methods("POST")
+	auth.HandleFunc("/cards/{id}/close", h.CloseCard).Methods("POST")
+	auth.HandleFunc("/cards/{id}/reissue", h.ReissueCard).Methods("POST")
+	auth.HandleFunc("/payments", h.PayWithCard).Methods("POST")
+	auth.HandleFunc("/transfers", h.Transfer).Methods("POST")
+	auth.HandleFunc("/transfers/preview", h.PreviewTransfer).Methods("POST")
+	auth.HandleFunc("/deposits", h.Deposit).Methods("POST")
+	auth.HandleFunc("/credits", h.ApplyCredit).Methods("POST")
+	auth.HandleFunc("/credits", h.GetCredits).Methods("GET")
+	auth.HandleFunc("/schedule/{credit_id}", h.GetSchedule).Methods("GET")
+
+	// бэк-офис: права проверяются по роли на каждом маршруте
+	admin := auth.PathPrefix("/admin").Subrouter()
+	admin.Handle("/users", h.RequirePermission(services.PermUsersRead, h.AdminSearchUsers)).Methods("GET")
+	admin.Handle("/users/{id}", h.RequirePermission(services.PermUsersRead, h.AdminGetUser)).Methods("GET")
+	admin.Handle("/users/{id}/role", h.RequirePermission(services.PermUsersSetRole, h.AdminSetRole)).Methods("PUT")
+	admin.Handle("/accounts/{id}", h.RequirePermission(services.PermAccountsRead, h.AdminGetAccount)).Methods("GET")
+	admin.Handle("/accounts/{id}/transactions", h.RequirePermission(services.PermAccountsRead, h.AdminAccountTransactions)).Methods("GET")
+	admin.Handle("/accounts/{id}/freeze", h.RequirePermission(services.PermAccountsFreeze, h.AdminSetAccountStatus(models.AccountFrozen))).Methods("POST")
+	admin.Handle("/accounts/{id}/unfreeze", h.RequirePermission(services.PermAccountsFreeze, h.AdminSetAccountStatus(models.AccountActive))).Methods("POST")
+	admin.Handle("/cards/{id}/block", h.RequirePermission(services.PermCardsBlock, h.AdminSetCardStatus(models.CardTempBlocked))).Methods("POST")
+	admin.Handle("/cards/{id}/unblock", h.RequirePermission(services.PermCardsBlock, h.AdminSetCardStatus(models.CardActive))).Methods("POST")
+	admin.Handle("/cards/{id}/block-permanently", h.RequirePermission(services.PermCardsBlock, h.AdminSetCardStatus(models.CardPermBlocked))).Methods("POST")
+	admin.Handle("/login/unlock", h.RequirePermission(services.PermLoginUnlock, h.UnlockLogin)).Methods("POST")
+	admin.Handle("/account-products/{code}", h.RequirePermission(services.PermProductsManage, h.AdminSetProductRate)).Methods("PUT")
+	admin.Handle("/scheduler/run", h.RequirePermission(services.PermSchedulerRun, h.AdminRunScheduler)).Methods("POST")
+	admin.Handle("/audit", h.RequirePermission(services.PermAuditRead, h.AdminAuditLog)).Methods("GET")
+
+	return r
+}
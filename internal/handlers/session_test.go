@@ -0,0 +1,34 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bankapp/internal/handlers"
+	"bankapp/internal/testutil"
+)
+
+// после POST /logout тот же access-токен получает 401, хотя срок его не истёк
+func TestRevokedSessionUnauthorized(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	router := handlers.NewRouter(handlers.NewHandler(env.Svc, env.Cfg))
+	token := env.Token(t, env.User(t))
+
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := do("GET", "/accounts"); code != http.StatusOK {
+		t.Fatalf("до выхода: код %d", code)
+	}
+	if code := do("POST", "/logout"); code >= 300 {
+		t.Fatalf("выход: код %d", code)
+	}
+	if code := do("GET", "/accounts"); code != http.StatusUnauthorized {
+		t.Errorf("после выхода: код %d, ждали 401", code)
+	}
+}
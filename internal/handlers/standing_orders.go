@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bankapp/internal/models"
+)
+
+// POST /standing-orders
+func (h *Handler) CreateStandingOrder(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	var req models.StandingOrderRequest
+	key, err := decodeIdempotent(r, uid, &req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	o, err := h.svc.CreateStandingOrder(uid, req, key)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	markReplayed(w, key)
+	respondJSON(w, http.StatusCreated, o)
+}
+
+// GET /standing-orders
+func (h *Handler) ListStandingOrders(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	list, err := h.svc.ListStandingOrders(uid)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// GET /standing-orders/{id}
+func (h *Handler) GetStandingOrder(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid standing order id")
+		return
+	}
+	o, err := h.svc.GetStandingOrder(uid, id)
+	if err != nil {
+		respondServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, o)
+}
+
+// PUT /standing-orders/{id} — новые условия целиком
+func (h *Handler) UpdateStandingOrder(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid standing order id")
+		return
+	}
+	var req models.StandingOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	o, err := h.svc.UpdateStandingOrder(uid, id, req)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, o)
+}
+
+// DELETE /standing-orders/{id} — отмена; история исполнений остаётся
+func (h *Handler) CancelStandingOrder(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid standing order id")
+		return
+	}
+	o, err := h.svc.CancelStandingOrder(uid, id)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, o)
+}
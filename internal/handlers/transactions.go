@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// GET /accounts/{id}/transactions
+// ?from=&to=&type=transfer,deposit&min_amount=&max_amount=&counterparty=&q=&cursor=&limit=
+func (h *Handler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	accID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	q := r.URL.Query()
+	f, err := parseTransactionFilter(q)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := h.svc.GetTransactions(uid, accID, f, q.Get("cursor"))
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, page)
+}
+
+func parseTransactionFilter(q url.Values) (models.TransactionFilter, error) {
+	var f models.TransactionFilter
+	var err error
+	if v := q.Get("from"); v != "" {
+		if f.From, err = parseDateParam(v, false); err != nil {
+			return f, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = parseDateParam(v, true); err != nil {
+			return f, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	if v := q.Get("type"); v != "" {
+		f.Types = strings.Split(v, ",")
+	}
+	if v := q.Get("min_amount"); v != "" {
+		d, err := decimal.NewFromString(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_amount")
+		}
+		f.MinAmount = &d
+	}
+	if v := q.Get("max_amount"); v != "" {
+		d, err := decimal.NewFromString(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid max_amount")
+		}
+		f.MaxAmount = &d
+	}
+	f.Counterparty = q.Get("counterparty")
+	f.Query = q.Get("q")
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return f, fmt.Errorf("invalid limit")
+		}
+	}
+	return f, nil
+}
+
+// RFC3339 или YYYY-MM-DD; для верхней границы дата без времени включается целиком
+func parseDateParam(v string, upper bool) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// GET /accounts/{id}/statement?from=&to=&format=csv|pdf|1c
+func (h *Handler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	uid, _ := userIDFromCtx(r.Context())
+	accID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid account id")
+		return
+	}
+	q := r.URL.Query()
+	// по умолчанию — с начала текущего месяца по сегодня
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	if v := q.Get("from"); v != "" {
+		t, err := parseDateParam(v, false)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid from")
+			return
+		}
+		from = *t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := parseDateParam(v, true)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid to")
+			return
+		}
+		to = *t
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = services.StatementCSV
+	}
+	contentType, ok := statementContentTypes[format]
+	if !ok {
+		respondError(w, http.StatusBadRequest, services.ErrUnknownStatementFormat.Error())
+		return
+	}
+	st, err := h.svc.GetStatement(uid, accID, from, to)
+	if err != nil {
+		respondServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	// рендерим в буфер, чтобы ошибка не пришла посреди файла
+	var buf bytes.Buffer
+	if err := h.svc.RenderStatement(&buf, st, format); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	name := fmt.Sprintf("statement_%s_%s_%s.%s", st.Account.Number,
+		from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"), statementExt[format])
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+var statementContentTypes = map[string]string{
+	services.StatementCSV: "text/csv; charset=utf-8",
+	services.StatementPDF: "application/pdf",
+	services.Statement1C:  "text/plain; charset=windows-1251",
+}
+
+var statementExt = map[string]string{
+	services.StatementCSV: "csv",
+	services.StatementPDF: "pdf",
+	services.Statement1C:  "txt",
+}
@@ -1,8 +1,14 @@
 package models
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,7 +25,64 @@ type User struct {
 	Username     string    `db:"username" json:"username"`
 	Email        string    `db:"email" json:"email"`
 	PasswordHash string    `db:"password_hash" json:"-"`
-	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	TOTPSecret   []byte    `db:"totp_secret_enc" json:"-"` // зашифрован AES-GCM
+	TOTPEnabled  bool      `db:"totp_enabled" json:"totp_enabled"`
+	TOTPLastStep int64     `db:"totp_last_step" json:"-"`
+	// nil — email не подтверждён, операции с деньгами закрыты
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at,omitempty"`
+	Role            string     `db:"role" json:"role"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	// подтверждённый телефон в формате E.164; по нему и по имени
+	// переводы зачисляются на счёт по умолчанию
+	Phone            *string    `db:"phone" json:"phone,omitempty"`
+	PhoneVerifiedAt  *time.Time `db:"phone_verified_at" json:"phone_verified_at,omitempty"`
+	DefaultAccountID *uuid.UUID `db:"default_account_id" json:"default_account_id,omitempty"`
+}
+
+// роли; права ролей описаны в services/rbac.go
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// кто выполняет действие — для журнала аудита
+type Actor struct {
+	UserID    uuid.UUID
+	Role      string
+	IP        string
+	UserAgent string
+}
+
+// области учёта неудачных входов
+const (
+	LoginScopeUser = "user"
+	LoginScopeIP   = "ip"
+)
+
+type LoginAttempt struct {
+	Scope         string     `db:"scope" json:"scope"`
+	Key           string     `db:"key" json:"key"`
+	Failures      int        `db:"failures" json:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   *time.Time `db:"locked_until" json:"locked_until,omitempty"`
+}
+
+// назначения одноразовых токенов из писем
+const (
+	TokenPasswordReset = "password_reset"
+	TokenEmailVerify   = "email_verify"
+)
+
+type UserToken struct {
+	ID        uuid.UUID  `db:"id"`
+	UserID    uuid.UUID  `db:"user_id"`
+	Purpose   string     `db:"purpose"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
 }
 
 func (u *User) Validate(passwordPlain string) error {
@@ -36,12 +99,154 @@ func (u *User) Validate(passwordPlain string) error {
 	return nil
 }
 
+// сессия входа; все refresh-токены одной сессии — одно семейство
+type Session struct {
+	ID           uuid.UUID  `db:"id" json:"id"`
+	UserID       uuid.UUID  `db:"user_id" json:"user_id"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	RevokedAt    *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	RevokeReason *string    `db:"revoke_reason" json:"revoke_reason,omitempty"`
+}
+
+// refresh-токен хранится только в виде sha256
+type RefreshToken struct {
+	ID        uuid.UUID  `db:"id"`
+	SessionID uuid.UUID  `db:"session_id"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// пара токенов после входа или обновления; token — access-токен
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// ответ на вход: либо пара токенов, либо запрос второго фактора
+type LoginResponse struct {
+	*TokenPair
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// начало подключения TOTP
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// проверенный access-токен
+type TokenClaims struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+}
+
 type Account struct {
 	ID        uuid.UUID       `db:"id" json:"id"`
 	UserID    uuid.UUID       `db:"user_id" json:"user_id"`
 	Number    string          `db:"number" json:"number"`
 	Balance   decimal.Decimal `db:"balance" json:"balance"`
+	Currency  string          `db:"currency" json:"currency"`
+	Status    string          `db:"status" json:"status"`
 	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	// причина последней смены статуса и дата закрытия
+	StatusReason string     `db:"status_reason" json:"status_reason,omitempty"`
+	ClosedAt     *time.Time `db:"closed_at" json:"closed_at,omitempty"`
+	// продукт и проценты: у накопительного счёта ставка берётся из продукта
+	// на каждый день, у вклада — зафиксирована при открытии
+	Product      string           `db:"product" json:"product"`
+	InterestRate *decimal.Decimal `db:"interest_rate" json:"interest_rate,omitempty"`
+	PenaltyRate  *decimal.Decimal `db:"penalty_rate" json:"penalty_rate,omitempty"`
+	Capitalize   bool             `db:"capitalize" json:"capitalize"`
+	TermMonths   *int             `db:"term_months" json:"term_months,omitempty"`
+	MaturesOn    *time.Time       `db:"matures_on" json:"matures_on,omitempty"`
+	// начислено и не выплачено; в книге отражена часть AccruedPosted
+	Accrued        decimal.Decimal `db:"accrued" json:"accrued_interest"`
+	AccruedPosted  decimal.Decimal `db:"accrued_posted" json:"-"`
+	InterestPaid   decimal.Decimal `db:"interest_paid" json:"interest_paid"`
+	AccruedThrough *time.Time      `db:"accrued_through" json:"-"`
+}
+
+// продукты счетов
+const (
+	ProductCurrent     = "current"      // расчётный, без процентов
+	ProductSavings     = "savings"      // накопительный: плавающая ставка, выплата в конце месяца
+	ProductTermDeposit = "term_deposit" // срочный вклад: фиксированная ставка и срок
+)
+
+// условия продукта в валюте
+type AccountProduct struct {
+	Code          string          `db:"code" json:"code"`
+	Currency      string          `db:"currency" json:"currency"`
+	AnnualRate    decimal.Decimal `db:"annual_rate" json:"annual_rate"`
+	PenaltyRate   decimal.Decimal `db:"penalty_rate" json:"penalty_rate"`
+	MinTermMonths int             `db:"min_term_months" json:"min_term_months"`
+	MaxTermMonths int             `db:"max_term_months" json:"max_term_months"`
+	UpdatedAt     time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// итог досрочного расторжения вклада: проценты пересчитаны по штрафной
+// ставке, Adjustment < 0 — удержано из ранее выплаченных
+type DepositTermination struct {
+	Account      Account         `json:"account"`
+	InterestPaid decimal.Decimal `json:"interest_paid"`
+	Adjustment   decimal.Decimal `json:"adjustment"`
+	Transfer     *Transaction    `json:"transfer,omitempty"`
+}
+
+// итог закрытия счёта: выплаченные напоследок проценты и перевод остатка
+type AccountClosure struct {
+	Account      Account         `json:"account"`
+	InterestPaid decimal.Decimal `json:"interest_paid"`
+	Transfer     *Transaction    `json:"transfer,omitempty"`
+}
+
+// валюта счёта: цифровой код ISO 4217 и число знаков после запятой
+type Currency struct {
+	Code     string
+	Numeric  string
+	Exponent int32
+}
+
+const CurrencyRUB = "RUB"
+
+// поддерживаемые валюты; при добавлении нужны системные счета (миграция 000017)
+var Currencies = map[string]Currency{
+	"RUB": {"RUB", "810", 2},
+	"USD": {"USD", "840", 2},
+	"EUR": {"EUR", "978", 2},
+	"CNY": {"CNY", "156", 2},
+}
+
+// округление до минимальной единицы валюты (банковское, до чётного)
+func RoundAmount(amount decimal.Decimal, currency string) decimal.Decimal {
+	return amount.RoundBank(Currencies[currency].Exponent)
+}
+
+// статусы счёта; по замороженному и закрытому счёту деньги не двигаются,
+// закрытый счёт обратно не открывается
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	AccountClosed = "closed"
+)
+
+// уровни делегированного доступа к счёту; владельцу доступно всё
+const (
+	AccessView    = "view"    // видеть счёт, карты, кредиты
+	AccessOperate = "operate" // плюс двигать деньги и выпускать карты
+)
+
+type AccountAccess struct {
+	AccountID uuid.UUID `db:"account_id" json:"account_id"`
+	UserID    uuid.UUID `db:"user_id" json:"user_id"`
+	Level     string    `db:"level" json:"level"`
+	GrantedBy uuid.UUID `db:"granted_by" json:"granted_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
 }
 
 type Card struct {
@@ -50,18 +255,300 @@ type Card struct {
 	NumberEnc []byte    `db:"number_enc" json:"-"`
 	ExpiryEnc []byte    `db:"expiry_enc" json:"-"`
 	CVVHash   string    `db:"cvv_hash" json:"-"`
+	// CVV открытым текстом — только в ответе, выпустившем карту; в базе
+	// и в сохранённом ответе идемпотентности его нет
+	CVV       string    `db:"-" json:"cvv,omitempty"`
 	HMAC      string    `db:"hmac" json:"-"`
+	Status    string    `db:"status" json:"status"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	// кто поставил временную блокировку и почему сменился статус
+	BlockedBy    *string    `db:"blocked_by" json:"blocked_by,omitempty"`
+	StatusReason string     `db:"status_reason" json:"status_reason,omitempty"`
+	ExpiresOn    time.Time  `db:"expires_on" json:"expires_on"`
+	ReissuedFrom *uuid.UUID `db:"reissued_from" json:"reissued_from,omitempty"`
+	CVVFailures  int        `db:"cvv_failures" json:"-"`
+	// первые 6 и последние 4 цифры; полный номер — только через /cards/{id}/details
+	MaskedPAN *string `db:"masked_pan" json:"masked_pan,omitempty"`
+	// смещение PIN; сам PIN нигде не хранится
+	PINOffset   *string `db:"pin_offset" json:"-"`
+	PINFailures int     `db:"pin_failures" json:"-"`
+	PINSet      bool    `db:"pin_set" json:"pin_set"`
+}
+
+// ограничения карты; лимиты в валюте счёта, nil — без лимита
+type CardControls struct {
+	CardID         uuid.UUID        `db:"card_id" json:"card_id"`
+	PerTxLimit     *decimal.Decimal `db:"per_tx_limit" json:"per_tx_limit"`
+	DailyLimit     *decimal.Decimal `db:"daily_limit" json:"daily_limit"`
+	MonthlyLimit   *decimal.Decimal `db:"monthly_limit" json:"monthly_limit"`
+	AllowedMCC     []string         `db:"-" json:"allowed_mcc"`
+	BlockedMCC     []string         `db:"-" json:"blocked_mcc"`
+	OnlineEnabled  bool             `db:"online_enabled" json:"online_enabled"`
+	ForeignEnabled bool             `db:"foreign_enabled" json:"foreign_enabled"`
+	UpdatedAt      *time.Time       `db:"updated_at" json:"updated_at,omitempty"`
+	// потрачено за сегодня и текущий месяц (по Москве)
+	SpentToday decimal.Decimal `db:"-" json:"spent_today"`
+	SpentMonth decimal.Decimal `db:"-" json:"spent_month"`
+}
+
+// PUT заменяет ограничения целиком; online/foreign без значения — разрешены
+type CardControlsRequest struct {
+	PerTxLimit     *decimal.Decimal `json:"per_tx_limit"`
+	DailyLimit     *decimal.Decimal `json:"daily_limit"`
+	MonthlyLimit   *decimal.Decimal `json:"monthly_limit"`
+	AllowedMCC     []string         `json:"allowed_mcc"`
+	BlockedMCC     []string         `json:"blocked_mcc"`
+	OnlineEnabled  *bool            `json:"online_enabled"`
+	ForeignEnabled *bool            `json:"foreign_enabled"`
+}
+
+// полные реквизиты карты, отдаются один раз на step-up токен
+type CardDetails struct {
+	CardID uuid.UUID `json:"card_id"`
+	Number string    `json:"number"`
+	Expiry string    `json:"expiry"`
+}
+
+// статусы карты; платить можно только активной
+const (
+	CardActive      = "active"
+	CardTempBlocked = "temp_blocked" // снимает тот, кто поставил
+	CardPermBlocked = "perm_blocked" // утеряна или украдена
+	CardExpired     = "expired"
+	CardClosed      = "closed"
+)
+
+// кто заблокировал карту
+const (
+	BlockedByCustomer = "customer"
+	BlockedByBank     = "bank"
+)
+
+// запись журнала аудита; записи связаны в цепочку хешей
+type AuditEvent struct {
+	ID           int64           `db:"id" json:"id"`
+	ActorID      *uuid.UUID      `db:"actor_id" json:"actor_id,omitempty"`
+	ActorRole    string          `db:"actor_role" json:"actor_role"`
+	Action       string          `db:"action" json:"action"`
+	ResourceType string          `db:"resource_type" json:"resource_type"`
+	ResourceID   string          `db:"resource_id" json:"resource_id"`
+	IP           string          `db:"ip" json:"ip"`
+	UserAgent    string          `db:"user_agent" json:"user_agent"`
+	Details      json.RawMessage `db:"details" json:"details"`
+	Before       json.RawMessage `db:"before" json:"before,omitempty"`
+	After        json.RawMessage `db:"after" json:"after,omitempty"`
+	PrevHash     *string         `db:"prev_hash" json:"prev_hash,omitempty"`
+	Hash         *string         `db:"hash" json:"hash,omitempty"`
+	CreatedAt    time.Time       `db:"created_at" json:"created_at"`
+}
+
+// prev_hash первой записи цепочки
+var AuditGenesisHash = strings.Repeat("0", 64)
+
+// sha256(prev || канонический JSON полей записи). JSONB в Postgres
+// переформатирует документы, поэтому JSON-поля приводятся к канонической
+// форме: ключи по алфавиту, без пробелов, числа через decimal
+func (e *AuditEvent) ChainHash(prev string) (string, error) {
+	var err error
+	c := struct {
+		ID           int64           `json:"id"`
+		CreatedAt    string          `json:"created_at"`
+		ActorID      *uuid.UUID      `json:"actor_id"`
+		ActorRole    string          `json:"actor_role"`
+		Action       string          `json:"action"`
+		ResourceType string          `json:"resource_type"`
+		ResourceID   string          `json:"resource_id"`
+		IP           string          `json:"ip"`
+		UserAgent    string          `json:"user_agent"`
+		Details      json.RawMessage `json:"details"`
+		Before       json.RawMessage `json:"before"`
+		After        json.RawMessage `json:"after"`
+	}{
+		ID:           e.ID,
+		CreatedAt:    e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ActorID:      e.ActorID,
+		ActorRole:    e.ActorRole,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		IP:           e.IP,
+		UserAgent:    e.UserAgent,
+	}
+	if c.Details, err = canonicalJSON(e.Details); err != nil {
+		return "", err
+	}
+	if c.Before, err = canonicalJSON(e.Before); err != nil {
+		return "", err
+	}
+	if c.After, err = canonicalJSON(e.After); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func canonicalJSON(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	v, err := canonicalNumbers(v)
+	if err != nil {
+		return nil, err
+	}
+	// map[string]interface{} json.Marshal выводит с ключами по алфавиту
+	return json.Marshal(v)
+}
+
+func canonicalNumbers(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case json.Number:
+		d, err := decimal.NewFromString(t.String())
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(d.String()), nil
+	case map[string]interface{}:
+		for k, x := range t {
+			c, err := canonicalNumbers(x)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = c
+		}
+	case []interface{}:
+		for i, x := range t {
+			c, err := canonicalNumbers(x)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = c
+		}
+	}
+	return v, nil
+}
+
+// карточка клиента в бэк-офисе
+type AdminUserView struct {
+	User     User      `json:"user"`
+	Accounts []Account `json:"accounts"`
 }
 
 type Transaction struct {
-	ID        uuid.UUID       `db:"id" json:"id"`
-	From      *uuid.UUID      `db:"from_account_id" json:"from_account_id,omitempty"`
-	To        *uuid.UUID      `db:"to_account_id" json:"to_account_id,omitempty"`
-	Amount    decimal.Decimal `db:"amount" json:"amount"`
-	Type      string          `db:"transaction_type" json:"transaction_type"`
-	Note      string          `db:"note" json:"note,omitempty"`
-	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	ID       uuid.UUID       `db:"id" json:"id"`
+	From     *uuid.UUID      `db:"from_account_id" json:"from_account_id,omitempty"`
+	To       *uuid.UUID      `db:"to_account_id" json:"to_account_id,omitempty"`
+	Amount   decimal.Decimal `db:"amount" json:"amount"`
+	Currency string          `db:"currency" json:"currency"`
+	// при конвертации: зачисленная сумма, её валюта и курс (единиц
+	// ToCurrency за единицу Currency, уже со спредом)
+	ToAmount   *decimal.Decimal `db:"to_amount" json:"to_amount,omitempty"`
+	ToCurrency *string          `db:"to_currency" json:"to_currency,omitempty"`
+	FXRate     *decimal.Decimal `db:"fx_rate" json:"fx_rate,omitempty"`
+	Type       string           `db:"transaction_type" json:"transaction_type"`
+	Note       string           `db:"note" json:"note,omitempty"`
+	CreatedAt  time.Time        `db:"created_at" json:"created_at"`
+}
+
+// сумма операции в валюте счёта accountID: получатель конвертации видит
+// зачисленную сумму, отправитель — списанную
+func (t *Transaction) AmountFor(accountID uuid.UUID) decimal.Decimal {
+	if t.ToAmount != nil && t.To != nil && *t.To == accountID {
+		return *t.ToAmount
+	}
+	return t.Amount
+}
+
+// типы операций в transactions
+const (
+	TxTransfer      = "transfer"
+	TxDeposit       = "deposit"
+	TxPayment       = "payment"
+	TxCreditPayment = "credit_payment"
+	TxInterest      = "interest"
+	// выдача кредита: из ссудного портфеля на счёт заёмщика
+	TxCreditDisbursement = "credit_disbursement"
+)
+
+// официальный курс ЦБ РФ: Value рублей за Nominal единиц валюты
+type FXRate struct {
+	Date     time.Time       `db:"rate_date" json:"date"`
+	Currency string          `db:"currency" json:"currency"`
+	NumCode  string          `db:"num_code" json:"num_code"`
+	Name     string          `db:"name" json:"name"`
+	Nominal  int             `db:"nominal" json:"nominal"`
+	Value    decimal.Decimal `db:"value" json:"value"`
+	Rate     decimal.Decimal `db:"rate" json:"rate"` // за одну единицу
+}
+
+// курсы на запрошенный день; Date — дата установления (для выходных
+// и праздников — последний рабочий день)
+type FXRateTable struct {
+	Requested time.Time `json:"requested_date"`
+	Date      time.Time `json:"date"`
+	Rates     []FXRate  `json:"rates"`
+}
+
+// пересчёт по официальному курсу, без спреда банка
+type FXConversion struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Amount decimal.Decimal `json:"amount"`
+	Rate   decimal.Decimal `json:"rate"`
+	Result decimal.Decimal `json:"result"`
+	Date   time.Time       `json:"date"`
+}
+
+// фильтр истории операций; AfterCreatedAt/AfterID — позиция курсора
+type TransactionFilter struct {
+	From           *time.Time
+	To             *time.Time
+	Types          []string
+	MinAmount      *decimal.Decimal
+	MaxAmount      *decimal.Decimal
+	Counterparty   string // id или номер счёта второй стороны
+	Query          string // подстрока в примечании
+	AfterCreatedAt *time.Time
+	AfterID        uuid.UUID
+	Ascending      bool
+	Limit          int
+}
+
+// операция в истории счёта с остатком после неё
+type HistoryEntry struct {
+	Transaction
+	CounterpartyID     *uuid.UUID      `db:"counterparty_id" json:"counterparty_id,omitempty"`
+	CounterpartyNumber *string         `db:"counterparty_number" json:"counterparty_number,omitempty"`
+	BalanceAfter       decimal.Decimal `db:"balance_after" json:"balance_after"`
+}
+
+type TransactionPage struct {
+	Items      []HistoryEntry `json:"items"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// выписка по счёту за период [From, To)
+type Statement struct {
+	Account  Account
+	Owner    string
+	From     time.Time
+	To       time.Time
+	Opening  decimal.Decimal
+	Closing  decimal.Decimal
+	TotalIn  decimal.Decimal
+	TotalOut decimal.Decimal
+	Entries  []HistoryEntry
 }
 
 type Credit struct {
@@ -69,13 +556,74 @@ type Credit struct {
 	UserID     uuid.UUID       `db:"user_id" json:"user_id"`
 	AccountID  uuid.UUID       `db:"account_id" json:"account_id"`
 	Principal  decimal.Decimal `db:"principal" json:"principal"`
+	Currency   string          `db:"currency" json:"currency"`
 	AnnualRate decimal.Decimal `db:"annual_rate" json:"annual_rate"`
+	RateSource string          `db:"rate_source" json:"rate_source"`
+	RateDate   *time.Time      `db:"rate_date" json:"rate_date,omitempty"`
 	TermMonths int             `db:"term_months" json:"term_months"`
 	StartAt    time.Time       `db:"start_at" json:"start_at"`
 	Remaining  decimal.Decimal `db:"remaining" json:"remaining"`
 	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
 }
 
+// результат оформления кредита
+type CreditApplication struct {
+	Credit   Credit            `json:"credit"`
+	Schedule []PaymentSchedule `json:"schedule"`
+}
+
+// внутренние счета банка (см. миграцию 000008)
+var (
+	SystemUserID             = uuid.MustParse("00000000-0000-0000-0000-000000000000")
+	SystemCashIn             = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	SystemMerchantSettlement = uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	SystemLoanInterestIncome = uuid.MustParse("00000000-0000-0000-0000-000000000003")
+	SystemLoanPortfolio      = uuid.MustParse("00000000-0000-0000-0000-000000000004")
+	SystemFXPosition         = uuid.MustParse("00000000-0000-0000-0000-000000000005")
+	SystemInterestExpense    = uuid.MustParse("00000000-0000-0000-0000-000000000006")
+	SystemInterestPayable    = uuid.MustParse("00000000-0000-0000-0000-000000000007")
+)
+
+// системный счёт base в валюте currency: у рублёвых четвёртая группа id
+// нулевая, у валютных в ней цифровой код валюты (см. миграцию 000017)
+func SystemAccount(base uuid.UUID, currency string) uuid.UUID {
+	if currency == CurrencyRUB {
+		return base
+	}
+	return uuid.MustParse(fmt.Sprintf("00000000-0000-0000-%04s-%s", Currencies[currency].Numeric, base.String()[24:]))
+}
+
+const (
+	PostingDebit  = "debit"
+	PostingCredit = "credit"
+)
+
+// проводка в журнале: сумма дебетов равна сумме кредитов
+type JournalEntry struct {
+	ID            uuid.UUID  `db:"id" json:"id"`
+	TransactionID *uuid.UUID `db:"transaction_id" json:"transaction_id,omitempty"`
+	Description   string     `db:"description" json:"description"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	Postings      []Posting  `db:"-" json:"postings"`
+}
+
+// одна сторона проводки; остаток счёта = кредиты - дебеты
+type Posting struct {
+	ID        uuid.UUID       `db:"id" json:"id"`
+	EntryID   uuid.UUID       `db:"entry_id" json:"entry_id"`
+	AccountID uuid.UUID       `db:"account_id" json:"account_id"`
+	Direction string          `db:"direction" json:"direction"`
+	Amount    decimal.Decimal `db:"amount" json:"amount"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+// счёт, у которого кешированный остаток разошёлся с проводками
+type LedgerMismatch struct {
+	AccountID uuid.UUID       `db:"account_id" json:"account_id"`
+	Balance   decimal.Decimal `db:"balance" json:"balance"`
+	Posted    decimal.Decimal `db:"posted" json:"posted"`
+}
+
 type PaymentSchedule struct {
 	ID        uuid.UUID       `db:"id" json:"id"`
 	CreditID  uuid.UUID       `db:"credit_id" json:"credit_id"`
@@ -86,6 +634,75 @@ type PaymentSchedule struct {
 	Paid      bool            `db:"paid" json:"paid"`
 }
 
+// постоянное поручение: перевод по расписанию
+type StandingOrder struct {
+	ID            uuid.UUID       `db:"id" json:"id"`
+	UserID        uuid.UUID       `db:"user_id" json:"user_id"`
+	FromAccountID uuid.UUID       `db:"from_account_id" json:"from_account_id"`
+	ToAccountID   uuid.UUID       `db:"to_account_id" json:"to_account_id"`
+	Amount        decimal.Decimal `db:"amount" json:"amount"`
+	Note          string          `db:"note" json:"note"`
+	Rule          string          `db:"rule" json:"rule"`
+	DayOfMonth    *int            `db:"day_of_month" json:"day_of_month,omitempty"`
+	Weekday       *int            `db:"weekday" json:"weekday,omitempty"`
+	Cron          string          `db:"cron" json:"cron,omitempty"`
+	StartDate     time.Time       `db:"start_date" json:"start_date"`
+	EndDate       *time.Time      `db:"end_date" json:"end_date,omitempty"`
+	MaxRuns       *int            `db:"max_runs" json:"max_runs,omitempty"`
+	Runs          int             `db:"runs" json:"runs"`
+	NextRunOn     *time.Time      `db:"next_run_on" json:"next_run_on,omitempty"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	Status        string          `db:"status" json:"status"`
+	LastRunAt     *time.Time      `db:"last_run_at" json:"last_run_at,omitempty"`
+	LastError     string          `db:"last_error" json:"last_error,omitempty"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// правила повторения постоянного поручения
+const (
+	RuleMonthly = "monthly" // день месяца; 31 — последний день
+	RuleWeekly  = "weekly"  // день недели, 0 — воскресенье
+	RuleCron    = "cron"    // «день месяц день_недели», как в crontab
+)
+
+// статусы постоянного поручения
+const (
+	StandingOrderActive    = "active"
+	StandingOrderFinished  = "finished"
+	StandingOrderCancelled = "cancelled"
+)
+
+// отправленный по SMS код подтверждения телефона
+type PhoneVerification struct {
+	UserID    uuid.UUID `db:"user_id"`
+	Phone     string    `db:"phone"`
+	CodeHash  string    `db:"code_hash"`
+	Attempts  int       `db:"attempts"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// сохранённый результат запроса с заголовком Idempotency-Key
+type IdempotencyRecord struct {
+	UserID      uuid.UUID `db:"user_id"`
+	Key         string    `db:"key"`
+	Fingerprint string    `db:"fingerprint"`
+	Response    []byte    `db:"response"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// ключ идемпотентности входящего запроса.
+// Fingerprint — sha256 от метода, пути и тела; Replayed выставляет сервис,
+// если вернул сохранённый ответ вместо повторного выполнения
+type IdempotencyKey struct {
+	UserID      uuid.UUID
+	Key         string
+	Fingerprint string
+	Replayed    bool
+}
+
 // DTO
 type RegisterRequest struct {
 	Username string `json:"username"`
@@ -96,20 +713,145 @@ type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// повторное подтверждение личности: пароль или код TOTP
+type StepUpRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+type StepUpToken struct {
+	Token     string `json:"step_up_token"`
+	ExpiresIn int    `json:"expires_in"`
+}
+type TOTPConfirmRequest struct {
+	Code string `json:"code"`
+}
+type TOTPDisableRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+type StatusChangeRequest struct {
+	Reason string `json:"reason"`
+}
+type SetPINRequest struct {
+	PIN string `json:"pin"`
+}
+type ChangePINRequest struct {
+	OldPIN string `json:"old_pin"`
+	NewPIN string `json:"new_pin"`
+}
+type CardBlockRequest struct {
+	Reason string `json:"reason"`
+	// утеряна или украдена: блокировка навсегда, карту нужно перевыпустить
+	Permanent bool `json:"permanent"`
+}
+type UnlockLoginRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
 type PaymentRequest struct {
-	CardNumber string          `json:"card_number"`
-	Amount     decimal.Decimal `json:"amount"`
-	Merchant   string          `json:"merchant"`
+	CardNumber string `json:"card_number"`
+	Expiry     string `json:"expiry"` // MM/YY, как на карте
+	CVV        string `json:"cvv"`
+	// оплата с карты в руках (терминал, банкомат): вместо CVV — PIN
+	CardPresent bool            `json:"card_present"`
+	PIN         string          `json:"pin,omitempty"`
+	Amount      decimal.Decimal `json:"amount"`
+	Merchant    string          `json:"merchant"`
+	// код категории мерчанта (ISO 18245) и страна мерчанта (ISO 3166, RU по умолчанию)
+	MCC     string `json:"mcc"`
+	Country string `json:"country"`
 }
+
+// получатель задаётся ровно одним из to_*: id или номером счёта,
+// именем пользователя или подтверждённым телефоном
 type TransferRequest struct {
+	FromAccountID   uuid.UUID       `json:"from_account_id"`
+	ToAccountID     uuid.UUID       `json:"to_account_id"`
+	ToAccountNumber string          `json:"to_account_number,omitempty"`
+	ToUsername      string          `json:"to_username,omitempty"`
+	ToPhone         string          `json:"to_phone,omitempty"`
+	Amount          decimal.Decimal `json:"amount"`
+}
+
+// что увидит клиент перед подтверждением перевода
+type TransferPreview struct {
+	RecipientName string           `json:"recipient_name"`
+	AccountNumber string           `json:"account_number"`
+	Currency      string           `json:"currency"`
+	Amount        decimal.Decimal  `json:"amount"`
+	FromCurrency  string           `json:"from_currency"`
+	ToAmount      *decimal.Decimal `json:"to_amount,omitempty"`
+	FXRate        *decimal.Decimal `json:"fx_rate,omitempty"`
+}
+type PhoneRequest struct {
+	Phone string `json:"phone"`
+}
+type PhoneConfirmRequest struct {
+	Code string `json:"code"`
+}
+type DefaultAccountRequest struct {
+	AccountID uuid.UUID `json:"account_id"`
+}
+type CreateAccountRequest struct {
+	Currency string `json:"currency"` // по умолчанию RUB
+	Product  string `json:"product"`  // по умолчанию current
+	// только для срочного вклада
+	TermMonths int  `json:"term_months,omitempty"`
+	Capitalize bool `json:"capitalize,omitempty"`
+}
+type CloseAccountRequest struct {
+	// куда перевести остаток; не нужен, если на счёте ноль
+	ToAccountID *uuid.UUID `json:"to_account_id,omitempty"`
+	Reason      string     `json:"reason"`
+}
+type TerminateDepositRequest struct {
+	ToAccountID uuid.UUID `json:"to_account_id"`
+}
+type SetProductRateRequest struct {
+	Currency    string           `json:"currency"`
+	AnnualRate  decimal.Decimal  `json:"annual_rate"`
+	PenaltyRate *decimal.Decimal `json:"penalty_rate,omitempty"`
+}
+type StandingOrderRequest struct {
 	FromAccountID uuid.UUID       `json:"from_account_id"`
 	ToAccountID   uuid.UUID       `json:"to_account_id"`
 	Amount        decimal.Decimal `json:"amount"`
+	Note          string          `json:"note"`
+	Rule          string          `json:"rule"`
+	DayOfMonth    *int            `json:"day_of_month,omitempty"`
+	Weekday       *int            `json:"weekday,omitempty"`
+	Cron          string          `json:"cron,omitempty"`
+	StartDate     string          `json:"start_date"` // 2006-01-02; по умолчанию сегодня
+	EndDate       string          `json:"end_date,omitempty"`
+	MaxRuns       *int            `json:"max_runs,omitempty"`
 }
 type DepositRequest struct {
 	ToAccountID uuid.UUID       `json:"to_account_id"`
 	Amount      decimal.Decimal `json:"amount"`
 }
+type GrantAccessRequest struct {
+	Level string `json:"level"`
+}
 type ApplyCreditRequest struct {
 	AccountID  uuid.UUID       `json:"account_id"`
 	Principal  decimal.Decimal `json:"principal"`
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type AccessRepo struct {
+	db *sqlx.DB
+}
+
+func NewAccessRepo(db *sqlx.DB) *AccessRepo {
+	return &AccessRepo{db}
+}
+
+// выдать или изменить доступ
+func (r *AccessRepo) Grant(a *models.AccountAccess) error {
+	_, err := r.db.NamedExec(`
+        INSERT INTO account_access (account_id, user_id, level, granted_by)
+        VALUES (:account_id, :user_id, :level, :granted_by)
+        ON CONFLICT (account_id, user_id)
+        DO UPDATE SET level = EXCLUDED.level, granted_by = EXCLUDED.granted_by
+    `, a)
+	return err
+}
+
+func (r *AccessRepo) Revoke(accountID, userID uuid.UUID) error {
+	_, err := r.db.Exec(`
+        DELETE FROM account_access WHERE account_id=$1 AND user_id=$2
+    `, accountID, userID)
+	return err
+}
+
+// уровень доступа userID к счёту; sql.ErrNoRows — доступа нет
+func (r *AccessRepo) GetLevel(accountID, userID uuid.UUID) (string, error) {
+	var level string
+	err := r.db.Get(&level, `
+        SELECT level FROM account_access WHERE account_id=$1 AND user_id=$2
+    `, accountID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", sql.ErrNoRows
+	}
+	return level, err
+}
+
+func (r *AccessRepo) GetByAccountID(accountID uuid.UUID) ([]models.AccountAccess, error) {
+	var list []models.AccountAccess
+	err := r.db.Select(&list, `
+        SELECT account_id, user_id, level, granted_by, created_at
+        FROM account_access WHERE account_id=$1
+    `, accountID)
+	return list, err
+}
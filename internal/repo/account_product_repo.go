@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type AccountProductRepo struct {
+	db *sqlx.DB
+}
+
+func NewAccountProductRepo(db *sqlx.DB) *AccountProductRepo {
+	return &AccountProductRepo{db}
+}
+
+func (r *AccountProductRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+func (r *AccountProductRepo) List() ([]models.AccountProduct, error) {
+	list := []models.AccountProduct{}
+	err := r.db.Select(&list, `
+        SELECT code, currency, annual_rate, penalty_rate, min_term_months, max_term_months, updated_at
+        FROM account_products ORDER BY code, currency
+    `)
+	return list, err
+}
+
+func (r *AccountProductRepo) Get(code, currency string) (*models.AccountProduct, error) {
+	var p models.AccountProduct
+	err := r.db.Get(&p, `
+        SELECT code, currency, annual_rate, penalty_rate, min_term_months, max_term_months, updated_at
+        FROM account_products WHERE code=$1 AND currency=$2
+    `, code, currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &p, err
+}
+
+func (r *AccountProductRepo) GetForUpdateTx(tx TxContext, code, currency string) (*models.AccountProduct, error) {
+	var p models.AccountProduct
+	err := tx.Get(&p, `
+        SELECT code, currency, annual_rate, penalty_rate, min_term_months, max_term_months, updated_at
+        FROM account_products WHERE code=$1 AND currency=$2
+        FOR UPDATE
+    `, code, currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &p, err
+}
+
+// новые ставки действуют для накопительных счетов со следующего начисления;
+// открытые вклады их не замечают
+func (r *AccountProductRepo) SetRatesTx(tx TxContext, p *models.AccountProduct) error {
+	return tx.Get(&p.UpdatedAt, `
+        UPDATE account_products SET annual_rate=$3, penalty_rate=$4, updated_at=NOW()
+        WHERE code=$1 AND currency=$2
+        RETURNING updated_at
+    `, p.Code, p.Currency, p.AnnualRate, p.PenaltyRate)
+}
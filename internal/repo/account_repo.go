@@ -3,11 +3,12 @@ package repo
 import (
 	"database/sql"
 	"errors"
-	"github.com/shopspring/decimal"
+	"sort"
 
 	"bankapp/internal/models"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type AccountRepo struct {
@@ -18,11 +19,28 @@ func NewAccountRepo(db *sqlx.DB) *AccountRepo {
 	return &AccountRepo{db}
 }
 
+const accountColumns = `id, user_id, number, balance, currency, status, created_at, status_reason, closed_at,
+               product, interest_rate, penalty_rate, capitalize, term_months, matures_on,
+               accrued, accrued_posted, interest_paid, accrued_through`
+
 func (r *AccountRepo) Create(a *models.Account) error {
 	a.ID = uuid.New()
 	_, err := r.db.NamedExec(`
-        INSERT INTO accounts (id, user_id, number, balance)
-        VALUES (:id, :user_id, :number, :balance)
+        INSERT INTO accounts (id, user_id, number, balance, currency, product, interest_rate,
+                              penalty_rate, capitalize, term_months, matures_on, accrued_through)
+        VALUES (:id, :user_id, :number, :balance, :currency, :product, :interest_rate,
+                :penalty_rate, :capitalize, :term_months, :matures_on, :accrued_through)
+    `, a)
+	return err
+}
+
+func (r *AccountRepo) CreateTx(tx TxContext, a *models.Account) error {
+	a.ID = uuid.New()
+	_, err := tx.NamedExec(`
+        INSERT INTO accounts (id, user_id, number, balance, currency, product, interest_rate,
+                              penalty_rate, capitalize, term_months, matures_on, accrued_through)
+        VALUES (:id, :user_id, :number, :balance, :currency, :product, :interest_rate,
+                :penalty_rate, :capitalize, :term_months, :matures_on, :accrued_through)
     `, a)
 	return err
 }
@@ -30,7 +48,7 @@ func (r *AccountRepo) Create(a *models.Account) error {
 func (r *AccountRepo) GetByUserID(userID uuid.UUID) ([]models.Account, error) {
 	var list []models.Account
 	err := r.db.Select(&list, `
-        SELECT id, user_id, number, balance, created_at
+        SELECT `+accountColumns+`
         FROM accounts WHERE user_id=$1
     `, userID)
 	return list, err
@@ -39,7 +57,7 @@ func (r *AccountRepo) GetByUserID(userID uuid.UUID) ([]models.Account, error) {
 func (r *AccountRepo) GetByID(id uuid.UUID) (*models.Account, error) {
 	var a models.Account
 	err := r.db.Get(&a, `
-        SELECT id, user_id, number, balance, created_at
+        SELECT `+accountColumns+`
         FROM accounts WHERE id=$1
     `, id)
 	if errors.Is(err, sql.ErrNoRows) {
@@ -48,23 +66,140 @@ func (r *AccountRepo) GetByID(id uuid.UUID) (*models.Account, error) {
 	return &a, err
 }
 
+func (r *AccountRepo) GetByNumber(number string) (*models.Account, error) {
+	var a models.Account
+	err := r.db.Get(&a, `
+        SELECT `+accountColumns+`
+        FROM accounts WHERE number=$1 AND system_code IS NULL
+    `, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &a, err
+}
+
+// самый старый активный расчётный счёт пользователя в валюте
+func (r *AccountRepo) FirstActive(userID uuid.UUID, currency string) (*models.Account, error) {
+	var a models.Account
+	err := r.db.Get(&a, `
+        SELECT `+accountColumns+`
+        FROM accounts
+        WHERE user_id=$1 AND currency=$2 AND status='active' AND product='current'
+        ORDER BY created_at, id
+        LIMIT 1
+    `, userID, currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &a, err
+}
+
 func (r *AccountRepo) WithTx(fn func(TxContext) error) error {
-	tx, err := r.db.Beginx()
-	if err != nil {
-		return err
+	return withTx(r.db, fn)
+}
+
+// читает счёт внутри транзакции и блокирует строку до её конца
+func (r *AccountRepo) GetByIDForUpdateTx(tx TxContext, id uuid.UUID) (*models.Account, error) {
+	var a models.Account
+	err := tx.Get(&a, `
+        SELECT `+accountColumns+`
+        FROM accounts WHERE id=$1
+        FOR UPDATE
+    `, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
 	}
-	ctx := tx.(TxContext)
-	if err := fn(ctx); err != nil {
-		tx.Rollback()
-		return err
+	return &a, err
+}
+
+// блокирует несколько счетов всегда в порядке возрастания id,
+// чтобы встречные переводы A->B и B->A не ловили дедлок
+func (r *AccountRepo) LockTx(tx TxContext, ids ...uuid.UUID) (map[uuid.UUID]*models.Account, error) {
+	sorted := append([]uuid.UUID(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	res := make(map[uuid.UUID]*models.Account, len(sorted))
+	for _, id := range sorted {
+		if _, ok := res[id]; ok {
+			continue
+		}
+		a, err := r.GetByIDForUpdateTx(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		res[id] = a
 	}
-	return tx.Commit()
+	return res, nil
 }
 
-// обновление баланса
-func (r *AccountRepo) UpdateBalanceTx(tx TxContext, id uuid.UUID, newBalance decimal.Decimal) error {
+// смена статуса с причиной; при закрытии фиксируется дата
+func (r *AccountRepo) SetStatusTx(tx TxContext, id uuid.UUID, status, reason string) error {
 	_, err := tx.Exec(`
-        UPDATE accounts SET balance=$2 WHERE id=$1
-    `, id, newBalance)
+        UPDATE accounts
+        SET status=$2, status_reason=$3,
+            closed_at = CASE WHEN $4 THEN NOW() ELSE closed_at END
+        WHERE id=$1
+    `, id, status, reason, status == models.AccountClosed)
+	return err
+}
+
+// валюты счетов по id — для проверки проводки по каждой валюте
+func (r *AccountRepo) CurrenciesTx(tx TxContext, ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	var rows []struct {
+		ID       uuid.UUID `db:"id"`
+		Currency string    `db:"currency"`
+	}
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
+	}
+	if err := tx.Select(&rows, `
+        SELECT id, currency FROM accounts WHERE id = ANY($1::uuid[])
+    `, pq.Array(strs)); err != nil {
+		return nil, err
+	}
+	res := make(map[uuid.UUID]string, len(rows))
+	for _, row := range rows {
+		res[row.ID] = row.Currency
+	}
+	return res, nil
+}
+
+// какие из счетов клиентские: у системных счетов банка задан system_code
+func (r *AccountRepo) ClientAccountsTx(tx TxContext, ids []uuid.UUID) ([]uuid.UUID, error) {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
+	}
+	var res []uuid.UUID
+	err := tx.Select(&res, `
+        SELECT id FROM accounts WHERE id = ANY($1::uuid[]) AND system_code IS NULL
+    `, pq.Array(strs))
+	return res, err
+}
+
+// процентные счета, по которым ещё есть что начислять: вклад перестаёт
+// начисляться после дня, предшествующего дате окончания; замороженным
+// проценты идут, закрытым — нет
+func (r *AccountRepo) ListInterestBearing() ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Select(&ids, `
+        SELECT id FROM accounts
+        WHERE product <> 'current' AND system_code IS NULL AND status <> 'closed'
+          AND (matures_on IS NULL OR accrued_through IS NULL OR accrued_through < matures_on - 1)
+        ORDER BY id
+    `)
+	return ids, err
+}
+
+// сохраняет состояние начисления процентов и условия вклада
+func (r *AccountRepo) UpdateInterestTx(tx TxContext, a *models.Account) error {
+	_, err := tx.NamedExec(`
+        UPDATE accounts
+        SET accrued=:accrued, accrued_posted=:accrued_posted, interest_paid=:interest_paid,
+            accrued_through=:accrued_through, matures_on=:matures_on
+        WHERE id=:id
+    `, a)
 	return err
 }
@@ -0,0 +1,52 @@
+package repo_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+	"bankapp/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// системность счёта определяется по system_code, а не по виду id:
+// клиентский счёт с id из нулей остаётся клиентским
+func TestClientAccountsTx(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	acc := env.Account(t, u, "0")
+	zeroID := uuid.MustParse("00000000-0000-0000-4" + uuid.NewString()[20:])
+	if _, err := env.DB.Exec(`
+        INSERT INTO accounts (id, user_id, number) VALUES ($1, $2, $3)
+    `, zeroID, u.ID, fmt.Sprintf("9%015d", rand.Int63n(1e15))); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := repo.NewAccountRepo(env.DB)
+	var got []uuid.UUID
+	err := accounts.WithTx(func(tx repo.TxContext) error {
+		var err error
+		got, err = accounts.ClientAccountsTx(tx, []uuid.UUID{
+			models.SystemCashIn,
+			models.SystemAccount(models.SystemFXPosition, "USD"),
+			acc.ID,
+			zeroID,
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uuid.UUID]bool{acc.ID: true, zeroID: true}
+	if len(got) != len(want) {
+		t.Fatalf("клиентские счета %v, ждали %s и %s", got, acc.ID, zeroID)
+	}
+	for _, id := range got {
+		if !want[id] {
+			t.Errorf("системный счёт %s принят за клиентский", id)
+		}
+	}
+}
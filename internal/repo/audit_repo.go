@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"time"
+
+	"bankapp/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditRepo struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepo(db *sqlx.DB) *AuditRepo {
+	return &AuditRepo{db}
+}
+
+const auditColumns = `id, actor_id, actor_role, action, resource_type, resource_id, ip, user_agent,
+               details, before, after, prev_hash, hash, created_at`
+
+func (r *AuditRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+// ставит событие в очередь audit_outbox в транзакции действия. Голову
+// цепочки не блокирует: хеш посчитает SealPending после коммита
+func (r *AuditRepo) CreateTx(tx TxContext, e *models.AuditEvent) error {
+	// Postgres хранит микросекунды — округляем заранее, иначе хеш не сойдётся
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	_, err := tx.Exec(`
+        INSERT INTO audit_outbox (actor_id, actor_role, action, resource_type, resource_id, ip, user_agent,
+                                  details, before, after, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+    `, e.ActorID, e.ActorRole, e.Action, e.ResourceType, e.ResourceID, e.IP, e.UserAgent,
+		[]byte(e.Details), nullJSON(e.Before), nullJSON(e.After), e.CreatedAt)
+	return err
+}
+
+// переносит до limit событий из очереди в конец цепочки, в порядке очереди.
+// Голова блокируется FOR UPDATE только здесь, так что дописывает цепочку
+// один прогон за раз. Возвращает число перенесённых событий
+func (r *AuditRepo) SealPending(limit int) (int, error) {
+	var n int
+	err := withTx(r.db, func(tx TxContext) error {
+		var prev string
+		if err := tx.Get(&prev, `SELECT last_hash FROM audit_chain_head FOR UPDATE`); err != nil {
+			return err
+		}
+		var queue []models.AuditEvent
+		if err := tx.Select(&queue, `
+            SELECT id, actor_id, actor_role, action, resource_type, resource_id, ip, user_agent,
+                   details, before, after, created_at
+            FROM audit_outbox
+            ORDER BY id
+            LIMIT $1
+        `, limit); err != nil {
+			return err
+		}
+		for i := range queue {
+			e := &queue[i]
+			outboxID := e.ID
+			if err := tx.Get(&e.ID, `SELECT nextval(pg_get_serial_sequence('audit_events', 'id'))`); err != nil {
+				return err
+			}
+			e.CreatedAt = e.CreatedAt.UTC()
+			hash, err := e.ChainHash(prev)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`
+                INSERT INTO audit_events (id, actor_id, actor_role, action, resource_type, resource_id, ip, user_agent,
+                                          details, before, after, prev_hash, hash, created_at)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+            `, e.ID, e.ActorID, e.ActorRole, e.Action, e.ResourceType, e.ResourceID, e.IP, e.UserAgent,
+				[]byte(e.Details), nullJSON(e.Before), nullJSON(e.After), prev, hash, e.CreatedAt); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`DELETE FROM audit_outbox WHERE id=$1`, outboxID); err != nil {
+				return err
+			}
+			prev = hash
+		}
+		if n = len(queue); n == 0 {
+			return nil
+		}
+		_, err := tx.Exec(`UPDATE audit_chain_head SET last_id=$1, last_hash=$2`, queue[n-1].ID, prev)
+		return err
+	})
+	return n, err
+}
+
+// событий в очереди, ещё не попавших в цепочку
+func (r *AuditRepo) Pending() (int, error) {
+	var n int
+	err := r.db.Get(&n, `SELECT COUNT(*) FROM audit_outbox`)
+	return n, err
+}
+
+// последние события, от новых к старым; beforeID > 0 — продолжение списка
+func (r *AuditRepo) List(beforeID int64, limit int) ([]models.AuditEvent, error) {
+	list := []models.AuditEvent{}
+	err := r.db.Select(&list, `
+        SELECT `+auditColumns+`
+        FROM audit_events
+        WHERE $1 = 0 OR id < $1
+        ORDER BY id DESC
+        LIMIT $2
+    `, beforeID, limit)
+	return list, err
+}
+
+// события по возрастанию id — для проверки цепочки
+func (r *AuditRepo) ListAfter(afterID int64, limit int) ([]models.AuditEvent, error) {
+	var list []models.AuditEvent
+	err := r.db.Select(&list, `
+        SELECT `+auditColumns+`
+        FROM audit_events
+        WHERE id > $1
+        ORDER BY id
+        LIMIT $2
+    `, afterID, limit)
+	return list, err
+}
+
+func (r *AuditRepo) Head() (lastID int64, lastHash string, err error) {
+	var head struct {
+		LastID   int64  `db:"last_id"`
+		LastHash string `db:"last_hash"`
+	}
+	err = r.db.Get(&head, `SELECT last_id, last_hash FROM audit_chain_head`)
+	return head.LastID, head.LastHash, err
+}
+
+// пустое значение пишем как SQL NULL, а не как пустую строку
+func nullJSON(raw []byte) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
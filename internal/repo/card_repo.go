@@ -1,9 +1,15 @@
 package repo
 
 import (
+	"database/sql"
+	"errors"
+	"time"
+
 	"bankapp/internal/models"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
 type CardRepo struct {
@@ -14,11 +20,24 @@ func NewCardRepo(db *sqlx.DB) *CardRepo {
 	return &CardRepo{db}
 }
 
+const cardColumns = `id, account_id, number_enc, expiry_enc, cvv_hash, hmac, status, created_at,
+               blocked_by, status_reason, expires_on, reissued_from, cvv_failures, masked_pan,
+               pin_offset, pin_failures, pin_offset IS NOT NULL AS pin_set`
+
 func (r *CardRepo) Create(c *models.Card) error {
 	c.ID = uuid.New()
 	_, err := r.db.NamedExec(`
-        INSERT INTO cards (id, account_id, number_enc, expiry_enc, cvv_hash, hmac)
-        VALUES (:id, :account_id, :number_enc, :expiry_enc, :cvv_hash, :hmac)
+        INSERT INTO cards (id, account_id, number_enc, expiry_enc, cvv_hash, hmac, expires_on, reissued_from, masked_pan)
+        VALUES (:id, :account_id, :number_enc, :expiry_enc, :cvv_hash, :hmac, :expires_on, :reissued_from, :masked_pan)
+    `, c)
+	return err
+}
+
+func (r *CardRepo) CreateTx(tx TxContext, c *models.Card) error {
+	c.ID = uuid.New()
+	_, err := tx.NamedExec(`
+        INSERT INTO cards (id, account_id, number_enc, expiry_enc, cvv_hash, hmac, expires_on, reissued_from, masked_pan)
+        VALUES (:id, :account_id, :number_enc, :expiry_enc, :cvv_hash, :hmac, :expires_on, :reissued_from, :masked_pan)
     `, c)
 	return err
 }
@@ -26,7 +45,7 @@ func (r *CardRepo) Create(c *models.Card) error {
 func (r *CardRepo) GetByAccountID(accountID uuid.UUID) ([]models.Card, error) {
 	var list []models.Card
 	err := r.db.Select(&list, `
-        SELECT id, account_id, number_enc, expiry_enc, cvv_hash, hmac, created_at
+        SELECT `+cardColumns+`
         FROM cards WHERE account_id=$1
     `, accountID)
 	return list, err
@@ -35,7 +54,7 @@ func (r *CardRepo) GetByAccountID(accountID uuid.UUID) ([]models.Card, error) {
 func (r *CardRepo) GetByHMAC(hmacHex string) (*models.Card, error) {
 	var c models.Card
 	err := r.db.Get(&c, `
-        SELECT id, account_id, number_enc, expiry_enc, cvv_hash, hmac, created_at
+        SELECT `+cardColumns+`
         FROM cards WHERE hmac=$1
     `, hmacHex)
 	if err != nil {
@@ -43,3 +62,219 @@ func (r *CardRepo) GetByHMAC(hmacHex string) (*models.Card, error) {
 	}
 	return &c, nil
 }
+
+func (r *CardRepo) GetByIDForUpdateTx(tx TxContext, id uuid.UUID) (*models.Card, error) {
+	var c models.Card
+	err := tx.Get(&c, `
+        SELECT `+cardColumns+`
+        FROM cards WHERE id=$1
+        FOR UPDATE
+    `, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &c, err
+}
+
+func (r *CardRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+// смена статуса; blockedBy заполняется только для временной блокировки
+func (r *CardRepo) SetStatusTx(tx TxContext, c *models.Card) error {
+	_, err := tx.Exec(`
+        UPDATE cards SET status=$2, blocked_by=$3, status_reason=$4, cvv_failures=$5, pin_failures=$6
+        WHERE id=$1
+    `, c.ID, c.Status, c.BlockedBy, c.StatusReason, c.CVVFailures, c.PINFailures)
+	return err
+}
+
+// +1 неудачная проверка реквизитов; возвращает счётчик после увеличения
+func (r *CardRepo) AddCVVFailureTx(tx TxContext, id uuid.UUID) (int, error) {
+	var n int
+	err := tx.Get(&n, `
+        UPDATE cards SET cvv_failures = cvv_failures + 1 WHERE id=$1
+        RETURNING cvv_failures
+    `, id)
+	return n, err
+}
+
+// успешная проверка обнуляет счётчик
+func (r *CardRepo) ResetCVVFailures(id uuid.UUID) error {
+	_, err := r.db.Exec(`UPDATE cards SET cvv_failures=0 WHERE id=$1 AND cvv_failures > 0`, id)
+	return err
+}
+
+func (r *CardRepo) GetByID(id uuid.UUID) (*models.Card, error) {
+	var c models.Card
+	err := r.db.Get(&c, `SELECT `+cardColumns+` FROM cards WHERE id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// закрывает все незакрытые карты счёта, например при его закрытии
+func (r *CardRepo) CloseByAccountTx(tx TxContext, accountID uuid.UUID, reason string) (int64, error) {
+	res, err := tx.Exec(`
+        UPDATE cards SET status='closed', blocked_by=NULL, status_reason=$2
+        WHERE account_id=$1 AND status <> 'closed'
+    `, accountID, reason)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// гасит карты, срок которых закончился до day
+func (r *CardRepo) ExpireBefore(day time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Select(&ids, `
+        UPDATE cards SET status='expired', blocked_by=NULL, status_reason='истёк срок действия'
+        WHERE expires_on < $1 AND status IN ('active', 'temp_blocked')
+        RETURNING id
+    `, day)
+	return ids, err
+}
+
+// карты без маскированного номера — выпущенные до его появления
+func (r *CardRepo) ListWithoutMaskedPAN(limit int) ([]models.Card, error) {
+	var list []models.Card
+	err := r.db.Select(&list, `
+        SELECT `+cardColumns+`
+        FROM cards WHERE masked_pan IS NULL
+        ORDER BY created_at
+        LIMIT $1
+    `, limit)
+	return list, err
+}
+
+// новое смещение PIN обнуляет счётчик неверных PIN
+func (r *CardRepo) SetPINOffsetTx(tx TxContext, id uuid.UUID, offset string) error {
+	_, err := tx.Exec(`UPDATE cards SET pin_offset=$2, pin_failures=0 WHERE id=$1`, id, offset)
+	return err
+}
+
+func (r *CardRepo) AddPINFailureTx(tx TxContext, id uuid.UUID) (int, error) {
+	var n int
+	err := tx.Get(&n, `
+        UPDATE cards SET pin_failures = pin_failures + 1 WHERE id=$1
+        RETURNING pin_failures
+    `, id)
+	return n, err
+}
+
+func (r *CardRepo) ResetPINFailures(id uuid.UUID) error {
+	_, err := r.db.Exec(`UPDATE cards SET pin_failures=0 WHERE id=$1 AND pin_failures > 0`, id)
+	return err
+}
+
+// данные, восстановленные расшифровкой или по реквизитам из оплаты:
+// маска, HMAC по номеру и срок
+func (r *CardRepo) SetDecryptedData(c *models.Card) error {
+	_, err := r.db.Exec(`
+        UPDATE cards SET masked_pan=$2, hmac=$3, expires_on=$4
+        WHERE id=$1
+    `, c.ID, c.MaskedPAN, c.HMAC, c.ExpiresOn)
+	return err
+}
+
+// показ реквизитов; повторный jti нарушает уникальность — токен уже использован
+func (r *CardRepo) RecordRevealTx(tx TxContext, cardID, userID, jti uuid.UUID) error {
+	_, err := tx.Exec(`
+        INSERT INTO card_reveals (id, card_id, user_id, step_up_jti)
+        VALUES ($1, $2, $3, $4)
+    `, uuid.New(), cardID, userID, jti)
+	return err
+}
+
+func (r *CardRepo) CountRevealsSinceTx(tx TxContext, userID uuid.UUID, since time.Time) (int, error) {
+	var n int
+	err := tx.Get(&n, `SELECT COUNT(*) FROM card_reveals WHERE user_id=$1 AND created_at >= $2`, userID, since)
+	return n, err
+}
+
+// массивы MCC читаются через pq, в модели — обычные срезы
+type cardControlsRow struct {
+	models.CardControls
+	AllowedMCC pq.StringArray `db:"allowed_mcc"`
+	BlockedMCC pq.StringArray `db:"blocked_mcc"`
+}
+
+// ограничения карты; без строки — всё разрешено
+func (r *CardRepo) GetControls(cardID uuid.UUID) (*models.CardControls, error) {
+	return getCardControls(r.db, cardID)
+}
+
+func (r *CardRepo) GetControlsTx(tx TxContext, cardID uuid.UUID) (*models.CardControls, error) {
+	return getCardControls(tx, cardID)
+}
+
+func getCardControls(q TxContext, cardID uuid.UUID) (*models.CardControls, error) {
+	var row cardControlsRow
+	err := q.Get(&row, `
+        SELECT card_id, per_tx_limit, daily_limit, monthly_limit, allowed_mcc, blocked_mcc,
+               online_enabled, foreign_enabled, updated_at
+        FROM card_controls WHERE card_id=$1
+    `, cardID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.CardControls{CardID: cardID, OnlineEnabled: true, ForeignEnabled: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := row.CardControls
+	c.AllowedMCC, c.BlockedMCC = []string(row.AllowedMCC), []string(row.BlockedMCC)
+	return &c, nil
+}
+
+func (r *CardRepo) UpsertControlsTx(tx TxContext, c *models.CardControls) error {
+	return tx.Get(&c.UpdatedAt, `
+        INSERT INTO card_controls (card_id, per_tx_limit, daily_limit, monthly_limit, allowed_mcc, blocked_mcc,
+                                   online_enabled, foreign_enabled, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+        ON CONFLICT (card_id) DO UPDATE
+        SET per_tx_limit=EXCLUDED.per_tx_limit, daily_limit=EXCLUDED.daily_limit,
+            monthly_limit=EXCLUDED.monthly_limit, allowed_mcc=EXCLUDED.allowed_mcc,
+            blocked_mcc=EXCLUDED.blocked_mcc, online_enabled=EXCLUDED.online_enabled,
+            foreign_enabled=EXCLUDED.foreign_enabled, updated_at=NOW()
+        RETURNING updated_at
+    `, c.CardID, c.PerTxLimit, c.DailyLimit, c.MonthlyLimit, pq.Array(c.AllowedMCC), pq.Array(c.BlockedMCC),
+		c.OnlineEnabled, c.ForeignEnabled)
+}
+
+// траты по карте за дни from..to включительно
+func (r *CardRepo) Spent(cardID uuid.UUID, from, to time.Time) (decimal.Decimal, error) {
+	return cardSpent(r.db, cardID, from, to)
+}
+
+func (r *CardRepo) SpentTx(tx TxContext, cardID uuid.UUID, from, to time.Time) (decimal.Decimal, error) {
+	return cardSpent(tx, cardID, from, to)
+}
+
+func cardSpent(q TxContext, cardID uuid.UUID, from, to time.Time) (decimal.Decimal, error) {
+	var sum decimal.Decimal
+	err := q.Get(&sum, `
+        SELECT COALESCE(SUM(amount), 0) FROM card_spend
+        WHERE card_id=$1 AND day BETWEEN $2 AND $3
+    `, cardID, from, to)
+	return sum, err
+}
+
+func (r *CardRepo) AddSpendTx(tx TxContext, cardID uuid.UUID, day time.Time, amount decimal.Decimal) error {
+	_, err := tx.Exec(`
+        INSERT INTO card_spend (card_id, day, amount) VALUES ($1, $2, $3)
+        ON CONFLICT (card_id, day) DO UPDATE SET amount = card_spend.amount + EXCLUDED.amount
+    `, cardID, day, amount)
+	return err
+}
+
+// перенос трат на перевыпущенную карту: лимиты считаются по всей цепочке
+func (r *CardRepo) CopySpendTx(tx TxContext, fromCardID, toCardID uuid.UUID) error {
+	_, err := tx.Exec(`
+        INSERT INTO card_spend (card_id, day, amount)
+        SELECT $2, day, amount FROM card_spend WHERE card_id=$1
+        ON CONFLICT (card_id, day) DO UPDATE SET amount = card_spend.amount + EXCLUDED.amount
+    `, fromCardID, toCardID)
+	return err
+}
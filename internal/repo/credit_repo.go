@@ -18,9 +18,9 @@ func (r *CreditRepo) Create(c *models.Credit) error {
 	c.ID = uuid.New()
 	_, err := r.db.NamedExec(`
         INSERT INTO credits
-          (id, user_id, account_id, principal, annual_rate, term_months, start_at, remaining)
+          (id, user_id, account_id, principal, currency, annual_rate, rate_source, rate_date, term_months, start_at, remaining)
         VALUES
-          (:id, :user_id, :account_id, :principal, :annual_rate, :term_months, :start_at, :remaining)
+          (:id, :user_id, :account_id, :principal, :currency, :annual_rate, :rate_source, :rate_date, :term_months, :start_at, :remaining)
     `, c)
 	return err
 }
@@ -28,7 +28,7 @@ func (r *CreditRepo) Create(c *models.Credit) error {
 func (r *CreditRepo) GetByUserID(userID uuid.UUID) ([]models.Credit, error) {
 	var list []models.Credit
 	err := r.db.Select(&list, `
-        SELECT id, user_id, account_id, principal, annual_rate, term_months, start_at, remaining, created_at
+        SELECT id, user_id, account_id, principal, currency, annual_rate, rate_source, rate_date, term_months, start_at, remaining, created_at
         FROM credits WHERE user_id=$1
     `, userID)
 	return list, err
@@ -37,32 +37,36 @@ func (r *CreditRepo) GetByUserID(userID uuid.UUID) ([]models.Credit, error) {
 func (r *CreditRepo) GetByID(id uuid.UUID) (*models.Credit, error) {
 	var c models.Credit
 	err := r.db.Get(&c, `
-        SELECT id, user_id, account_id, principal, annual_rate, term_months, start_at, remaining, created_at
+        SELECT id, user_id, account_id, principal, currency, annual_rate, rate_source, rate_date, term_months, start_at, remaining, created_at
         FROM credits WHERE id=$1
     `, id)
 	return &c, err
 }
 
 func (r *CreditRepo) WithTx(fn func(TxContext) error) error {
-	tx, err := r.db.Beginx()
-	if err != nil {
-		return err
-	}
-	ctx := tx.(TxContext)
-	if err := fn(ctx); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
+	return withTx(r.db, fn)
 }
 
 func (r *CreditRepo) CreateTx(tx TxContext, c *models.Credit) error {
 	c.ID = uuid.New()
 	_, err := tx.NamedExec(`
         INSERT INTO credits
-          (id, user_id, account_id, principal, annual_rate, term_months, start_at, remaining)
+          (id, user_id, account_id, principal, currency, annual_rate, rate_source, rate_date, term_months, start_at, remaining)
         VALUES
-          (:id, :user_id, :account_id, :principal, :annual_rate, :term_months, :start_at, :remaining)
+          (:id, :user_id, :account_id, :principal, :currency, :annual_rate, :rate_source, :rate_date, :term_months, :start_at, :remaining)
     `, c)
 	return err
 }
+
+// есть ли по счёту кредит с неоплаченными платежами
+func (r *CreditRepo) HasActiveTx(tx TxContext, accountID uuid.UUID) (bool, error) {
+	var active bool
+	err := tx.Get(&active, `
+        SELECT EXISTS (
+            SELECT 1 FROM credits c
+            JOIN payment_schedules s ON s.credit_id = c.id
+            WHERE c.account_id=$1 AND NOT s.paid
+        )
+    `, accountID)
+	return active, err
+}
@@ -1,13 +1,16 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"bankapp/internal/config"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func NewDB(cfg *config.Config) *sqlx.DB {
@@ -35,3 +38,68 @@ type sqlxExt interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	NamedExec(query string, arg interface{}) (sql.Result, error)
 }
+
+// сколько раз повторяем транзакцию при конфликте сериализации или дедлоке.
+// Под нагрузкой конфликтуют все операции через общие строки (системные
+// счета, голова цепочки аудита), поэтому попыток много, а пауза растёт
+const (
+	maxTxAttempts  = 10
+	txBackoffBase  = 5 * time.Millisecond
+	txBackoffLimit = 500 * time.Millisecond
+)
+
+// выполняет fn в SERIALIZABLE-транзакции и повторяет её целиком,
+// если Postgres откатил её из-за конфликта. fn должна быть идемпотентной:
+// всё состояние создаётся внутри неё.
+func withTx(db *sqlx.DB, fn func(TxContext) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = runTx(db, fn)
+		if !isRetryable(err) {
+			return err
+		}
+		if attempt < maxTxAttempts {
+			time.Sleep(txBackoff(attempt))
+		}
+	}
+	return err
+}
+
+// экспоненциальная пауза со случайным разбросом в [d/2, d), чтобы
+// конкуренты, откатившиеся вместе, не сталкивались снова
+func txBackoff(attempt int) time.Duration {
+	d := txBackoffLimit
+	if attempt < 20 {
+		if exp := txBackoffBase << (attempt - 1); exp < d {
+			d = exp
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+func runTx(db *sqlx.DB, fn func(TxContext) error) error {
+	tx, err := db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 23505 unique_violation
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// 40001 serialization_failure, 40P01 deadlock_detected
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
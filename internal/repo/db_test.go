@@ -0,0 +1,25 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTxBackoff(t *testing.T) {
+	cases := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, txBackoffBase / 2, txBackoffBase},
+		{3, 2 * txBackoffBase, 4 * txBackoffBase},
+		{9, txBackoffLimit / 2, txBackoffLimit},
+		{64, txBackoffLimit / 2, txBackoffLimit},
+	}
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			if d := txBackoff(c.attempt); d < c.min || d >= c.max {
+				t.Fatalf("попытка %d: пауза %s вне [%s, %s)", c.attempt, d, c.min, c.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"bankapp/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type FXRateRepo struct {
+	db *sqlx.DB
+}
+
+func NewFXRateRepo(db *sqlx.DB) *FXRateRepo {
+	return &FXRateRepo{db}
+}
+
+func (r *FXRateRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+// сохраняет ответ ЦБ на день day: курсы с датой установления rateDate
+// и отметку, что день загружен. Повторная загрузка перезаписывает курсы
+func (r *FXRateRepo) SaveDayTx(tx TxContext, day, rateDate time.Time, rates []models.FXRate) error {
+	for i := range rates {
+		if _, err := tx.NamedExec(`
+            INSERT INTO fx_rates (rate_date, currency, num_code, name, nominal, value, rate)
+            VALUES (:rate_date, :currency, :num_code, :name, :nominal, :value, :rate)
+            ON CONFLICT (rate_date, currency) DO UPDATE
+            SET num_code=EXCLUDED.num_code, name=EXCLUDED.name, nominal=EXCLUDED.nominal,
+                value=EXCLUDED.value, rate=EXCLUDED.rate, fetched_at=NOW()
+        `, &rates[i]); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+        INSERT INTO fx_rate_days (day, rate_date) VALUES ($1, $2)
+        ON CONFLICT (day) DO UPDATE SET rate_date=EXCLUDED.rate_date, fetched_at=NOW()
+    `, day, rateDate)
+	return err
+}
+
+// дни из [from, to], за которые курсы ещё не загружались
+func (r *FXRateRepo) MissingDays(from, to time.Time) ([]time.Time, error) {
+	var days []time.Time
+	err := r.db.Select(&days, `
+        SELECT d::date
+        FROM generate_series($1::date, $2::date, interval '1 day') AS d
+        WHERE NOT EXISTS (SELECT 1 FROM fx_rate_days WHERE day = d::date)
+        ORDER BY 1
+    `, from, to)
+	return days, err
+}
+
+// дата установления курсов, действующих в день day; sql.ErrNoRows — день не загружен
+func (r *FXRateRepo) RateDateFor(day time.Time) (time.Time, error) {
+	var d time.Time
+	err := r.db.Get(&d, `SELECT rate_date FROM fx_rate_days WHERE day=$1`, day)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return d, err
+}
+
+func (r *FXRateRepo) ListOn(rateDate time.Time) ([]models.FXRate, error) {
+	list := []models.FXRate{}
+	err := r.db.Select(&list, `
+        SELECT rate_date, currency, num_code, name, nominal, value, rate
+        FROM fx_rates WHERE rate_date=$1
+        ORDER BY currency
+    `, rateDate)
+	return list, err
+}
+
+// курс валюты, действующий в день day
+func (r *FXRateRepo) GetOn(day time.Time, currency string) (*models.FXRate, error) {
+	var rate models.FXRate
+	err := r.db.Get(&rate, `
+        SELECT f.rate_date, f.currency, f.num_code, f.name, f.nominal, f.value, f.rate
+        FROM fx_rate_days d
+        JOIN fx_rates f ON f.rate_date = d.rate_date
+        WHERE d.day=$1 AND f.currency=$2
+    `, day, currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &rate, err
+}
@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type IdempotencyRepo struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepo(db *sqlx.DB) *IdempotencyRepo {
+	return &IdempotencyRepo{db}
+}
+
+// сохранённый ответ по ключу; блокирует строку до конца транзакции
+func (r *IdempotencyRepo) GetForUpdateTx(tx TxContext, userID uuid.UUID, key string) (*models.IdempotencyRecord, error) {
+	var rec models.IdempotencyRecord
+	err := tx.Get(&rec, `
+        SELECT user_id, key, fingerprint, response, created_at, expires_at
+        FROM idempotency_keys WHERE user_id=$1 AND key=$2
+        FOR UPDATE
+    `, userID, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &rec, err
+}
+
+func (r *IdempotencyRepo) CreateTx(tx TxContext, rec *models.IdempotencyRecord) error {
+	_, err := tx.NamedExec(`
+        INSERT INTO idempotency_keys (user_id, key, fingerprint, response, expires_at)
+        VALUES (:user_id, :key, :fingerprint, :response, :expires_at)
+    `, rec)
+	return err
+}
+
+func (r *IdempotencyRepo) DeleteTx(tx TxContext, userID uuid.UUID, key string) error {
+	_, err := tx.Exec(`
+        DELETE FROM idempotency_keys WHERE user_id=$1 AND key=$2
+    `, userID, key)
+	return err
+}
+
+// чистка просроченных ключей (шедулер)
+func (r *IdempotencyRepo) DeleteExpired() (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"sort"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+type LedgerRepo struct {
+	db *sqlx.DB
+}
+
+func NewLedgerRepo(db *sqlx.DB) *LedgerRepo {
+	return &LedgerRepo{db}
+}
+
+// записывает проводку и двигает кешированные остатки счетов.
+// Сбалансированность проверяет вызывающий (BankService.post).
+func (r *LedgerRepo) CreateEntryTx(tx TxContext, e *models.JournalEntry) error {
+	e.ID = uuid.New()
+	_, err := tx.NamedExec(`
+        INSERT INTO journal_entries (id, transaction_id, description)
+        VALUES (:id, :transaction_id, :description)
+    `, e)
+	if err != nil {
+		return err
+	}
+	deltas := make(map[uuid.UUID]decimal.Decimal)
+	for i := range e.Postings {
+		p := &e.Postings[i]
+		p.ID = uuid.New()
+		p.EntryID = e.ID
+		if _, err := tx.NamedExec(`
+            INSERT INTO postings (id, entry_id, account_id, direction, amount)
+            VALUES (:id, :entry_id, :account_id, :direction, :amount)
+        `, p); err != nil {
+			return err
+		}
+		delta := p.Amount
+		if p.Direction == models.PostingDebit {
+			delta = delta.Neg()
+		}
+		deltas[p.AccountID] = deltas[p.AccountID].Add(delta)
+	}
+	// остатки двигаем в порядке id — тот же порядок блокировок, что в AccountRepo.LockTx
+	ids := make([]uuid.UUID, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	for _, id := range ids {
+		if _, err := tx.Exec(`
+            UPDATE accounts SET balance = balance + $2 WHERE id=$1
+        `, id, deltas[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// остаток счёта, посчитанный по проводкам
+func (r *LedgerRepo) PostedBalance(accountID uuid.UUID) (decimal.Decimal, error) {
+	var bal decimal.Decimal
+	err := r.db.Get(&bal, `
+        SELECT COALESCE(SUM(CASE WHEN direction='credit' THEN amount ELSE -amount END), 0)
+        FROM postings WHERE account_id=$1
+    `, accountID)
+	return bal, err
+}
+
+// счета, у которых accounts.balance не совпадает с суммой проводок
+func (r *LedgerRepo) Mismatches() ([]models.LedgerMismatch, error) {
+	var list []models.LedgerMismatch
+	err := r.db.Select(&list, `
+        SELECT a.id AS account_id, a.balance,
+               COALESCE(SUM(CASE WHEN p.direction='credit' THEN p.amount ELSE -p.amount END), 0) AS posted
+        FROM accounts a
+        LEFT JOIN postings p ON p.account_id = a.id
+        GROUP BY a.id, a.balance
+        HAVING a.balance <> COALESCE(SUM(CASE WHEN p.direction='credit' THEN p.amount ELSE -p.amount END), 0)
+    `)
+	return list, err
+}
+
+// сумма остатков по счетам в каждой валюте; у сбалансированной книги
+// все суммы равны нулю
+func (r *LedgerRepo) TrialBalance() (map[string]decimal.Decimal, error) {
+	var rows []struct {
+		Currency string          `db:"currency"`
+		Total    decimal.Decimal `db:"total"`
+	}
+	if err := r.db.Select(&rows, `
+        SELECT currency, SUM(balance) AS total FROM accounts GROUP BY currency
+    `); err != nil {
+		return nil, err
+	}
+	res := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		res[row.Currency] = row.Total
+	}
+	return res, nil
+}
@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"bankapp/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type LoginAttemptRepo struct {
+	db *sqlx.DB
+}
+
+func NewLoginAttemptRepo(db *sqlx.DB) *LoginAttemptRepo {
+	return &LoginAttemptRepo{db}
+}
+
+// nil без ошибки — неудачных попыток не было
+func (r *LoginAttemptRepo) Get(scope, key string) (*models.LoginAttempt, error) {
+	var a models.LoginAttempt
+	err := r.db.Get(&a, `
+        SELECT scope, key, failures, last_failure_at, locked_until
+        FROM login_attempts WHERE scope=$1 AND key=$2
+    `, scope, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// атомарно учитывает неудачу; счётчик начинается заново, если прошлая
+// неудача старше window. При достижении maxFailures ставит блокировку до
+// lockUntil и обнуляет счётчик; locked=true только у того запроса, который
+// блокировку поставил
+func (r *LoginAttemptRepo) RecordFailure(scope, key string, window time.Duration, maxFailures int, lockUntil time.Time) (a *models.LoginAttempt, locked bool, err error) {
+	err = withTx(r.db, func(tx TxContext) error {
+		a, locked = &models.LoginAttempt{}, false
+		if err := tx.Get(a, `
+            INSERT INTO login_attempts (scope, key, failures, last_failure_at)
+            VALUES ($1, $2, 1, NOW())
+            ON CONFLICT (scope, key) DO UPDATE SET
+                failures = CASE
+                    WHEN login_attempts.last_failure_at < NOW() - $3 * INTERVAL '1 second' THEN 1
+                    ELSE login_attempts.failures + 1
+                END,
+                last_failure_at = NOW()
+            RETURNING scope, key, failures, last_failure_at, locked_until
+        `, scope, key, int64(window/time.Second)); err != nil {
+			return err
+		}
+		if a.Failures < maxFailures {
+			return nil
+		}
+		if _, err := tx.Exec(`
+            UPDATE login_attempts SET failures = 0, locked_until = $3
+            WHERE scope=$1 AND key=$2
+        `, scope, key, lockUntil); err != nil {
+			return err
+		}
+		a.Failures, a.LockedUntil, locked = 0, &lockUntil, true
+		return nil
+	})
+	return a, locked, err
+}
+
+func (r *LoginAttemptRepo) Reset(scope, key string) error {
+	_, err := r.db.Exec(`DELETE FROM login_attempts WHERE scope=$1 AND key=$2`, scope, key)
+	return err
+}
@@ -56,6 +56,21 @@ func (r *ScheduleRepo) GetDueSchedules(before time.Time) ([]models.PaymentSchedu
 	return list, err
 }
 
+// строка графика под блокировкой: параллельный прогон шедулера ждёт
+// и видит уже проставленный paid
+func (r *ScheduleRepo) GetByIDForUpdateTx(tx TxContext, id uuid.UUID) (*models.PaymentSchedule, error) {
+	var s models.PaymentSchedule
+	err := tx.Get(&s, `
+        SELECT id, credit_id, due_date, amount, principal, interest, paid
+        FROM payment_schedules WHERE id=$1
+        FOR UPDATE
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
 func (r *ScheduleRepo) UpdatePaidTx(tx TxContext, id uuid.UUID, paid bool) error {
 	_, err := tx.Exec(`
         UPDATE payment_schedules
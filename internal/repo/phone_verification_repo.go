@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type PhoneVerificationRepo struct {
+	db *sqlx.DB
+}
+
+func NewPhoneVerificationRepo(db *sqlx.DB) *PhoneVerificationRepo {
+	return &PhoneVerificationRepo{db}
+}
+
+func (r *PhoneVerificationRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+func (r *PhoneVerificationRepo) Get(userID uuid.UUID) (*models.PhoneVerification, error) {
+	var v models.PhoneVerification
+	err := r.db.Get(&v, `
+        SELECT user_id, phone, code_hash, attempts, expires_at, created_at
+        FROM phone_verifications WHERE user_id=$1
+    `, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &v, err
+}
+
+// новый код заменяет прежний вместе со счётчиком попыток
+func (r *PhoneVerificationRepo) Upsert(v *models.PhoneVerification) error {
+	_, err := r.db.NamedExec(`
+        INSERT INTO phone_verifications (user_id, phone, code_hash, attempts, expires_at, created_at)
+        VALUES (:user_id, :phone, :code_hash, 0, :expires_at, NOW())
+        ON CONFLICT (user_id) DO UPDATE
+        SET phone=EXCLUDED.phone, code_hash=EXCLUDED.code_hash, attempts=0,
+            expires_at=EXCLUDED.expires_at, created_at=NOW()
+    `, v)
+	return err
+}
+
+func (r *PhoneVerificationRepo) GetForUpdateTx(tx TxContext, userID uuid.UUID) (*models.PhoneVerification, error) {
+	var v models.PhoneVerification
+	err := tx.Get(&v, `
+        SELECT user_id, phone, code_hash, attempts, expires_at, created_at
+        FROM phone_verifications WHERE user_id=$1
+        FOR UPDATE
+    `, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &v, err
+}
+
+func (r *PhoneVerificationRepo) AddAttemptTx(tx TxContext, userID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE phone_verifications SET attempts = attempts + 1 WHERE user_id=$1`, userID)
+	return err
+}
+
+func (r *PhoneVerificationRepo) DeleteTx(tx TxContext, userID uuid.UUID) error {
+	_, err := tx.Exec(`DELETE FROM phone_verifications WHERE user_id=$1`, userID)
+	return err
+}
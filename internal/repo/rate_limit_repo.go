@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type RateLimitRepo struct {
+	db *sqlx.DB
+}
+
+func NewRateLimitRepo(db *sqlx.DB) *RateLimitRepo {
+	return &RateLimitRepo{db}
+}
+
+// атомарно учитывает запрос и возвращает число запросов в текущем окне
+// вместе с его началом; окно старше window начинается заново
+func (r *RateLimitRepo) Hit(bucket, key string, window time.Duration) (hits int, windowStart time.Time, err error) {
+	var row struct {
+		Hits        int       `db:"hits"`
+		WindowStart time.Time `db:"window_start"`
+	}
+	err = r.db.Get(&row, `
+        INSERT INTO rate_limits (bucket, key, hits, window_start)
+        VALUES ($1, $2, 1, NOW())
+        ON CONFLICT (bucket, key) DO UPDATE SET
+            hits = CASE
+                WHEN rate_limits.window_start < NOW() - $3 * INTERVAL '1 second' THEN 1
+                ELSE rate_limits.hits + 1
+            END,
+            window_start = CASE
+                WHEN rate_limits.window_start < NOW() - $3 * INTERVAL '1 second' THEN NOW()
+                ELSE rate_limits.window_start
+            END
+        RETURNING hits, window_start
+    `, bucket, key, int64(window/time.Second))
+	return row.Hits, row.WindowStart, err
+}
+
+// удаляет счётчики, окна которых давно закончились
+func (r *RateLimitRepo) Purge(olderThan time.Duration) (int64, error) {
+	res, err := r.db.Exec(`
+        DELETE FROM rate_limits WHERE window_start < NOW() - $1 * INTERVAL '1 second'
+    `, int64(olderThan/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
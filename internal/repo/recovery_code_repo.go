@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type RecoveryCodeRepo struct {
+	db *sqlx.DB
+}
+
+func NewRecoveryCodeRepo(db *sqlx.DB) *RecoveryCodeRepo {
+	return &RecoveryCodeRepo{db}
+}
+
+func (r *RecoveryCodeRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+// заменяет все коды пользователя новым набором
+func (r *RecoveryCodeRepo) ReplaceTx(tx TxContext, userID uuid.UUID, hashes []string) error {
+	if err := r.DeleteAllTx(tx, userID); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if _, err := tx.Exec(`
+            INSERT INTO recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)
+        `, uuid.New(), userID, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RecoveryCodeRepo) DeleteAllTx(tx TxContext, userID uuid.UUID) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id=$1`, userID)
+	return err
+}
+
+// гасит код; false — такого неиспользованного кода нет
+func (r *RecoveryCodeRepo) Use(userID uuid.UUID, hash string) (bool, error) {
+	res, err := r.db.Exec(`
+        UPDATE recovery_codes SET used_at = NOW()
+        WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+    `, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
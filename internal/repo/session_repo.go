@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type SessionRepo struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepo(db *sqlx.DB) *SessionRepo {
+	return &SessionRepo{db}
+}
+
+func (r *SessionRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+func (r *SessionRepo) CreateTx(tx TxContext, s *models.Session) error {
+	s.ID = uuid.New()
+	_, err := tx.NamedExec(`
+        INSERT INTO sessions (id, user_id) VALUES (:id, :user_id)
+    `, s)
+	return err
+}
+
+func (r *SessionRepo) GetByID(id uuid.UUID) (*models.Session, error) {
+	var s models.Session
+	err := r.db.Get(&s, `
+        SELECT id, user_id, created_at, revoked_at, revoke_reason
+        FROM sessions WHERE id=$1
+    `, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &s, err
+}
+
+func (r *SessionRepo) GetByIDForUpdateTx(tx TxContext, id uuid.UUID) (*models.Session, error) {
+	var s models.Session
+	err := tx.Get(&s, `
+        SELECT id, user_id, created_at, revoked_at, revoke_reason
+        FROM sessions WHERE id=$1
+        FOR UPDATE
+    `, id)
+	return &s, err
+}
+
+func (r *SessionRepo) RevokeTx(tx TxContext, id uuid.UUID, reason string) error {
+	_, err := tx.Exec(`
+        UPDATE sessions SET revoked_at = NOW(), revoke_reason = $2
+        WHERE id=$1 AND revoked_at IS NULL
+    `, id, reason)
+	return err
+}
+
+// отзывает все активные сессии пользователя
+func (r *SessionRepo) RevokeAllByUser(userID uuid.UUID, reason string) error {
+	return r.RevokeAllByUserTx(r.db, userID, reason)
+}
+
+func (r *SessionRepo) RevokeAllByUserTx(tx TxContext, userID uuid.UUID, reason string) error {
+	_, err := tx.Exec(`
+        UPDATE sessions SET revoked_at = NOW(), revoke_reason = $2
+        WHERE user_id=$1 AND revoked_at IS NULL
+    `, userID, reason)
+	return err
+}
+
+func (r *SessionRepo) CreateRefreshTx(tx TxContext, t *models.RefreshToken) error {
+	t.ID = uuid.New()
+	_, err := tx.NamedExec(`
+        INSERT INTO refresh_tokens (id, session_id, token_hash, expires_at)
+        VALUES (:id, :session_id, :token_hash, :expires_at)
+    `, t)
+	return err
+}
+
+func (r *SessionRepo) GetRefreshByHashForUpdateTx(tx TxContext, hash string) (*models.RefreshToken, error) {
+	var t models.RefreshToken
+	err := tx.Get(&t, `
+        SELECT id, session_id, token_hash, created_at, expires_at, used_at
+        FROM refresh_tokens WHERE token_hash=$1
+        FOR UPDATE
+    `, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &t, err
+}
+
+func (r *SessionRepo) MarkRefreshUsedTx(tx TxContext, id uuid.UUID) error {
+	_, err := tx.Exec(`
+        UPDATE refresh_tokens SET used_at = NOW() WHERE id=$1
+    `, id)
+	return err
+}
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type StandingOrderRepo struct {
+	db *sqlx.DB
+}
+
+func NewStandingOrderRepo(db *sqlx.DB) *StandingOrderRepo {
+	return &StandingOrderRepo{db}
+}
+
+const standingOrderColumns = `id, user_id, from_account_id, to_account_id, amount, note, rule,
+               day_of_month, weekday, cron, start_date, end_date, max_runs, runs, next_run_on,
+               attempts, status, last_run_at, last_error, created_at, updated_at`
+
+func (r *StandingOrderRepo) CreateTx(tx TxContext, o *models.StandingOrder) error {
+	o.ID = uuid.New()
+	o.CreatedAt = time.Now()
+	o.UpdatedAt = o.CreatedAt
+	_, err := tx.NamedExec(`
+        INSERT INTO standing_orders
+          (id, user_id, from_account_id, to_account_id, amount, note, rule, day_of_month,
+           weekday, cron, start_date, end_date, max_runs, next_run_on, status, created_at, updated_at)
+        VALUES
+          (:id, :user_id, :from_account_id, :to_account_id, :amount, :note, :rule, :day_of_month,
+           :weekday, :cron, :start_date, :end_date, :max_runs, :next_run_on, :status, :created_at, :updated_at)
+    `, o)
+	return err
+}
+
+func (r *StandingOrderRepo) GetByUserID(userID uuid.UUID) ([]models.StandingOrder, error) {
+	list := []models.StandingOrder{}
+	err := r.db.Select(&list, `
+        SELECT `+standingOrderColumns+`
+        FROM standing_orders WHERE user_id=$1
+        ORDER BY created_at DESC
+    `, userID)
+	return list, err
+}
+
+func (r *StandingOrderRepo) GetByID(id uuid.UUID) (*models.StandingOrder, error) {
+	var o models.StandingOrder
+	err := r.db.Get(&o, `
+        SELECT `+standingOrderColumns+`
+        FROM standing_orders WHERE id=$1
+    `, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &o, err
+}
+
+// поручения, срок исполнения которых наступил к дню day
+func (r *StandingOrderRepo) ListDue(day time.Time) ([]models.StandingOrder, error) {
+	var list []models.StandingOrder
+	err := r.db.Select(&list, `
+        SELECT `+standingOrderColumns+`
+        FROM standing_orders
+        WHERE status='active' AND next_run_on <= $1
+        ORDER BY next_run_on, id
+    `, day)
+	return list, err
+}
+
+// условия поручения после изменения клиентом; счётчик попыток сбрасывается
+func (r *StandingOrderRepo) Update(o *models.StandingOrder) error {
+	o.UpdatedAt = time.Now()
+	_, err := r.db.NamedExec(`
+        UPDATE standing_orders
+        SET from_account_id=:from_account_id, to_account_id=:to_account_id, amount=:amount,
+            note=:note, rule=:rule, day_of_month=:day_of_month, weekday=:weekday, cron=:cron,
+            start_date=:start_date, end_date=:end_date, max_runs=:max_runs,
+            next_run_on=:next_run_on, attempts=0, status=:status, updated_at=:updated_at
+        WHERE id=:id
+    `, o)
+	return err
+}
+
+// сохраняет итог исполнения, только если поручение не поменяли
+// с момента чтения: prevNext — next_run_on, с которым его исполняли
+func (r *StandingOrderRepo) SaveRun(o *models.StandingOrder, prevNext time.Time) (bool, error) {
+	res, err := r.db.Exec(`
+        UPDATE standing_orders
+        SET runs=$3, next_run_on=$4, attempts=$5, status=$6, last_run_at=$7, last_error=$8,
+            updated_at=NOW()
+        WHERE id=$1 AND next_run_on=$2 AND status='active'
+    `, o.ID, prevNext, o.Runs, o.NextRunOn, o.Attempts, o.Status, o.LastRunAt, o.LastError)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
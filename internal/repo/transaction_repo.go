@@ -1,9 +1,15 @@
 package repo
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"bankapp/internal/models"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
 type TransactionRepo struct {
@@ -18,9 +24,9 @@ func (r *TransactionRepo) Create(t *models.Transaction) error {
 	t.ID = uuid.New()
 	_, err := r.db.NamedExec(`
         INSERT INTO transactions
-            (id, from_account_id, to_account_id, amount, transaction_type, note)
+            (id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, fx_rate, transaction_type, note)
         VALUES
-            (:id, :from_account_id, :to_account_id, :amount, :transaction_type, :note)
+            (:id, :from_account_id, :to_account_id, :amount, :currency, :to_amount, :to_currency, :fx_rate, :transaction_type, :note)
     `, t)
 	return err
 }
@@ -29,9 +35,109 @@ func (r *TransactionRepo) CreateTx(tx TxContext, t *models.Transaction) error {
 	t.ID = uuid.New()
 	_, err := tx.NamedExec(`
         INSERT INTO transactions
-            (id, from_account_id, to_account_id, amount, transaction_type, note)
+            (id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, fx_rate, transaction_type, note)
         VALUES
-            (:id, :from_account_id, :to_account_id, :amount, :transaction_type, :note)
+            (:id, :from_account_id, :to_account_id, :amount, :currency, :to_amount, :to_currency, :fx_rate, :transaction_type, :note)
     `, t)
 	return err
 }
+
+// запоминает в операции остатки обоих счетов после её проводки; вызывается
+// в той же транзакции сразу после проводки
+func (r *TransactionRepo) SetBalancesAfterTx(tx TxContext, id uuid.UUID) error {
+	_, err := tx.Exec(`
+        UPDATE transactions t SET
+            from_balance_after = (SELECT balance FROM accounts WHERE id = t.from_account_id),
+            to_balance_after   = (SELECT balance FROM accounts WHERE id = t.to_account_id)
+        WHERE t.id = $1
+    `, id)
+	return err
+}
+
+// история операций по счёту: новые сверху (или старые, если f.Ascending),
+// с остатком после каждой операции. Limit 0 — без ограничения.
+// Остаток хранится в самой операции (SetBalancesAfterTx), поэтому фильтры
+// и курсор на него не влияют, а страница не требует обхода всей истории.
+// Фильтр по сумме — в валюте счёта: у входящей конвертации это to_amount
+func (r *TransactionRepo) History(accountID uuid.UUID, f models.TransactionFilter) ([]models.HistoryEntry, error) {
+	args := []interface{}{accountID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	var where []string
+	if f.From != nil {
+		where = append(where, "created_at >= "+arg(*f.From))
+	}
+	if f.To != nil {
+		where = append(where, "created_at < "+arg(*f.To))
+	}
+	if len(f.Types) > 0 {
+		where = append(where, "transaction_type = ANY("+arg(pq.Array(f.Types))+")")
+	}
+	if f.MinAmount != nil {
+		where = append(where, "account_amount >= "+arg(*f.MinAmount))
+	}
+	if f.MaxAmount != nil {
+		where = append(where, "account_amount <= "+arg(*f.MaxAmount))
+	}
+	if f.Counterparty != "" {
+		p := arg(f.Counterparty)
+		where = append(where, "(counterparty_id::text = "+p+" OR counterparty_number = "+p+")")
+	}
+	if f.Query != "" {
+		where = append(where, "position(lower("+arg(f.Query)+") in lower(note)) > 0")
+	}
+	order, cmp := "DESC", "<"
+	if f.Ascending {
+		order, cmp = "ASC", ">"
+	}
+	if f.AfterCreatedAt != nil {
+		where = append(where, "(created_at, id) "+cmp+" ("+arg(*f.AfterCreatedAt)+", "+arg(f.AfterID)+")")
+	}
+	limit := ""
+	if f.Limit > 0 {
+		limit = "LIMIT " + arg(f.Limit)
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	var list []models.HistoryEntry
+	err := r.db.Select(&list, `
+        WITH t AS (
+            SELECT tr.id, tr.from_account_id, tr.to_account_id, tr.amount,
+                   tr.currency, tr.to_amount, tr.to_currency, tr.fx_rate,
+                   tr.transaction_type, COALESCE(tr.note, '') AS note, tr.created_at,
+                   c.id AS counterparty_id, c.number AS counterparty_number,
+                   CASE WHEN tr.to_account_id = $1 THEN COALESCE(tr.to_amount, tr.amount) ELSE tr.amount END AS account_amount,
+                   CASE WHEN tr.to_account_id = $1 THEN tr.to_balance_after ELSE tr.from_balance_after END AS balance_after
+            FROM transactions tr
+            LEFT JOIN accounts c
+              ON c.id = CASE WHEN tr.from_account_id = $1 THEN tr.to_account_id ELSE tr.from_account_id END
+            WHERE tr.from_account_id = $1 OR tr.to_account_id = $1
+        )
+        SELECT id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, fx_rate,
+               transaction_type, note, created_at, counterparty_id, counterparty_number, balance_after
+        FROM t
+        `+cond+`
+        ORDER BY created_at `+order+`, id `+order+`
+        `+limit, args...)
+	return list, err
+}
+
+// остаток счёта на момент at: текущий минус всё, что прошло начиная с at;
+// зачисления после конвертации считаются в валюте счёта (to_amount)
+func (r *TransactionRepo) BalanceAt(accountID uuid.UUID, at time.Time) (decimal.Decimal, error) {
+	var bal decimal.Decimal
+	err := r.db.Get(&bal, `
+        SELECT a.balance - COALESCE((
+            SELECT SUM(CASE WHEN tr.to_account_id = a.id THEN COALESCE(tr.to_amount, tr.amount) ELSE -tr.amount END)
+            FROM transactions tr
+            WHERE (tr.from_account_id = a.id OR tr.to_account_id = a.id) AND tr.created_at >= $2
+        ), 0)
+        FROM accounts a WHERE a.id = $1
+    `, accountID, at)
+	return bal, err
+}
@@ -3,6 +3,7 @@ package repo
 import (
 	"database/sql"
 	"errors"
+	"strings"
 
 	"bankapp/internal/models"
 	"github.com/google/uuid"
@@ -17,6 +18,9 @@ func NewUserRepo(db *sqlx.DB) *UserRepo {
 	return &UserRepo{db}
 }
 
+const userColumns = `id, username, email, password_hash, totp_secret_enc, totp_enabled, totp_last_step,
+               email_verified_at, role, created_at, phone, phone_verified_at, default_account_id`
+
 func (r *UserRepo) Create(u *models.User) error {
 	u.ID = uuid.New()
 	_, err := r.db.NamedExec(`
@@ -29,7 +33,7 @@ func (r *UserRepo) Create(u *models.User) error {
 func (r *UserRepo) GetByUsername(username string) (*models.User, error) {
 	var u models.User
 	err := r.db.Get(&u, `
-        SELECT id, username, email, password_hash, created_at
+        SELECT `+userColumns+`
         FROM users WHERE username=$1
     `, username)
 	if err != nil {
@@ -44,7 +48,7 @@ func (r *UserRepo) GetByUsername(username string) (*models.User, error) {
 func (r *UserRepo) GetByEmail(email string) (*models.User, error) {
 	var u models.User
 	err := r.db.Get(&u, `
-        SELECT id, username, email, password_hash, created_at
+        SELECT `+userColumns+`
         FROM users WHERE email=$1
     `, email)
 	if err != nil {
@@ -53,11 +57,118 @@ func (r *UserRepo) GetByEmail(email string) (*models.User, error) {
 	return &u, nil
 }
 
+func (r *UserRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
 func (r *UserRepo) GetByID(id uuid.UUID) (*models.User, error) {
+	return r.GetByIDTx(r.db, id)
+}
+
+func (r *UserRepo) GetByIDTx(tx TxContext, id uuid.UUID) (*models.User, error) {
 	var u models.User
-	err := r.db.Get(&u, `
-        SELECT id, username, email, password_hash, created_at
+	err := tx.Get(&u, `
+        SELECT `+userColumns+`
         FROM users WHERE id=$1
     `, id)
 	return &u, err
 }
+
+// новый (ещё не подтверждённый) секрет TOTP
+func (r *UserRepo) SetTOTPSecret(id uuid.UUID, secretEnc []byte) error {
+	_, err := r.db.Exec(`
+        UPDATE users SET totp_secret_enc=$2, totp_enabled=false, totp_last_step=0
+        WHERE id=$1
+    `, id, secretEnc)
+	return err
+}
+
+func (r *UserRepo) SetTOTPEnabledTx(tx TxContext, id uuid.UUID, enabled bool) error {
+	_, err := tx.Exec(`UPDATE users SET totp_enabled=$2 WHERE id=$1`, id, enabled)
+	return err
+}
+
+func (r *UserRepo) ClearTOTPTx(tx TxContext, id uuid.UUID) error {
+	_, err := tx.Exec(`
+        UPDATE users SET totp_secret_enc=NULL, totp_enabled=false, totp_last_step=0
+        WHERE id=$1
+    `, id)
+	return err
+}
+
+// запоминает использованный шаг TOTP; false — код с этим шагом уже предъявляли
+func (r *UserRepo) AdvanceTOTPStep(id uuid.UUID, step int64) (bool, error) {
+	res, err := r.db.Exec(`
+        UPDATE users SET totp_last_step=$2
+        WHERE id=$1 AND totp_last_step < $2
+    `, id, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *UserRepo) SetEmailVerifiedTx(tx TxContext, id uuid.UUID) error {
+	_, err := tx.Exec(`
+        UPDATE users SET email_verified_at = NOW()
+        WHERE id=$1 AND email_verified_at IS NULL
+    `, id)
+	return err
+}
+
+func (r *UserRepo) UpdatePasswordTx(tx TxContext, id uuid.UUID, hash string) error {
+	_, err := tx.Exec(`UPDATE users SET password_hash=$2 WHERE id=$1`, id, hash)
+	return err
+}
+
+// поиск для бэк-офиса по части имени или email
+func (r *UserRepo) Search(q string, limit int) ([]models.User, error) {
+	list := []models.User{}
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+	err := r.db.Select(&list, `
+        SELECT `+userColumns+`
+        FROM users
+        WHERE username ILIKE $1 OR email ILIKE $1
+        ORDER BY username
+        LIMIT $2
+    `, pattern, limit)
+	return list, err
+}
+
+func (r *UserRepo) SetRoleTx(tx TxContext, id uuid.UUID, role string) error {
+	_, err := tx.Exec(`UPDATE users SET role=$2 WHERE id=$1`, id, role)
+	return err
+}
+
+// пользователь с подтверждённым номером телефона
+func (r *UserRepo) GetByPhone(phone string) (*models.User, error) {
+	var u models.User
+	err := r.db.Get(&u, `
+        SELECT `+userColumns+`
+        FROM users WHERE phone=$1 AND phone_verified_at IS NOT NULL
+    `, phone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	return &u, err
+}
+
+func (r *UserRepo) SetPhoneVerifiedTx(tx TxContext, id uuid.UUID, phone string) error {
+	_, err := tx.Exec(`
+        UPDATE users SET phone=$2, phone_verified_at=NOW()
+        WHERE id=$1
+    `, id, phone)
+	return err
+}
+
+func (r *UserRepo) SetDefaultAccount(id uuid.UUID, accountID *uuid.UUID) error {
+	_, err := r.db.Exec(`UPDATE users SET default_account_id=$2 WHERE id=$1`, id, accountID)
+	return err
+}
+
+// закрытый счёт перестаёт быть счётом по умолчанию
+func (r *UserRepo) ClearDefaultAccountTx(tx TxContext, accountID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE users SET default_account_id=NULL WHERE default_account_id=$1`, accountID)
+	return err
+}
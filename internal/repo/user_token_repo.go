@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type UserTokenRepo struct {
+	db *sqlx.DB
+}
+
+func NewUserTokenRepo(db *sqlx.DB) *UserTokenRepo {
+	return &UserTokenRepo{db}
+}
+
+func (r *UserTokenRepo) WithTx(fn func(TxContext) error) error {
+	return withTx(r.db, fn)
+}
+
+func (r *UserTokenRepo) Create(t *models.UserToken) error {
+	t.ID = uuid.New()
+	_, err := r.db.NamedExec(`
+        INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at)
+        VALUES (:id, :user_id, :purpose, :token_hash, :expires_at)
+    `, t)
+	return err
+}
+
+// гасит действующий токен и возвращает его владельца;
+// sql.ErrNoRows — токена нет, он просрочен или уже использован
+func (r *UserTokenRepo) ConsumeTx(tx TxContext, purpose, hash string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := tx.Get(&userID, `
+        UPDATE user_tokens SET used_at = NOW()
+        WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id
+    `, hash, purpose)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	return userID, err
+}
+
+// гасит все неиспользованные токены пользователя с этой целью
+func (r *UserTokenRepo) InvalidateTx(tx TxContext, userID uuid.UUID, purpose string) error {
+	_, err := tx.Exec(`
+        UPDATE user_tokens SET used_at = NOW()
+        WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL
+    `, userID, purpose)
+	return err
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// действия бэк-офиса; права проверяет middleware, каждое действие
+// (в том числе просмотр) попадает в audit_events
+
+const (
+	defaultAdminSearchLimit = 20
+	maxAdminSearchLimit     = 100
+)
+
+var (
+	ErrUserNotFound  = errors.New("пользователь не найден")
+	ErrCardNotFound  = errors.New("карта не найдена")
+	ErrUnknownRole   = errors.New("роль: customer, support, operator или admin")
+	ErrOwnRole       = errors.New("нельзя менять собственную роль")
+	ErrReasonMissing = errors.New("укажите причину")
+)
+
+func (s *BankService) AdminSearchUsers(actor models.Actor, q string, limit int) ([]models.User, error) {
+	if limit <= 0 {
+		limit = defaultAdminSearchLimit
+	}
+	if limit > maxAdminSearchLimit {
+		limit = maxAdminSearchLimit
+	}
+	list, err := s.userRepo.Search(q, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(actor, auditEntry{
+		Action:       "admin.users.search",
+		ResourceType: "user",
+		Details:      map[string]interface{}{"q": q, "found": len(list)},
+	}); err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].PasswordHash = ""
+	}
+	return list, nil
+}
+
+func (s *BankService) AdminGetUser(actor models.Actor, userID uuid.UUID) (*models.AdminUserView, error) {
+	u, err := s.userRepo.GetByID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	accs, err := s.accountRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(actor, auditEntry{Action: "admin.users.view", ResourceType: "user", ResourceID: userID.String()}); err != nil {
+		return nil, err
+	}
+	u.PasswordHash = ""
+	if accs == nil {
+		accs = []models.Account{}
+	}
+	return &models.AdminUserView{User: *u, Accounts: accs}, nil
+}
+
+func (s *BankService) AdminSetRole(actor models.Actor, userID uuid.UUID, role string) error {
+	if !validRole(role) {
+		return ErrUnknownRole
+	}
+	if userID == actor.UserID {
+		return ErrOwnRole
+	}
+	return s.userRepo.WithTx(func(tx repo.TxContext) error {
+		u, err := s.userRepo.GetByIDTx(tx, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.userRepo.SetRoleTx(tx, userID, role); err != nil {
+			return err
+		}
+		return s.auditTx(tx, actor, auditEntry{
+			Action:       "admin.users.set_role",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+			Before:       map[string]string{"role": u.Role},
+			After:        map[string]string{"role": role},
+		})
+	})
+}
+
+func (s *BankService) AdminGetAccount(actor models.Actor, accountID uuid.UUID) (*models.Account, error) {
+	acc, err := s.accountRepo.GetByID(accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(actor, auditEntry{Action: "admin.accounts.view", ResourceType: "account", ResourceID: accountID.String()}); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func (s *BankService) AdminAccountTransactions(actor models.Actor, accountID uuid.UUID, f models.TransactionFilter, cursor string) (*models.TransactionPage, error) {
+	if _, err := s.accountRepo.GetByID(accountID); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	page, err := s.history(accountID, f, cursor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(actor, auditEntry{Action: "admin.accounts.transactions", ResourceType: "account", ResourceID: accountID.String()}); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// заморозка и разморозка счёта; причина обязательна и уходит в аудит
+func (s *BankService) AdminSetAccountStatus(actor models.Actor, accountID uuid.UUID, status, reason string) (*models.Account, error) {
+	if reason == "" {
+		return nil, ErrReasonMissing
+	}
+	var acc *models.Account
+	err := s.accountRepo.WithTx(func(tx repo.TxContext) error {
+		var err error
+		acc, err = s.accountRepo.GetByIDForUpdateTx(tx, accountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		// системные счета банка не замораживаются
+		if acc.UserID == models.SystemUserID {
+			return ErrForbidden
+		}
+		// закрытый счёт не размораживается и не замораживается
+		if acc.Status == models.AccountClosed {
+			return ErrAccountClosed
+		}
+		before := acc.Status
+		if err := s.accountRepo.SetStatusTx(tx, acc.ID, status, reason); err != nil {
+			return err
+		}
+		acc.Status, acc.StatusReason = status, reason
+		return s.auditTx(tx, actor, auditEntry{
+			Action:       "admin.accounts.set_status",
+			ResourceType: "account",
+			ResourceID:   acc.ID.String(),
+			Before:       map[string]string{"status": before},
+			After:        map[string]string{"status": status},
+			Details:      map[string]string{"reason": reason},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func (s *BankService) AdminSetCardStatus(actor models.Actor, cardID uuid.UUID, status, reason string) (*models.Card, error) {
+	if reason == "" {
+		return nil, ErrReasonMissing
+	}
+	var card *models.Card
+	err := s.cardRepo.WithTx(func(tx repo.TxContext) error {
+		var err error
+		card, err = s.cardRepo.GetByIDForUpdateTx(tx, cardID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCardNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return s.setCardStatus(tx, actor, card, status, models.BlockedByBank, reason, "admin.cards.set_status")
+	})
+	if err != nil {
+		return nil, err
+	}
+	card.CVVHash = "***"
+	return card, nil
+}
+
+// внеочередной прогон ночных задач: кредиты, поручения, карты, проценты,
+// сверка книги
+func (s *BankService) AdminRunScheduler(actor models.Actor) error {
+	if err := s.audit(actor, auditEntry{Action: "admin.scheduler.run", ResourceType: "scheduler"}); err != nil {
+		return err
+	}
+	if err := s.ExpireCards(); err != nil {
+		return err
+	}
+	if err := s.ProcessScheduledPayments(); err != nil {
+		return err
+	}
+	if err := s.ProcessStandingOrders(); err != nil {
+		return err
+	}
+	if err := s.AccrueInterest(); err != nil {
+		return err
+	}
+	return s.ReportLedger()
+}
+
+func (s *BankService) AdminUnlockLogin(actor models.Actor, req models.UnlockLoginRequest) error {
+	if err := s.UnlockLogin(req); err != nil {
+		return err
+	}
+	return s.audit(actor, auditEntry{
+		Action:       "admin.login.unlock",
+		ResourceType: "login",
+		ResourceID:   req.Username,
+		Details:      req,
+	})
+}
+
+func (s *BankService) AdminAuditLog(actor models.Actor, beforeID int64, limit int) ([]models.AuditEvent, error) {
+	if limit <= 0 {
+		limit = defaultAdminSearchLimit
+	}
+	if limit > maxAdminSearchLimit {
+		limit = maxAdminSearchLimit
+	}
+	// свежие события ещё могут быть в очереди — дописываем их в цепочку
+	if _, err := s.SealAudit(); err != nil {
+		logrus.Errorf("аудит: перенос очереди: %v", err)
+	}
+	list, err := s.auditRepo.List(beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(actor, auditEntry{Action: "admin.audit.view", ResourceType: "audit"}); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// событие для журнала аудита; Before/After/Details сериализуются в JSON
+type auditEntry struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Before       interface{}
+	After        interface{}
+	Details      interface{}
+}
+
+// ставит событие аудита в очередь в транзакции tx, чтобы оно фиксировалось
+// вместе с самим действием; в цепочку хешей его переносит SealAudit
+func (s *BankService) auditTx(tx repo.TxContext, actor models.Actor, en auditEntry) error {
+	e := &models.AuditEvent{
+		ActorRole:    actor.Role,
+		Action:       en.Action,
+		ResourceType: en.ResourceType,
+		ResourceID:   en.ResourceID,
+		IP:           actor.IP,
+		UserAgent:    actor.UserAgent,
+		Details:      json.RawMessage("{}"),
+	}
+	if actor.UserID != uuid.Nil {
+		id := actor.UserID
+		e.ActorID = &id
+	}
+	var err error
+	if en.Details != nil {
+		if e.Details, err = json.Marshal(en.Details); err != nil {
+			return err
+		}
+	}
+	if en.Before != nil {
+		if e.Before, err = json.Marshal(en.Before); err != nil {
+			return err
+		}
+	}
+	if en.After != nil {
+		if e.After, err = json.Marshal(en.After); err != nil {
+			return err
+		}
+	}
+	return s.auditRepo.CreateTx(tx, e)
+}
+
+// для действий без своей транзакции (просмотр данных, вход)
+func (s *BankService) audit(actor models.Actor, en auditEntry) error {
+	return s.auditRepo.WithTx(func(tx repo.TxContext) error {
+		return s.auditTx(tx, actor, en)
+	})
+}
+
+// аудит, который не должен ломать основное действие (вход в систему):
+// ошибка записи только логируется
+func (s *BankService) auditBestEffort(actor models.Actor, en auditEntry) {
+	if err := s.audit(actor, en); err != nil {
+		logrus.Errorf("аудит %s: %v", en.Action, err)
+	}
+}
+
+// сколько событий очереди переносится в цепочку за одну транзакцию
+const auditSealBatch = 500
+
+// переносит очередь событий аудита в цепочку хешей; вызывается в фоне
+// из cmd/api и перед чтением журнала. Возвращает число перенесённых
+func (s *BankService) SealAudit() (int, error) {
+	total := 0
+	for {
+		n, err := s.auditRepo.SealPending(auditSealBatch)
+		total += n
+		if err != nil || n < auditSealBatch {
+			return total, err
+		}
+	}
+}
+
+// разрыв цепочки аудита
+type AuditBreak struct {
+	ID     int64
+	Reason string
+}
+
+type AuditReport struct {
+	Checked  int // записей в цепочке
+	Unsealed int // записей до появления цепочки (без хеша)
+	Pending  int // событий в очереди, ещё не в цепочке
+	Breaks   []AuditBreak
+}
+
+const auditVerifyBatch = 1000
+
+// проходит цепочку от начала и сверяет каждый хеш; после разрыва
+// продолжает от сохранённого хеша, чтобы одна правка давала одну ошибку
+func VerifyAuditChain(r *repo.AuditRepo) (*AuditReport, error) {
+	rep := &AuditReport{}
+	prev := models.AuditGenesisHash
+	var after, lastSealed int64
+	for {
+		batch, err := r.ListAfter(after, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for i := range batch {
+			e := &batch[i]
+			after = e.ID
+			if e.Hash == nil || e.PrevHash == nil {
+				if lastSealed == 0 {
+					rep.Unsealed++
+				} else {
+					rep.Breaks = append(rep.Breaks, AuditBreak{e.ID, "запись без хеша внутри цепочки"})
+				}
+				continue
+			}
+			rep.Checked++
+			lastSealed = e.ID
+			if *e.PrevHash != prev {
+				rep.Breaks = append(rep.Breaks, AuditBreak{e.ID, "prev_hash не совпадает с предыдущей записью: запись перед ней удалена или вставлена"})
+			}
+			hash, err := e.ChainHash(*e.PrevHash)
+			if err != nil {
+				rep.Breaks = append(rep.Breaks, AuditBreak{e.ID, "не удалось посчитать хеш: " + err.Error()})
+			} else if hash != *e.Hash {
+				rep.Breaks = append(rep.Breaks, AuditBreak{e.ID, "хеш не совпадает: запись изменена"})
+			}
+			prev = *e.Hash
+		}
+	}
+	pending, err := r.Pending()
+	if err != nil {
+		return nil, err
+	}
+	rep.Pending = pending
+	headID, headHash, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	if headID != lastSealed || headHash != prev {
+		rep.Breaks = append(rep.Breaks, AuditBreak{headID, "голова цепочки не совпадает с последней записью: конец журнала удалён"})
+	}
+	return rep, nil
+}
@@ -0,0 +1,48 @@
+package services_test
+
+import (
+	"sync"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/shopspring/decimal"
+)
+
+// события из параллельных операций попадают в очередь, а после переноса
+// образуют цепочку без разрывов
+func TestAuditOutboxSealsIntoChain(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	acc := env.Account(t, u, "0")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := env.Svc.Deposit(testutil.Actor(u), models.DepositRequest{
+				ToAccountID: acc.ID,
+				Amount:      decimal.NewFromInt(1),
+			}, nil); err != nil {
+				t.Errorf("пополнение: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	audit := repo.NewAuditRepo(env.DB)
+	if _, err := env.Svc.SealAudit(); err != nil {
+		t.Fatalf("перенос очереди: %v", err)
+	}
+	rep, err := services.VerifyAuditChain(audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Breaks) > 0 {
+		t.Fatalf("разрывы цепочки: %+v", rep.Breaks)
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"bankapp/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrForbidden       = errors.New("нет доступа")
+	ErrAccountNotFound = errors.New("счёт не найден")
+	ErrCreditNotFound  = errors.New("кредит не найден")
+	ErrAccountFrozen   = errors.New("счёт заморожен")
+	ErrAccountClosed   = errors.New("счёт закрыт")
+	ErrCardBlocked     = errors.New("карта заблокирована")
+)
+
+// владелец может всё; делегату с view доступно только чтение
+func (s *BankService) authorizeAccount(userID uuid.UUID, acc *models.Account, need string) error {
+	if acc.UserID == userID {
+		return nil
+	}
+	level, err := s.accessRepo.GetLevel(acc.ID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+	if need == models.AccessView || level == models.AccessOperate {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// загружает счёт и проверяет доступ к нему
+func (s *BankService) authorizeAccountID(userID, accountID uuid.UUID, need string) (*models.Account, error) {
+	acc, err := s.accountRepo.GetByID(accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeAccount(userID, acc, need); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// кредит виден заёмщику и тем, у кого есть доступ к его счёту
+func (s *BankService) authorizeCredit(userID, creditID uuid.UUID) (*models.Credit, error) {
+	cr, err := s.creditRepo.GetByID(creditID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCreditNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cr.UserID == userID {
+		return cr, nil
+	}
+	if _, err := s.authorizeAccountID(userID, cr.AccountID, models.AccessView); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// выдать другому пользователю доступ к своему счёту
+func (s *BankService) GrantAccess(ownerID, accountID, granteeID uuid.UUID, level string) (*models.AccountAccess, error) {
+	if level != models.AccessView && level != models.AccessOperate {
+		return nil, errors.New("уровень доступа должен быть view или operate")
+	}
+	acc, err := s.ownAccount(ownerID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if granteeID == acc.UserID {
+		return nil, errors.New("владелец уже имеет полный доступ")
+	}
+	if _, err := s.userRepo.GetByID(granteeID); err != nil {
+		return nil, errors.New("пользователь не найден")
+	}
+	a := &models.AccountAccess{
+		AccountID: accountID,
+		UserID:    granteeID,
+		Level:     level,
+		GrantedBy: ownerID,
+	}
+	if err := s.accessRepo.Grant(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *BankService) RevokeAccess(ownerID, accountID, granteeID uuid.UUID) error {
+	if _, err := s.ownAccount(ownerID, accountID); err != nil {
+		return err
+	}
+	return s.accessRepo.Revoke(accountID, granteeID)
+}
+
+func (s *BankService) ListAccess(ownerID, accountID uuid.UUID) ([]models.AccountAccess, error) {
+	if _, err := s.ownAccount(ownerID, accountID); err != nil {
+		return nil, err
+	}
+	return s.accessRepo.GetByAccountID(accountID)
+}
+
+// управлять доступом может только владелец, не делегат
+func (s *BankService) ownAccount(userID, accountID uuid.UUID) (*models.Account, error) {
+	acc, err := s.accountRepo.GetByID(accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if acc.UserID != userID {
+		return nil, ErrForbidden
+	}
+	return acc, nil
+}
+
+// деньги двигаются только по активным счетам
+func accountUsable(acc *models.Account) error {
+	switch acc.Status {
+	case models.AccountActive:
+		return nil
+	case models.AccountClosed:
+		return ErrAccountClosed
+	default:
+		return ErrAccountFrozen
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
@@ -17,13 +18,30 @@ import (
 
 // содержит все репозитории и конфиг
 type BankService struct {
-	userRepo        *repo.UserRepo
-	accountRepo     *repo.AccountRepo
-	cardRepo        *repo.CardRepo
-	transactionRepo *repo.TransactionRepo
-	creditRepo      *repo.CreditRepo
-	scheduleRepo    *repo.ScheduleRepo
-	cfg             *config.Config
+	userRepo          *repo.UserRepo
+	accountRepo       *repo.AccountRepo
+	cardRepo          *repo.CardRepo
+	transactionRepo   *repo.TransactionRepo
+	creditRepo        *repo.CreditRepo
+	scheduleRepo      *repo.ScheduleRepo
+	ledgerRepo        *repo.LedgerRepo
+	idempotencyRepo   *repo.IdempotencyRepo
+	accessRepo        *repo.AccessRepo
+	sessionRepo       *repo.SessionRepo
+	recoveryRepo      *repo.RecoveryCodeRepo
+	userTokenRepo     *repo.UserTokenRepo
+	loginAttemptRepo  *repo.LoginAttemptRepo
+	auditRepo         *repo.AuditRepo
+	fxRateRepo        *repo.FXRateRepo
+	productRepo       *repo.AccountProductRepo
+	standingOrderRepo *repo.StandingOrderRepo
+	phoneRepo         *repo.PhoneVerificationRepo
+	rateLimitRepo     *repo.RateLimitRepo
+	cfg               *config.Config
+	jwtKeys           *JWTKeySet
+	cbr               *CBRClient
+	fx                FXProvider
+	sms               SMSSender
 }
 
 // конструктор
@@ -34,9 +52,32 @@ func NewBankService(
 	t *repo.TransactionRepo,
 	cr *repo.CreditRepo,
 	s *repo.ScheduleRepo,
+	l *repo.LedgerRepo,
+	i *repo.IdempotencyRepo,
+	ac *repo.AccessRepo,
+	se *repo.SessionRepo,
+	rc *repo.RecoveryCodeRepo,
+	ut *repo.UserTokenRepo,
+	la *repo.LoginAttemptRepo,
+	au *repo.AuditRepo,
+	fr *repo.FXRateRepo,
+	pr *repo.AccountProductRepo,
+	so *repo.StandingOrderRepo,
+	pv *repo.PhoneVerificationRepo,
+	rl *repo.RateLimitRepo,
 	cfg *config.Config,
+	keys *JWTKeySet,
 ) *BankService {
-	return &BankService{u, a, c, t, cr, s, cfg}
+	cbr := NewCBRClient(cfg.CBREndpoint, cfg.CBRDailyURL, time.Duration(cfg.CBRTimeoutSec)*time.Second)
+	svc := &BankService{u, a, c, t, cr, s, l, i, ac, se, rc, ut, la, au, fr, pr, so, pv, rl, cfg, keys, cbr, nil, LogSMSSender{}}
+	svc.fx = NewFileFXProvider(cfg.FXRatesPath)
+	if cfg.FXSource == "cbr" {
+		svc.fx = cbrFXProvider{svc}
+	}
+	if cfg.SMSGatewayURL != "" {
+		svc.sms = NewHTTPSMSGateway(cfg.SMSGatewayURL, time.Duration(cfg.CBRTimeoutSec)*time.Second)
+	}
+	return svc
 }
 
 // регистрация нового пользователя
@@ -48,12 +89,13 @@ func (s *BankService) RegisterUser(req models.RegisterRequest) (*models.User, er
 	if err := user.Validate(req.Password); err != nil {
 		return nil, err
 	}
-	// проверка уникальности
+	// проверка уникальности: ответ один и тот же, чтобы по нему нельзя
+	// было узнать, зарегистрирован ли email
 	if _, err := s.userRepo.GetByUsername(req.Username); err == nil {
-		return nil, fmt.Errorf("имя %s уже занято", req.Username)
+		return nil, ErrRegistrationConflict
 	}
 	if _, err := s.userRepo.GetByEmail(req.Email); err == nil {
-		return nil, fmt.Errorf("email %s уже зарегистрирован", req.Email)
+		return nil, ErrRegistrationConflict
 	}
 	// хешируем пароль
 	hash, err := HashPassword(req.Password)
@@ -61,71 +103,145 @@ func (s *BankService) RegisterUser(req models.RegisterRequest) (*models.User, er
 		return nil, err
 	}
 	user.PasswordHash = hash
-	// сохраняем в БД
+	// сохраняем в БД; параллельная регистрация упирается в unique
 	if err := s.userRepo.Create(user); err != nil {
+		if repo.IsUniqueViolation(err) {
+			return nil, ErrRegistrationConflict
+		}
 		return nil, err
 	}
-	// асинхронно шлём welcome-письмо
-	go sendEmailNotification(
-		s.cfg,
-		user.Email,
+	// welcome-письмо сразу со ссылкой подтверждения email
+	if err := s.sendVerification(
+		user,
 		"Добро пожаловать в BankApp",
 		fmt.Sprintf("Здравствуйте, %s! Спасибо за регистрацию.", user.Username),
-	)
+	); err != nil {
+		logrus.Errorf("письмо с подтверждением для %s: %v", user.ID, err)
+	}
 	// не возвращаем хеш обратно
 	user.PasswordHash = ""
 	return user, nil
 }
 
-// JWT
-func (s *BankService) LoginUser(req models.LoginRequest) (string, error) {
+// вход: короткий access-токен и refresh-токен новой сессии;
+// при включённом TOTP — только mfa_token для второго шага (/login/mfa).
+// Неудачи считаются по имени и по IP клиента
+func (s *BankService) LoginUser(req models.LoginRequest, client models.Actor) (*models.LoginResponse, error) {
+	if err := s.checkLoginAllowed(req.Username, client.IP); err != nil {
+		return nil, err
+	}
 	u, err := s.userRepo.GetByUsername(req.Username)
 	if err != nil || !CheckPasswordHash(req.Password, u.PasswordHash) {
-		return "", errors.New("неверное имя или пароль")
+		s.recordLoginFailure(req.Username, client, "password")
+		return nil, ErrInvalidCredentials
+	}
+	client.UserID = u.ID
+	if u.TOTPEnabled {
+		// счётчик не сбрасываем до второго фактора, иначе перебор кода
+		// можно продолжать, заново входя по паролю
+		mfa, err := s.generateMFAToken(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		s.auditBestEffort(client, auditEntry{
+			Action:       "auth.password_ok",
+			ResourceType: "user",
+			ResourceID:   u.ID.String(),
+			Details:      map[string]bool{"mfa_required": true},
+		})
+		return &models.LoginResponse{MFARequired: true, MFAToken: mfa}, nil
 	}
-	return s.generateJWT(u.ID.String())
+	s.resetLoginFailures(u.Username)
+	pair, err := s.startSession(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.auditBestEffort(client, auditEntry{Action: "auth.login", ResourceType: "user", ResourceID: u.ID.String()})
+	return &models.LoginResponse{TokenPair: pair}, nil
 }
 
-func (s *BankService) ParseToken(tokenStr string) (uuid.UUID, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-			return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
-		}
-		return []byte(s.cfg.JWTSecret), nil
-	})
+// проверяет подпись, срок и то, что сессия токена не отозвана
+func (s *BankService) ParseToken(tokenStr string) (*models.TokenClaims, error) {
+	token, err := s.jwtKeys.Parse(tokenStr, jwt.WithAudience(s.cfg.JWTAudience))
 	if err != nil || !token.Valid {
-		return uuid.Nil, errors.New("некорректный токен")
+		return nil, errors.New("некорректный токен")
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return uuid.Nil, errors.New("неверные claims")
+		return nil, errors.New("неверные claims")
+	}
+	if typ, _ := claims["typ"].(string); typ != accessTokenType {
+		return nil, errors.New("неверный тип токена")
 	}
 	sub, ok := claims["sub"].(string)
 	if !ok {
-		return uuid.Nil, errors.New("нет subject в токене")
+		return nil, errors.New("нет subject в токене")
+	}
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		return nil, errors.New("нет сессии в токене")
 	}
-	return uuid.Parse(sub)
+	tc := &models.TokenClaims{}
+	if tc.UserID, err = uuid.Parse(sub); err != nil {
+		return nil, err
+	}
+	if tc.SessionID, err = uuid.Parse(sid); err != nil {
+		return nil, err
+	}
+	sess, err := s.sessionRepo.GetByID(tc.SessionID)
+	if err != nil || sess.RevokedAt != nil || sess.UserID != tc.UserID {
+		return nil, ErrSessionRevoked
+	}
+	return tc, nil
 }
 
-// создаёт JWT с 24-часовым сроком
-func (s *BankService) generateJWT(userID string) (string, error) {
-	exp := time.Now().Add(24 * time.Hour).Unix()
-	claims := jwt.MapClaims{"sub": userID, "exp": exp}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.cfg.JWTSecret))
+// создаёт короткоживущий access-токен, привязанный к сессии
+func (s *BankService) generateJWT(userID, sessionID string) (string, error) {
+	now := time.Now()
+	exp := now.Add(time.Duration(s.cfg.AccessTokenTTLMin) * time.Minute).Unix()
+	// aud и typ проверяют и сервисы, принимающие токены по JWKS
+	claims := jwt.MapClaims{
+		"aud": s.cfg.JWTAudience,
+		"typ": accessTokenType,
+		"sub": userID,
+		"sid": sessionID,
+		"jti": uuid.NewString(),
+		"iat": now.Unix(),
+		"exp": exp,
+	}
+	return s.jwtKeys.Sign(claims)
 }
 
-// новый счёт для userID
-func (s *BankService) CreateAccount(userID uuid.UUID) (*models.Account, error) {
-	acc := &models.Account{
-		UserID:  userID,
-		Number:  generateAccountNumber(),
-		Balance: decimal.Zero,
-	}
-	if err := s.accountRepo.Create(acc); err != nil {
+// открытые ключи проверки токенов для других сервисов
+func (s *BankService) JWKS() JWKS {
+	return s.jwtKeys.JWKS()
+}
+
+// новый счёт для userID; по умолчанию — рублёвый расчётный
+func (s *BankService) CreateAccount(userID uuid.UUID, req models.CreateAccountRequest, key *models.IdempotencyKey) (*models.Account, error) {
+	currency, err := parseCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireVerifiedEmail(userID); err != nil {
 		return nil, err
 	}
-	return acc, nil
+	return idempotent(s, key, func(tx repo.TxContext) (*models.Account, error) {
+		acc := &models.Account{
+			UserID:   userID,
+			Number:   generateAccountNumber(),
+			Balance:  decimal.Zero,
+			Currency: currency,
+			Status:   models.AccountActive,
+		}
+		if err := s.applyProduct(acc, req); err != nil {
+			return nil, err
+		}
+		if err := s.accountRepo.CreateTx(tx, acc); err != nil {
+			return nil, err
+		}
+		return acc, nil
+	})
 }
 
 // список счетов пользователя
@@ -134,45 +250,50 @@ func (s *BankService) GetUserAccounts(userID uuid.UUID) ([]models.Account, error
 }
 
 // карта к счёту
-func (s *BankService) GenerateCard(accountID uuid.UUID) (*models.Card, error) {
-	if _, err := s.accountRepo.GetByID(accountID); err != nil {
-		return nil, fmt.Errorf("счёт %s не найден", accountID)
+func (s *BankService) GenerateCard(actor models.Actor, accountID uuid.UUID, key *models.IdempotencyKey) (*models.Card, error) {
+	userID := actor.UserID
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, err
 	}
-	cardNum := generateCardNumber()
-	expM, expY := generateExpiryDate()
-	cvv := generateCVV()
-
-	numEnc, err := EncryptPGP([]byte(cardNum), s.cfg.PGPPublicKeyPath)
+	acc, err := s.authorizeAccountID(userID, accountID, models.AccessOperate)
 	if err != nil {
 		return nil, err
 	}
-	expiryStr := fmt.Sprintf("%02d/%02d", expM, expY%100)
-	expEnc, err := EncryptPGP([]byte(expiryStr), s.cfg.PGPPublicKeyPath)
-	if err != nil {
+	if err := accountUsable(acc); err != nil {
 		return nil, err
 	}
-	cvvHash, err := HashCVV(cvv)
+	card, cvv, err := s.newCard(accountID)
 	if err != nil {
 		return nil, err
 	}
-	hmacHex := ComputeHMAC(cardNum+expiryStr, []byte(s.cfg.HMACSecret))
 
-	card := &models.Card{
-		AccountID: accountID,
-		NumberEnc: numEnc,
-		ExpiryEnc: expEnc,
-		CVVHash:   cvvHash,
-		HMAC:      hmacHex,
-	}
-	if err := s.cardRepo.Create(card); err != nil {
+	res, err := idempotent(s, key, func(tx repo.TxContext) (*models.Card, error) {
+		if err := s.cardRepo.CreateTx(tx, card); err != nil {
+			return nil, err
+		}
+		if err := s.auditTx(tx, actor, auditEntry{
+			Action:       "card.create",
+			ResourceType: "card",
+			ResourceID:   card.ID.String(),
+			After:        map[string]string{"account_id": accountID.String(), "status": card.Status},
+		}); err != nil {
+			return nil, err
+		}
+		card.CVVHash = "***"
+		return card, nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	card.CVVHash = "***"
-	return card, nil
+	res.CVV = issuedCVV(key, cvv)
+	return res, nil
 }
 
 // список карт по счёту
-func (s *BankService) GetAccountCards(accountID uuid.UUID) ([]models.Card, error) {
+func (s *BankService) GetAccountCards(userID, accountID uuid.UUID) ([]models.Card, error) {
+	if _, err := s.authorizeAccountID(userID, accountID, models.AccessView); err != nil {
+		return nil, err
+	}
 	cards, err := s.cardRepo.GetByAccountID(accountID)
 	if err != nil {
 		return nil, err
@@ -184,180 +305,418 @@ func (s *BankService) GetAccountCards(accountID uuid.UUID) ([]models.Card, error
 }
 
 // оплата по карте
-func (s *BankService) PayWithCard(req models.PaymentRequest) error {
-	if req.Amount.LessOrEqual(decimal.Zero) {
-		return errors.New("сумма должна быть >0")
+func (s *BankService) PayWithCard(actor models.Actor, req models.PaymentRequest, key *models.IdempotencyKey) (*models.Transaction, error) {
+	userID := actor.UserID
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("сумма должна быть >0")
+	}
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, err
+	}
+	if req.MCC != "" && !validMCC(req.MCC) {
+		return nil, ErrMCCFormat
+	}
+	if req.Country != "" && !validCountry(req.Country) {
+		return nil, ErrCountryFormat
 	}
-	hmacHex := ComputeHMAC(req.CardNumber, []byte(s.cfg.HMACSecret))
-	card, err := s.cardRepo.GetByHMAC(hmacHex)
+	// доступ к счёту карты и реквизиты проверяются до статуса и PIN: не
+	// имеющий права платить картой получает один и тот же отказ и не
+	// может ни узнать её статус, ни израсходовать попытки CVV и PIN
+	card, err := s.verifyCard(actor, req)
 	if err != nil {
-		return errors.New("карта не найдена")
+		return nil, err
+	}
+	if err := cardUsable(card, time.Now()); err != nil {
+		return nil, err
+	}
+	// с картой в руках вместо CVV — PIN; до него доходит только
+	// прошедший verifyCard, то есть имеющий доступ к счёту карты
+	if req.CardPresent {
+		if err := s.verifyPIN(actor, card, req.PIN); err != nil {
+			return nil, err
+		}
 	}
-	// запуск транзакции
-	return s.accountRepo.WithTx(func(tx repo.TxContext) error {
-		acc, err := s.accountRepo.GetByID(card.AccountID)
+	// запуск транзакции; acc остаётся nil, если ответ взят из сохранённого
+	var acc *models.Account
+	tr, err := idempotent(s, key, func(tx repo.TxContext) (*models.Transaction, error) {
+		acc, err = s.accountRepo.GetByIDForUpdateTx(tx, card.AccountID)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if acc.Balance.LessThan(req.Amount) {
-			return errors.New("недостаточно средств")
+		if err := s.authorizeAccount(userID, acc, models.AccessOperate); err != nil {
+			return nil, err
+		}
+		if err := accountUsable(acc); err != nil {
+			return nil, err
+		}
+		if err := withdrawable(acc, time.Now()); err != nil {
+			return nil, err
 		}
-		newBal := acc.Balance.Sub(req.Amount)
-		if err := s.accountRepo.UpdateBalanceTx(tx, acc.ID, newBal); err != nil {
-			return err
+		// сумма оплаты — в валюте счёта карты
+		if err := checkAmount(req.Amount, acc.Currency); err != nil {
+			return nil, err
+		}
+		// карта под блокировкой: лимиты и траты считаются без гонок
+		locked, err := s.cardRepo.GetByIDForUpdateTx(tx, card.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := cardUsable(locked, time.Now()); err != nil {
+			return nil, err
+		}
+		if err := s.applyCardControls(tx, card.ID, req, time.Now()); err != nil {
+			return nil, err
+		}
+		if acc.Balance.LessThan(req.Amount) {
+			return nil, ErrInsufficientFunds
 		}
 		tr := &models.Transaction{
 			From:      &acc.ID,
 			To:        nil,
 			Amount:    req.Amount,
-			Type:      "payment",
+			Currency:  acc.Currency,
+			Type:      models.TxPayment,
 			Note:      fmt.Sprintf("оплата %s", req.Merchant),
 			CreatedAt: time.Now(),
 		}
-		if err := s.transactionRepo.CreateTx(tx, tr); err != nil {
-			return err
+		// клиент -> расчёты с мерчантами
+		if err := s.post(tx, tr,
+			debit(acc.ID, req.Amount),
+			credit(models.SystemAccount(models.SystemMerchantSettlement, acc.Currency), req.Amount),
+		); err != nil {
+			return nil, err
 		}
-		// уведомление
+		return tr, s.auditTx(tx, actor, auditEntry{
+			Action:       "payment.create",
+			ResourceType: "transaction",
+			ResourceID:   tr.ID.String(),
+			Before:       map[string]decimal.Decimal{acc.ID.String(): acc.Balance},
+			After:        map[string]decimal.Decimal{acc.ID.String(): acc.Balance.Sub(req.Amount)},
+			Details:      map[string]string{"card_id": card.ID.String(), "merchant": req.Merchant, "amount": req.Amount.String()},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// уведомление — только после коммита, транзакция могла повторяться
+	if acc != nil {
 		go func() {
 			u, _ := s.userRepo.GetByID(acc.UserID)
 			_ = sendEmailNotification(
 				s.cfg,
 				u.Email,
 				"Успешная оплата",
-				fmt.Sprintf("Вы оплатили %s: %s", req.Merchant, req.Amount),
+				fmt.Sprintf("Вы оплатили %s: %s %s", req.Merchant, req.Amount, acc.Currency),
 			)
 		}()
-		return nil
-	})
+	}
+	return tr, nil
 }
 
 // перевод между счетами
-func (s *BankService) Transfer(req models.TransferRequest) error {
-	if req.Amount.LessOrEqual(decimal.Zero) {
-		return errors.New("сумма должна быть >0")
+func (s *BankService) Transfer(actor models.Actor, req models.TransferRequest, key *models.IdempotencyKey) (*models.Transaction, error) {
+	userID := actor.UserID
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("сумма должна быть >0")
+	}
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, err
+	}
+	// права на счёт списания — до поиска получателя, иначе перевод с чужого
+	// счёта отвечал бы ошибками поиска и раскрывал, кто есть в банке.
+	// В транзакции права проверяются ещё раз на заблокированной строке
+	from, err := s.authorizeAccountID(userID, req.FromAccountID, models.AccessOperate)
+	if err != nil {
+		return nil, err
+	}
+	// получатель ищется до транзакции: номер счёта, имя или телефон -> id
+	if _, _, err := s.resolveRecipient(&req, from.Currency); err != nil {
+		return nil, err
 	}
 	if req.FromAccountID == req.ToAccountID {
-		return errors.New("невозможно перевести на тот же счёт")
+		return nil, errors.New("невозможно перевести на тот же счёт")
 	}
-	return s.accountRepo.WithTx(func(tx repo.TxContext) error {
-		fromAcc, err := s.accountRepo.GetByID(req.FromAccountID)
-		if err != nil {
-			return err
+	return idempotent(s, key, func(tx repo.TxContext) (*models.Transaction, error) {
+		accs, err := s.accountRepo.LockTx(tx, req.FromAccountID, req.ToAccountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
 		}
-		toAcc, err := s.accountRepo.GetByID(req.ToAccountID)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if fromAcc.Balance.LessThan(req.Amount) {
-			return errors.New("недостаточно средств")
+		fromAcc, toAcc := accs[req.FromAccountID], accs[req.ToAccountID]
+		if err := s.authorizeAccount(userID, fromAcc, models.AccessOperate); err != nil {
+			return nil, err
+		}
+		// на внутренние счета банка переводить нельзя
+		if toAcc.UserID == models.SystemUserID {
+			return nil, ErrAccountNotFound
+		}
+		for _, a := range []*models.Account{fromAcc, toAcc} {
+			if err := accountUsable(a); err != nil {
+				return nil, err
+			}
+		}
+		if err := withdrawable(fromAcc, time.Now()); err != nil {
+			return nil, err
 		}
-		// списываем со счёта отправителя
-		if err := s.accountRepo.UpdateBalanceTx(tx, fromAcc.ID, fromAcc.Balance.Sub(req.Amount)); err != nil {
-			return err
+		// сумма перевода — в валюте счёта списания
+		if err := checkAmount(req.Amount, fromAcc.Currency); err != nil {
+			return nil, err
 		}
-		// зачисляем на счёт получателя
-		if err := s.accountRepo.UpdateBalanceTx(tx, toAcc.ID, toAcc.Balance.Add(req.Amount)); err != nil {
-			return err
+		if fromAcc.Balance.LessThan(req.Amount) {
+			return nil, ErrInsufficientFunds
 		}
 		tr := &models.Transaction{
 			From:      &fromAcc.ID,
 			To:        &toAcc.ID,
 			Amount:    req.Amount,
-			Type:      "transfer",
+			Currency:  fromAcc.Currency,
+			Type:      models.TxTransfer,
 			Note:      "внутренний перевод",
 			CreatedAt: time.Now(),
 		}
-		return s.transactionRepo.CreateTx(tx, tr)
+		credited := req.Amount
+		// списываем со счёта отправителя, зачисляем получателю
+		legs := []models.Posting{debit(fromAcc.ID, req.Amount), credit(toAcc.ID, req.Amount)}
+		if fromAcc.Currency != toAcc.Currency {
+			rate, converted, err := s.convert(req.Amount, fromAcc.Currency, toAcc.Currency, tr.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+			credited = converted
+			tr.ToAmount, tr.ToCurrency, tr.FXRate = &converted, &toAcc.Currency, &rate
+			tr.Note = fmt.Sprintf("перевод с конвертацией %s/%s по курсу %s", fromAcc.Currency, toAcc.Currency, rate)
+			// валюта отправителя уходит в валютную позицию банка,
+			// получателю зачисляется из позиции в его валюте
+			legs = []models.Posting{
+				debit(fromAcc.ID, req.Amount),
+				credit(models.SystemAccount(models.SystemFXPosition, fromAcc.Currency), req.Amount),
+				debit(models.SystemAccount(models.SystemFXPosition, toAcc.Currency), converted),
+				credit(toAcc.ID, converted),
+			}
+		}
+		if err := s.post(tx, tr, legs...); err != nil {
+			return nil, err
+		}
+		details := map[string]string{"amount": req.Amount.String(), "currency": fromAcc.Currency}
+		if tr.FXRate != nil {
+			details["to_amount"] = credited.String()
+			details["to_currency"] = toAcc.Currency
+			details["fx_rate"] = tr.FXRate.String()
+		}
+		return tr, s.auditTx(tx, actor, auditEntry{
+			Action:       "transfer.create",
+			ResourceType: "transaction",
+			ResourceID:   tr.ID.String(),
+			Before: map[string]decimal.Decimal{
+				fromAcc.ID.String(): fromAcc.Balance,
+				toAcc.ID.String():   toAcc.Balance,
+			},
+			After: map[string]decimal.Decimal{
+				fromAcc.ID.String(): fromAcc.Balance.Sub(req.Amount),
+				toAcc.ID.String():   toAcc.Balance.Add(credited),
+			},
+			Details: details,
+		})
 	})
 }
 
 // пополнение счёта
-func (s *BankService) Deposit(req models.DepositRequest) error {
-	if req.Amount.LessOrEqual(decimal.Zero) {
-		return errors.New("сумма должна быть >0")
+func (s *BankService) Deposit(actor models.Actor, req models.DepositRequest, key *models.IdempotencyKey) (*models.Transaction, error) {
+	userID := actor.UserID
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("сумма должна быть >0")
 	}
-	return s.accountRepo.WithTx(func(tx repo.TxContext) error {
-		acc, err := s.accountRepo.GetByID(req.ToAccountID)
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, err
+	}
+	return idempotent(s, key, func(tx repo.TxContext) (*models.Transaction, error) {
+		acc, err := s.accountRepo.GetByIDForUpdateTx(tx, req.ToAccountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if err := s.authorizeAccount(userID, acc, models.AccessOperate); err != nil {
+			return nil, err
 		}
-		newBal := acc.Balance.Add(req.Amount)
-		if err := s.accountRepo.UpdateBalanceTx(tx, acc.ID, newBal); err != nil {
-			return err
+		if err := accountUsable(acc); err != nil {
+			return nil, err
+		}
+		if err := checkAmount(req.Amount, acc.Currency); err != nil {
+			return nil, err
 		}
 		tr := &models.Transaction{
 			From:      nil,
 			To:        &acc.ID,
 			Amount:    req.Amount,
-			Type:      "deposit",
+			Currency:  acc.Currency,
+			Type:      models.TxDeposit,
 			Note:      "пополнение счёта",
 			CreatedAt: time.Now(),
 		}
-		return s.transactionRepo.CreateTx(tx, tr)
+		// касса -> клиент
+		if err := s.post(tx, tr,
+			debit(models.SystemAccount(models.SystemCashIn, acc.Currency), req.Amount),
+			credit(acc.ID, req.Amount),
+		); err != nil {
+			return nil, err
+		}
+		return tr, s.auditTx(tx, actor, auditEntry{
+			Action:       "deposit.create",
+			ResourceType: "transaction",
+			ResourceID:   tr.ID.String(),
+			Before:       map[string]decimal.Decimal{acc.ID.String(): acc.Balance},
+			After:        map[string]decimal.Decimal{acc.ID.String(): acc.Balance.Add(req.Amount)},
+			Details:      map[string]string{"amount": req.Amount.String(), "currency": acc.Currency},
+		})
 	})
 }
 
 // оформление кредита и генерация графика
-func (s *BankService) ApplyCredit(userID uuid.UUID, req models.ApplyCreditRequest) (*models.Credit, []models.PaymentSchedule, error) {
-	if req.Principal.LessOrEqual(decimal.Zero) {
+// аннуитетный платёж: P*r*(1+r)^n / ((1+r)^n - 1), до копеек
+func annuityPayment(principal, monthlyRate decimal.Decimal, months int) decimal.Decimal {
+	pow := monthlyRate.Add(decimal.NewFromInt(1)).Pow(decimal.NewFromInt(int64(months)))
+	num := principal.Mul(monthlyRate).Mul(pow)
+	den := pow.Sub(decimal.NewFromInt(1))
+	return num.Div(den).Round(2)
+}
+
+// график платежей без CreditID. последний платёж добирает остаток от
+// округлений: тело по графику в сумме равно выданному, и портфель уходит в ноль
+func annuitySchedule(principal, monthlyRate, annuity decimal.Decimal, months int, firstDue time.Time) []models.PaymentSchedule {
+	schedules := make([]models.PaymentSchedule, 0, months)
+	remaining := principal
+	for i := 0; i < months; i++ {
+		interest := remaining.Mul(monthlyRate).Round(2)
+		principalPart := annuity.Sub(interest).Round(2)
+		amount := annuity
+		if i == months-1 {
+			principalPart = remaining
+			amount = principalPart.Add(interest)
+		}
+		remaining = remaining.Sub(principalPart).Round(2)
+		schedules = append(schedules, models.PaymentSchedule{
+			DueDate:   firstDue.AddDate(0, i, 0),
+			Amount:    amount,
+			Principal: principalPart,
+			Interest:  interest,
+		})
+	}
+	return schedules
+}
+
+func (s *BankService) ApplyCredit(actor models.Actor, req models.ApplyCreditRequest, key *models.IdempotencyKey) (*models.Credit, []models.PaymentSchedule, error) {
+	userID := actor.UserID
+	if req.Principal.LessThanOrEqual(decimal.Zero) {
 		return nil, nil, errors.New("сумма кредита должна быть >0")
 	}
 	if req.TermMonths <= 0 {
 		return nil, nil, errors.New("срок должен быть >0 месяцев")
 	}
-	rateF, err := fetchCBRRate(time.Now())
-	if err != nil || rateF <= 0 {
-		rateF = 0.12 // 12% (в мечтах)) по умолчанию
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, nil, err
 	}
-	annual := decimal.NewFromFloat(rateF)
+	// кредит оформляет только владелец счёта зачисления
+	acc, err := s.ownAccount(userID, req.AccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := accountUsable(acc); err != nil {
+		return nil, nil, err
+	}
+	// ставка берётся от ключевой ставки ЦБ, поэтому кредиты только в рублях
+	if acc.Currency != models.CurrencyRUB {
+		return nil, nil, ErrCreditCurrency
+	}
+	if err := checkAmount(req.Principal, acc.Currency); err != nil {
+		return nil, nil, err
+	}
+	kr, err := s.fetchCBRRate(time.Now())
+	if err != nil {
+		logrus.Warnf("ставка ЦБ недоступна, берём ставку по умолчанию: %v", err)
+	}
+	annual := kr.Rate
 	monthlyRate := annual.Div(decimal.NewFromInt(12))
 
-	pow := monthlyRate.Add(decimal.NewFromInt(1)).Pow(decimal.NewFromInt(int64(req.TermMonths)))
-	num := req.Principal.Mul(monthlyRate).Mul(pow)
-	den := pow.Sub(decimal.NewFromInt(1))
-	annuity := num.Div(den).Round(2)
+	annuity := annuityPayment(req.Principal, monthlyRate, req.TermMonths)
 
-	credit := &models.Credit{
+	cr := &models.Credit{
 		UserID:     userID,
 		AccountID:  req.AccountID,
 		Principal:  req.Principal,
+		Currency:   acc.Currency,
 		AnnualRate: annual,
+		RateSource: kr.Source,
 		TermMonths: req.TermMonths,
 		Remaining:  req.Principal,
 	}
 
-	schedules := make([]models.PaymentSchedule, 0, req.TermMonths)
-	nextDue := time.Now().AddDate(0, 1, 0)
-	remaining := req.Principal
+	if !kr.Date.IsZero() {
+		cr.RateDate = &kr.Date
+	}
 
-	// запускаем транзакцию
-	err = s.creditRepo.WithTx(func(tx repo.TxContext) error {
-		if err := s.creditRepo.CreateTx(tx, credit); err != nil {
-			return err
-		}
-		for i := 0; i < req.TermMonths; i++ {
-			interest := remaining.Mul(monthlyRate).Round(2)
-			principalPart := annuity.Sub(interest).Round(2)
-			remaining = remaining.Sub(principalPart).Round(2)
-			sched := &models.PaymentSchedule{
-				CreditID:  credit.ID,
-				DueDate:   nextDue,
-				Amount:    annuity,
-				Principal: principalPart,
-				Interest:  interest,
-			}
-			if err := s.scheduleRepo.CreateTx(tx, sched); err != nil {
-				return err
+	firstDue := time.Now().AddDate(0, 1, 0)
+
+	// запускаем транзакцию; состояние графика заводим внутри — её могут повторить
+	app, err := idempotent(s, key, func(tx repo.TxContext) (*models.CreditApplication, error) {
+		if err := s.creditRepo.CreateTx(tx, cr); err != nil {
+			return nil, err
+		}
+		schedules := annuitySchedule(req.Principal, monthlyRate, annuity, req.TermMonths, firstDue)
+		for i := range schedules {
+			schedules[i].CreditID = cr.ID
+			if err := s.scheduleRepo.CreateTx(tx, &schedules[i]); err != nil {
+				return nil, err
 			}
-			schedules = append(schedules, *sched)
-			nextDue = nextDue.AddDate(0, 1, 0)
 		}
-		return nil
+		// выдача: ссудный портфель -> счёт заёмщика
+		if err := s.post(tx, &models.Transaction{
+			To:        &cr.AccountID,
+			Amount:    cr.Principal,
+			Currency:  cr.Currency,
+			Type:      models.TxCreditDisbursement,
+			Note:      fmt.Sprintf("выдача кредита %s", cr.ID),
+			CreatedAt: time.Now(),
+		}, debit(models.SystemLoanPortfolio, cr.Principal), credit(cr.AccountID, cr.Principal)); err != nil {
+			return nil, err
+		}
+		if err := s.auditTx(tx, actor, auditEntry{
+			Action:       "credit.create",
+			ResourceType: "credit",
+			ResourceID:   cr.ID.String(),
+			After: map[string]interface{}{
+				"account_id":  cr.AccountID,
+				"principal":   cr.Principal,
+				"currency":    cr.Currency,
+				"annual_rate": cr.AnnualRate,
+				"rate_source": cr.RateSource,
+				"term_months": cr.TermMonths,
+				"annuity":     annuity,
+			},
+		}); err != nil {
+			return nil, err
+		}
+		return &models.CreditApplication{Credit: *cr, Schedule: schedules}, nil
 	})
 	if err != nil {
 		return nil, nil, err
 	}
-	return credit, schedules, nil
+	return &app.Credit, app.Schedule, nil
+}
+
+// ключевая ставка ЦБ на дату; при ошибке — ставка по умолчанию
+func (s *BankService) fetchCBRRate(on time.Time) (KeyRate, error) {
+	kr, err := s.cbr.KeyRate(on)
+	if err != nil || !kr.Rate.IsPositive() {
+		return KeyRate{
+			Rate:   decimal.NewFromFloat(0.12), // 12% (в мечтах)) по умолчанию
+			Source: RateSourceDefault,
+		}, err
+	}
+	return kr, nil
 }
 
 // список кредитов пользователя
@@ -366,7 +725,10 @@ func (s *BankService) GetCredits(userID uuid.UUID) ([]models.Credit, error) {
 }
 
 // график платежей по кредиту
-func (s *BankService) GetSchedule(creditID uuid.UUID) ([]models.PaymentSchedule, error) {
+func (s *BankService) GetSchedule(userID, creditID uuid.UUID) ([]models.PaymentSchedule, error) {
+	if _, err := s.authorizeCredit(userID, creditID); err != nil {
+		return nil, err
+	}
 	return s.scheduleRepo.GetByCreditID(creditID)
 }
 
@@ -377,36 +739,56 @@ func (s *BankService) ProcessScheduledPayments() error {
 	if err != nil {
 		return err
 	}
-	for _, sch := range dueList {
+	for _, due := range dueList {
 		err := s.accountRepo.WithTx(func(tx repo.TxContext) error {
+			// список читался вне транзакции: платёж мог уже списать
+			// другой прогон (тикер и POST /admin/scheduler/run)
+			sch, err := s.scheduleRepo.GetByIDForUpdateTx(tx, due.ID)
+			if err != nil {
+				return err
+			}
+			if sch.Paid {
+				return nil
+			}
 			cr, err := s.creditRepo.GetByID(sch.CreditID)
 			if err != nil {
 				return err
 			}
 
-			acc, err := s.accountRepo.GetByID(cr.AccountID)
+			acc, err := s.accountRepo.GetByIDForUpdateTx(tx, cr.AccountID)
 			if err != nil {
 				return err
 			}
+			if err := accountUsable(acc); err != nil {
+				logrus.Warnf("график %s: %v", sch.ID, err)
+				return nil
+			}
+			if err := withdrawable(acc, time.Now()); err != nil {
+				logrus.Warnf("график %s: %v", sch.ID, err)
+				return nil
+			}
 			if acc.Balance.LessThan(sch.Amount) {
 				logrus.Warnf("нехватка средств для графика %s", sch.ID)
 				return nil
 			}
-			// списываем баланс
-			newBal := acc.Balance.Sub(sch.Amount)
-			if err := s.accountRepo.UpdateBalanceTx(tx, acc.ID, newBal); err != nil {
-				return err
-			}
-			// записываем транзакцию
 			tr := &models.Transaction{
 				From:      &acc.ID,
 				To:        nil,
 				Amount:    sch.Amount,
-				Type:      "credit_payment",
+				Currency:  acc.Currency,
+				Type:      models.TxCreditPayment,
 				Note:      fmt.Sprintf("очередной платёж по кредиту %s", sch.CreditID),
 				CreatedAt: time.Now(),
 			}
-			if err := s.transactionRepo.CreateTx(tx, tr); err != nil {
+			// платёж гасит тело кредита и идёт в процентный доход
+			legs := []models.Posting{debit(acc.ID, sch.Amount)}
+			if sch.Principal.IsPositive() {
+				legs = append(legs, credit(models.SystemLoanPortfolio, sch.Principal))
+			}
+			if sch.Interest.IsPositive() {
+				legs = append(legs, credit(models.SystemLoanInterestIncome, sch.Interest))
+			}
+			if err := s.post(tx, tr, legs...); err != nil {
 				return err
 			}
 			// помечаем как оплачено
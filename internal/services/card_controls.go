@@ -0,0 +1,230 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// страна банка: оплата у мерчанта из другой страны — зарубежная
+const homeCountry = "RU"
+
+// коды отказа по ограничениям карты
+const (
+	DeclinePerTxLimit    = "limit_per_transaction"
+	DeclineDailyLimit    = "limit_daily"
+	DeclineMonthlyLimit  = "limit_monthly"
+	DeclineMCCBlocked    = "mcc_blocked"
+	DeclineMCCNotAllowed = "mcc_not_allowed"
+	DeclineOnline        = "online_disabled"
+	DeclineForeign       = "foreign_disabled"
+)
+
+// отказ по ограничениям, которые владелец счёта поставил на карту
+type CardDeclineError struct {
+	Code    string
+	Message string
+}
+
+func (e *CardDeclineError) Error() string { return e.Message }
+
+func decline(code, msg string) error {
+	return &CardDeclineError{Code: code, Message: msg}
+}
+
+var (
+	ErrMCCFormat     = errors.New("MCC — четыре цифры")
+	ErrCountryFormat = errors.New("country — двухбуквенный код страны ISO 3166")
+)
+
+func validMCC(mcc string) bool {
+	if len(mcc) != 4 {
+		return false
+	}
+	for _, c := range mcc {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validCountry(c string) bool {
+	if len(c) != 2 {
+		return false
+	}
+	for _, r := range strings.ToUpper(c) {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// ограничения и траты карты; видны всем, кто видит счёт
+func (s *BankService) GetCardControls(userID, cardID uuid.UUID) (*models.CardControls, error) {
+	card, err := s.cardRepo.GetByID(cardID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.authorizeAccountID(userID, card.AccountID, models.AccessView); err != nil {
+		if errors.Is(err, ErrForbidden) {
+			return nil, ErrCardNotFound
+		}
+		return nil, err
+	}
+	c, err := s.cardRepo.GetControls(card.ID)
+	if err != nil {
+		return nil, err
+	}
+	today := moscowDay(time.Now())
+	if c.SpentToday, err = s.cardRepo.Spent(card.ID, today, today); err != nil {
+		return nil, err
+	}
+	if c.SpentMonth, err = s.cardRepo.Spent(card.ID, monthlyDay(today.Year(), today.Month(), 1), today); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ограничения ставит только владелец счёта: делегат, которому выдали
+// карту, снять их сам не может
+func (s *BankService) SetCardControls(actor models.Actor, cardID uuid.UUID, req models.CardControlsRequest) (*models.CardControls, error) {
+	c := &models.CardControls{
+		CardID:         cardID,
+		PerTxLimit:     req.PerTxLimit,
+		DailyLimit:     req.DailyLimit,
+		MonthlyLimit:   req.MonthlyLimit,
+		OnlineEnabled:  req.OnlineEnabled == nil || *req.OnlineEnabled,
+		ForeignEnabled: req.ForeignEnabled == nil || *req.ForeignEnabled,
+	}
+	var err error
+	if c.AllowedMCC, err = normalizeMCCs(req.AllowedMCC); err != nil {
+		return nil, err
+	}
+	if c.BlockedMCC, err = normalizeMCCs(req.BlockedMCC); err != nil {
+		return nil, err
+	}
+	err = s.cardRepo.WithTx(func(tx repo.TxContext) error {
+		card, acc, err := s.lockOwnCard(tx, actor.UserID, cardID)
+		if err != nil {
+			return err
+		}
+		if acc.UserID != actor.UserID {
+			return ErrForbidden
+		}
+		if card.Status == models.CardClosed {
+			return ErrCardClosed
+		}
+		for _, l := range []*decimal.Decimal{c.PerTxLimit, c.DailyLimit, c.MonthlyLimit} {
+			if l == nil {
+				continue
+			}
+			if err := checkAmount(*l, acc.Currency); err != nil {
+				return fmt.Errorf("лимит: %w", err)
+			}
+		}
+		before, err := s.cardRepo.GetControlsTx(tx, card.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.cardRepo.UpsertControlsTx(tx, c); err != nil {
+			return err
+		}
+		return s.auditTx(tx, actor, auditEntry{
+			Action:       "card.controls",
+			ResourceType: "card",
+			ResourceID:   card.ID.String(),
+			Before:       before,
+			After:        c,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func normalizeMCCs(list []string) ([]string, error) {
+	out := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, m := range list {
+		m = strings.TrimSpace(m)
+		if !validMCC(m) {
+			return nil, fmt.Errorf("%w: %q", ErrMCCFormat, m)
+		}
+		if !seen[m] {
+			seen[m] = true
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// проверяет оплату по ограничениям карты и учитывает её в тратах.
+// Вызывается в транзакции оплаты под блокировкой карты: параллельные
+// оплаты не превысят лимит вместе
+func (s *BankService) applyCardControls(tx repo.TxContext, cardID uuid.UUID, req models.PaymentRequest, now time.Time) error {
+	c, err := s.cardRepo.GetControlsTx(tx, cardID)
+	if err != nil {
+		return err
+	}
+	if !req.CardPresent && !c.OnlineEnabled {
+		return decline(DeclineOnline, "оплата в интернете по карте запрещена")
+	}
+	country := strings.ToUpper(strings.TrimSpace(req.Country))
+	if country != "" && country != homeCountry && !c.ForeignEnabled {
+		return decline(DeclineForeign, "оплата за границей по карте запрещена")
+	}
+	mcc := strings.TrimSpace(req.MCC)
+	if contains(c.BlockedMCC, mcc) {
+		return decline(DeclineMCCBlocked, "оплата в этой категории по карте запрещена")
+	}
+	if len(c.AllowedMCC) > 0 && !contains(c.AllowedMCC, mcc) {
+		return decline(DeclineMCCNotAllowed, "по карте разрешены только отдельные категории покупок")
+	}
+	if c.PerTxLimit != nil && req.Amount.GreaterThan(*c.PerTxLimit) {
+		return decline(DeclinePerTxLimit, fmt.Sprintf("превышен лимит на одну покупку: %s", c.PerTxLimit))
+	}
+
+	today := moscowDay(now)
+	if c.DailyLimit != nil {
+		spent, err := s.cardRepo.SpentTx(tx, cardID, today, today)
+		if err != nil {
+			return err
+		}
+		if spent.Add(req.Amount).GreaterThan(*c.DailyLimit) {
+			return decline(DeclineDailyLimit, fmt.Sprintf("превышен дневной лимит: %s, потрачено %s", c.DailyLimit, spent))
+		}
+	}
+	if c.MonthlyLimit != nil {
+		spent, err := s.cardRepo.SpentTx(tx, cardID, monthlyDay(today.Year(), today.Month(), 1), today)
+		if err != nil {
+			return err
+		}
+		if spent.Add(req.Amount).GreaterThan(*c.MonthlyLimit) {
+			return decline(DeclineMonthlyLimit, fmt.Sprintf("превышен месячный лимит: %s, потрачено %s", c.MonthlyLimit, spent))
+		}
+	}
+	return s.cardRepo.AddSpendTx(tx, cardID, today, req.Amount)
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
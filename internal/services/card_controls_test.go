@@ -0,0 +1,71 @@
+package services_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/shopspring/decimal"
+)
+
+// две оплаты по 600 при дневном лимите 1000 идут одновременно: пройти
+// может только одна, траты считаются под блокировкой карты
+func TestCardDailyLimitConcurrent(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	acc := env.Account(t, u, "10000")
+	card, err := env.Svc.GenerateCard(testutil.Actor(u), acc.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := decimal.NewFromInt(1000)
+	if _, err := env.Svc.SetCardControls(testutil.Actor(u), card.ID, models.CardControlsRequest{DailyLimit: &limit}); err != nil {
+		t.Fatal(err)
+	}
+	d := cardDetails(t, env, u, card.ID)
+
+	const payments = 2
+	errs := make([]error, payments)
+	var wg sync.WaitGroup
+	for i := 0; i < payments; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = env.Svc.PayWithCard(testutil.Actor(u), onlinePayment(d, card.CVV, "600"), nil)
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, err := range errs {
+		var de *services.CardDeclineError
+		switch {
+		case err == nil:
+			ok++
+		case errors.As(err, &de) && de.Code == services.DeclineDailyLimit:
+		default:
+			t.Errorf("оплата: %v, ждали успех или %s", err, services.DeclineDailyLimit)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("прошло оплат: %d, ждали 1", ok)
+	}
+	c, err := env.Svc.GetCardControls(u.ID, card.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.SpentToday.Equal(decimal.NewFromInt(600)) {
+		t.Errorf("потрачено за день %s, ждали 600", c.SpentToday)
+	}
+	var bal decimal.Decimal
+	if err := env.DB.Get(&bal, `SELECT balance FROM accounts WHERE id=$1`, acc.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !bal.Equal(decimal.NewFromInt(9400)) {
+		t.Errorf("остаток %s, ждали 9400", bal)
+	}
+}
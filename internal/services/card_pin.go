@@ -0,0 +1,179 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ключ проверки PIN выводится из общего секрета, как ключи TOTP и кодов восстановления
+const pinKeyPurpose = "card-pin"
+
+var (
+	ErrPINFormat     = errors.New("PIN — от 4 до 6 цифр")
+	ErrWeakPIN       = errors.New("слишком простой PIN: не используйте одинаковые цифры, последовательности и повторы")
+	ErrPINAlreadySet = errors.New("PIN уже установлен, смените его через PUT")
+	ErrPINNotSet     = errors.New("PIN не установлен")
+	ErrPINUnchanged  = errors.New("новый PIN совпадает со старым")
+	ErrWrongPIN      = errors.New("неверный PIN")
+	ErrPINLocked     = errors.New("неверный PIN введён слишком много раз, карта заблокирована")
+)
+
+func validatePIN(pin string) error {
+	if len(pin) < 4 || len(pin) > 6 {
+		return ErrPINFormat
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return ErrPINFormat
+		}
+	}
+	if weakPIN(pin) {
+		return ErrWeakPIN
+	}
+	return nil
+}
+
+// 0000, 1234, 9876, 1212, 123123 и подобные
+func weakPIN(pin string) bool {
+	asc, desc := true, true
+	for i := 1; i < len(pin); i++ {
+		d := int(pin[i]) - int(pin[i-1])
+		asc = asc && d == 1
+		desc = desc && d == -1
+	}
+	if asc || desc {
+		return true
+	}
+	// повтор короткого фрагмента; период 1 — все цифры одинаковые
+	for p := 1; p <= len(pin)/2; p++ {
+		if len(pin)%p == 0 && strings.Repeat(pin[:p], len(pin)/p) == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// «естественный» PIN карты: HMAC от id карты, децимализованный по
+// таблице 0123456789012345, как в IBM 3624
+func (s *BankService) naturalPIN(cardID uuid.UUID, n int) string {
+	h := ComputeHMAC(cardID.String(), deriveKey(s.cfg.HMACSecret, pinKeyPurpose))
+	out := make([]byte, n)
+	for i := 0; i < n; i++ {
+		c := h[i]
+		if c >= 'a' {
+			c = '0' + (c-'a'+10)%10
+		}
+		out[i] = c
+	}
+	return string(out)
+}
+
+// смещение — поразрядная разность PIN и естественного PIN по модулю 10
+func (s *BankService) pinOffset(cardID uuid.UUID, pin string) string {
+	natural := s.naturalPIN(cardID, len(pin))
+	out := make([]byte, len(pin))
+	for i := range pin {
+		out[i] = '0' + (pin[i]-natural[i]+10)%10
+	}
+	return string(out)
+}
+
+func (s *BankService) pinMatches(card *models.Card, pin string) bool {
+	if card.PINOffset == nil || len(pin) != len(*card.PINOffset) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(s.pinOffset(card.ID, pin)), []byte(*card.PINOffset)) == 1
+}
+
+// первая установка PIN владельцем или делегатом с правом операций
+func (s *BankService) SetCardPIN(actor models.Actor, cardID uuid.UUID, req models.SetPINRequest) error {
+	if err := validatePIN(req.PIN); err != nil {
+		return err
+	}
+	return s.cardRepo.WithTx(func(tx repo.TxContext) error {
+		card, _, err := s.lockOwnCard(tx, actor.UserID, cardID)
+		if err != nil {
+			return err
+		}
+		if err := cardUsable(card, time.Now()); err != nil {
+			return err
+		}
+		if card.PINOffset != nil {
+			return ErrPINAlreadySet
+		}
+		if err := s.cardRepo.SetPINOffsetTx(tx, card.ID, s.pinOffset(card.ID, req.PIN)); err != nil {
+			return err
+		}
+		return s.auditTx(tx, actor, auditEntry{Action: "card.pin_set", ResourceType: "card", ResourceID: card.ID.String()})
+	})
+}
+
+// смена PIN по старому; неверный старый PIN идёт в счётчик попыток
+func (s *BankService) ChangeCardPIN(actor models.Actor, cardID uuid.UUID, req models.ChangePINRequest) error {
+	if err := validatePIN(req.NewPIN); err != nil {
+		return err
+	}
+	if req.NewPIN == req.OldPIN {
+		return ErrPINUnchanged
+	}
+	err := s.cardRepo.WithTx(func(tx repo.TxContext) error {
+		card, _, err := s.lockOwnCard(tx, actor.UserID, cardID)
+		if err != nil {
+			return err
+		}
+		if err := cardUsable(card, time.Now()); err != nil {
+			return err
+		}
+		if card.PINOffset == nil {
+			return ErrPINNotSet
+		}
+		if !s.pinMatches(card, req.OldPIN) {
+			return ErrWrongPIN
+		}
+		if err := s.cardRepo.SetPINOffsetTx(tx, card.ID, s.pinOffset(card.ID, req.NewPIN)); err != nil {
+			return err
+		}
+		return s.auditTx(tx, actor, auditEntry{Action: "card.pin_change", ResourceType: "card", ResourceID: card.ID.String()})
+	})
+	// попытку считаем вне откатившейся транзакции
+	if errors.Is(err, ErrWrongPIN) && s.cardAttemptFailed(actor, cardID, checkPIN) {
+		return ErrPINLocked
+	}
+	return err
+}
+
+// проверка PIN при оплате с карты в руках; после CARD_PIN_MAX_ATTEMPTS
+// неверных PIN подряд карта блокируется банком. Попытки тратит и разные
+// ответы получает только тот, кто вправе платить картой; остальным — тот
+// же отказ, что и при неверных реквизитах
+func (s *BankService) verifyPIN(actor models.Actor, card *models.Card, pin string) error {
+	if _, err := s.authorizeAccountID(actor.UserID, card.AccountID, models.AccessOperate); err != nil {
+		if errors.Is(err, ErrForbidden) || errors.Is(err, ErrAccountNotFound) {
+			return ErrCardDeclined
+		}
+		return err
+	}
+	if card.PINOffset == nil {
+		return ErrPINNotSet
+	}
+	if !s.pinMatches(card, pin) {
+		if s.cardAttemptFailed(actor, card.ID, checkPIN) {
+			return ErrPINLocked
+		}
+		return ErrWrongPIN
+	}
+	if card.PINFailures > 0 {
+		if err := s.cardRepo.ResetPINFailures(card.ID); err != nil {
+			logrus.Warnf("сброс попыток PIN карты %s: %v", card.ID, err)
+		}
+	}
+	return nil
+}
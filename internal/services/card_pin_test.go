@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/shopspring/decimal"
+)
+
+// после CARD_PIN_MAX_ATTEMPTS неверных PIN подряд банк блокирует карту:
+// верный PIN уже не помогает, клиент сам блокировку не снимает
+func TestCardPINAutoBlock(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	acc := env.Account(t, u, "1000")
+	card, err := env.Svc.GenerateCard(testutil.Actor(u), acc.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Svc.SetCardPIN(testutil.Actor(u), card.ID, models.SetPINRequest{PIN: "4829"}); err != nil {
+		t.Fatal(err)
+	}
+	d := cardDetails(t, env, u, card.ID)
+	pay := func(pin string) error {
+		_, err := env.Svc.PayWithCard(testutil.Actor(u), models.PaymentRequest{
+			CardNumber: d.Number, Expiry: d.Expiry, CardPresent: true, PIN: pin,
+			Amount: decimal.NewFromInt(10), Merchant: "shop",
+		}, nil)
+		return err
+	}
+
+	if err := pay("4829"); err != nil {
+		t.Fatalf("оплата с верным PIN: %v", err)
+	}
+	max := env.Cfg.CardPINMaxAttempts
+	for i := 1; i < max; i++ {
+		if err := pay("7391"); !errors.Is(err, services.ErrWrongPIN) {
+			t.Fatalf("неверный PIN, попытка %d: %v, ждали ErrWrongPIN", i, err)
+		}
+	}
+	if err := pay("7391"); !errors.Is(err, services.ErrPINLocked) {
+		t.Fatalf("попытка %d: %v, ждали ErrPINLocked", max, err)
+	}
+	if err := pay("4829"); !errors.Is(err, services.ErrCardBlocked) {
+		t.Errorf("верный PIN после блокировки: %v, ждали ErrCardBlocked", err)
+	}
+	if _, err := env.Svc.UnblockCard(testutil.Actor(u), card.ID); !errors.Is(err, services.ErrCardBankBlock) {
+		t.Errorf("разблокировка клиентом: %v, ждали ErrCardBankBlock", err)
+	}
+}
@@ -0,0 +1,77 @@
+package services_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+)
+
+// реквизиты карты хранятся под PGP и расшифровываются закрытым ключом
+func TestPGPRoundTrip(t *testing.T) {
+	pub, priv := testutil.PGPKeys(t)
+	enc, err := services.EncryptPGP([]byte("4276380012345678"), pub)
+	if err != nil {
+		t.Fatalf("шифрование: %v", err)
+	}
+	dec, err := services.DecryptPGP(enc, priv, "")
+	if err != nil {
+		t.Fatalf("расшифровка: %v", err)
+	}
+	if string(dec) != "4276380012345678" {
+		t.Fatalf("расшифровано %q", dec)
+	}
+	if _, err := services.DecryptPGP(enc, filepath.Join(t.TempDir(), "none.asc"), ""); !errors.Is(err, services.ErrPGPMissingKeys) {
+		t.Errorf("без закрытого ключа: %v, ждали ErrPGPMissingKeys", err)
+	}
+}
+
+// полный номер совпадает с маской из списка карт, срок — с датой
+// окончания; step-up токен открывает реквизиты один раз и только владельцу
+func TestRevealCardDetails(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u, other := env.User(t), env.User(t)
+	acc := env.Account(t, u, "0")
+	card, err := env.Svc.GenerateCard(testutil.Actor(u), acc.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := env.Svc.StepUp(testutil.Actor(u), models.StepUpRequest{Password: testutil.Password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := env.Svc.RevealCardDetails(testutil.Actor(u), card.ID, st.Token)
+	if err != nil {
+		t.Fatalf("реквизиты: %v", err)
+	}
+	if card.MaskedPAN == nil || len(d.Number) != 16 ||
+		!strings.HasPrefix(*card.MaskedPAN, d.Number[:6]) || !strings.HasSuffix(*card.MaskedPAN, d.Number[12:]) {
+		t.Errorf("номер %s не совпадает с маской %v", d.Number, card.MaskedPAN)
+	}
+	if want := card.ExpiresOn.Format("01/06"); d.Expiry != want {
+		t.Errorf("срок %s, ждали %s", d.Expiry, want)
+	}
+	if _, err := env.Svc.RevealCardDetails(testutil.Actor(u), card.ID, st.Token); !errors.Is(err, services.ErrInvalidStepUp) {
+		t.Errorf("повтор токена: %v, ждали ErrInvalidStepUp", err)
+	}
+
+	otherStepUp, err := env.Svc.StepUp(testutil.Actor(other), models.StepUpRequest{Password: testutil.Password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Svc.RevealCardDetails(testutil.Actor(other), card.ID, otherStepUp.Token); err == nil {
+		t.Error("чужая карта раскрыта")
+	}
+	// токен владельца не годится другому пользователю
+	st, err = env.Svc.StepUp(testutil.Actor(u), models.StepUpRequest{Password: testutil.Password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Svc.RevealCardDetails(testutil.Actor(other), card.ID, st.Token); !errors.Is(err, services.ErrInvalidStepUp) {
+		t.Errorf("чужой step-up токен: %v, ждали ErrInvalidStepUp", err)
+	}
+}
@@ -0,0 +1,507 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrCardExpired    = errors.New("срок действия карты истёк")
+	ErrCardClosed     = errors.New("карта закрыта")
+	ErrCardBankBlock  = errors.New("карту заблокировал банк, обратитесь в поддержку")
+	ErrCardReissued   = errors.New("карта уже перевыпущена")
+	ErrCardTransition = errors.New("недопустимая смена статуса карты")
+	// одна ошибка на неверный номер, срок и CVV: не подсказываем, что именно не так
+	ErrCardDeclined = errors.New("оплата отклонена: проверьте реквизиты карты")
+	ErrRevealLimit  = errors.New("слишком часто: реквизиты карт можно смотреть не больше CARD_REVEAL_PER_HOUR раз в час")
+)
+
+// оплатить можно только активной картой с неистёкшим сроком:
+// ночной шедулер мог ещё не погасить карту
+func cardUsable(card *models.Card, now time.Time) error {
+	switch card.Status {
+	case models.CardActive:
+		if moscowDay(now).After(card.ExpiresOn) {
+			return ErrCardExpired
+		}
+		return nil
+	case models.CardExpired:
+		return ErrCardExpired
+	case models.CardClosed:
+		return ErrCardClosed
+	default:
+		return ErrCardBlocked
+	}
+}
+
+// допустимые переходы статуса; by — кто меняет (клиент или банк)
+func cardTransition(card *models.Card, to, by string) error {
+	from := card.Status
+	ok := false
+	switch to {
+	case models.CardTempBlocked:
+		ok = from == models.CardActive
+	case models.CardActive:
+		ok = from == models.CardTempBlocked
+		// блокировку банка клиент сам не снимает
+		if ok && by == models.BlockedByCustomer && card.BlockedBy != nil && *card.BlockedBy == models.BlockedByBank {
+			return ErrCardBankBlock
+		}
+		if ok && moscowDay(time.Now()).After(card.ExpiresOn) {
+			return ErrCardExpired
+		}
+	case models.CardPermBlocked:
+		ok = from == models.CardActive || from == models.CardTempBlocked
+	case models.CardClosed:
+		ok = from != models.CardClosed
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s -> %s", ErrCardTransition, from, to)
+	}
+	return nil
+}
+
+// выпускает реквизиты новой карты; в БД — только шифротексты и хеши.
+// CVV возвращается отдельно: клиент увидит его один раз, в ответе на выпуск
+func (s *BankService) newCard(accountID uuid.UUID) (*models.Card, string, error) {
+	cardNum := generateCardNumber()
+	expM, expY := generateExpiryDate()
+	cvv := generateCVV()
+
+	numEnc, err := EncryptPGP([]byte(cardNum), s.cfg.PGPPublicKeyPath)
+	if err != nil {
+		return nil, "", err
+	}
+	expiryStr := fmt.Sprintf("%02d/%02d", expM, expY%100)
+	expEnc, err := EncryptPGP([]byte(expiryStr), s.cfg.PGPPublicKeyPath)
+	if err != nil {
+		return nil, "", err
+	}
+	cvvHash, err := HashCVV(cvv)
+	if err != nil {
+		return nil, "", err
+	}
+	masked := maskPAN(cardNum)
+	return &models.Card{
+		AccountID: accountID,
+		MaskedPAN: &masked,
+		NumberEnc: numEnc,
+		ExpiryEnc: expEnc,
+		CVVHash:   cvvHash,
+		HMAC:      ComputeHMAC(cardNum, []byte(s.cfg.HMACSecret)),
+		Status:    models.CardActive,
+		// карта действует до конца месяца, указанного на ней
+		ExpiresOn: monthlyDay(expY, time.Month(expM), 31),
+	}, cvv, nil
+}
+
+// CVV в ответе на выпуск; повтор запроса с тем же ключом идемпотентности
+// получает сохранённый ответ, где CVV нет, — показываем маску
+func issuedCVV(key *models.IdempotencyKey, cvv string) string {
+	if key != nil && key.Replayed {
+		return "***"
+	}
+	return cvv
+}
+
+// 427600******1234
+func maskPAN(pan string) string {
+	if len(pan) < 10 {
+		return strings.Repeat("*", len(pan))
+	}
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
+
+// полный номер и срок по одноразовому step-up токену; в аудит реквизиты не пишутся
+func (s *BankService) RevealCardDetails(actor models.Actor, cardID uuid.UUID, stepUpToken string) (*models.CardDetails, error) {
+	jti, err := s.parseStepUpToken(stepUpToken, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var details *models.CardDetails
+	err = s.cardRepo.WithTx(func(tx repo.TxContext) error {
+		card, _, err := s.lockOwnCard(tx, actor.UserID, cardID)
+		if err != nil {
+			return err
+		}
+		if card.Status == models.CardClosed {
+			return ErrCardClosed
+		}
+		n, err := s.cardRepo.CountRevealsSinceTx(tx, actor.UserID, time.Now().Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if n >= s.cfg.CardRevealPerHour {
+			return ErrRevealLimit
+		}
+		if err := s.cardRepo.RecordRevealTx(tx, card.ID, actor.UserID, jti); err != nil {
+			if repo.IsUniqueViolation(err) {
+				return ErrInvalidStepUp
+			}
+			return err
+		}
+		pan, expiry, err := s.decryptCard(card)
+		if err != nil {
+			return err
+		}
+		details = &models.CardDetails{CardID: card.ID, Number: pan, Expiry: expiry}
+		return s.auditTx(tx, actor, auditEntry{
+			Action:       "card.reveal",
+			ResourceType: "card",
+			ResourceID:   card.ID.String(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+func (s *BankService) decryptCard(card *models.Card) (pan, expiry string, err error) {
+	num, err := DecryptPGP(card.NumberEnc, s.cfg.PGPPrivateKeyPath, s.cfg.PGPPrivatePass)
+	if err != nil {
+		return "", "", fmt.Errorf("расшифровка номера карты: %w", err)
+	}
+	exp, err := DecryptPGP(card.ExpiryEnc, s.cfg.PGPPrivateKeyPath, s.cfg.PGPPrivatePass)
+	if err != nil {
+		return "", "", fmt.Errorf("расшифровка срока карты: %w", err)
+	}
+	return string(num), string(exp), nil
+}
+
+// дозаполняет карты, выпущенные до маскированного номера: маска, HMAC
+// по номеру вместо номера со сроком и точный срок. Без закрытого ключа
+// ничего не делает — такие карты перейдут на новый HMAC при первой оплате
+func (s *BankService) BackfillCardData() (int, error) {
+	done := 0
+	for {
+		cards, err := s.cardRepo.ListWithoutMaskedPAN(100)
+		if err != nil {
+			return done, err
+		}
+		if len(cards) == 0 {
+			return done, nil
+		}
+		for i := range cards {
+			c := &cards[i]
+			pan, expiry, err := s.decryptCard(c)
+			if errors.Is(err, ErrPGPMissingKeys) {
+				return done, nil
+			}
+			if err != nil {
+				return done, fmt.Errorf("карта %s: %w", c.ID, err)
+			}
+			masked := maskPAN(pan)
+			c.MaskedPAN, c.HMAC = &masked, ComputeHMAC(pan, []byte(s.cfg.HMACSecret))
+			if exp, err := time.Parse("01/06", expiry); err == nil {
+				c.ExpiresOn = monthlyDay(exp.Year(), exp.Month(), 31)
+			}
+			if err := s.cardRepo.SetDecryptedData(c); err != nil {
+				return done, err
+			}
+			done++
+		}
+	}
+}
+
+// находит карту по номеру и сверяет срок и CVV (с картой в руках — только
+// срок). Неверный срок тоже считается неудачной попыткой, иначе его можно
+// подбирать отдельно. Попытки считаются только у тех, кто вправе платить
+// картой: иначе любой, зная номер, заблокировал бы чужую карту
+func (s *BankService) verifyCard(actor models.Actor, req models.PaymentRequest) (*models.Card, error) {
+	pan := strings.ReplaceAll(req.CardNumber, " ", "")
+	expiry := strings.TrimSpace(req.Expiry)
+	exp, expErr := time.Parse("01/06", expiry)
+
+	card, err := s.cardRepo.GetByHMAC(ComputeHMAC(pan, []byte(s.cfg.HMACSecret)))
+	legacy := false
+	if errors.Is(err, sql.ErrNoRows) && expErr == nil {
+		// карты до перехода на HMAC по номеру: старое значение включало срок
+		card, err = s.cardRepo.GetByHMAC(ComputeHMAC(pan+expiry, []byte(s.cfg.HMACSecret)))
+		legacy = err == nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCardDeclined
+	}
+	if err != nil {
+		return nil, err
+	}
+	// чужая карта неотличима от несуществующей и неверных реквизитов
+	if _, err := s.authorizeAccountID(actor.UserID, card.AccountID, models.AccessOperate); err != nil {
+		if errors.Is(err, ErrForbidden) || errors.Is(err, ErrAccountNotFound) {
+			return nil, ErrCardDeclined
+		}
+		return nil, err
+	}
+	if legacy {
+		// срок подтверждён совпадением старого HMAC
+		masked := maskPAN(pan)
+		card.MaskedPAN, card.HMAC = &masked, ComputeHMAC(pan, []byte(s.cfg.HMACSecret))
+		card.ExpiresOn = monthlyDay(exp.Year(), exp.Month(), 31)
+		if err := s.cardRepo.SetDecryptedData(card); err != nil {
+			logrus.Warnf("пересчёт HMAC карты %s: %v", card.ID, err)
+		}
+	}
+
+	// с картой в руках CVV не вводится, вместо него проверяется PIN
+	if expErr != nil || exp.Year() != card.ExpiresOn.Year() || exp.Month() != card.ExpiresOn.Month() ||
+		(!req.CardPresent && !CheckCVVHash(req.CVV, card.CVVHash)) {
+		s.cardAttemptFailed(actor, card.ID, checkCardData)
+		return nil, ErrCardDeclined
+	}
+	if card.CVVFailures > 0 {
+		if err := s.cardRepo.ResetCVVFailures(card.ID); err != nil {
+			logrus.Warnf("сброс попыток CVV карты %s: %v", card.ID, err)
+		}
+	}
+	return card, nil
+}
+
+// что проверялось при неудачной попытке: у реквизитов и PIN свои счётчики
+type cardCheck int
+
+const (
+	checkCardData cardCheck = iota
+	checkPIN
+)
+
+// считает неудачную попытку; на CARD_CVV_MAX_ATTEMPTS (CARD_PIN_MAX_ATTEMPTS)
+// карта блокируется банком, снять блокировку может только бэк-офис.
+// true — карта заблокирована этой попыткой
+func (s *BankService) cardAttemptFailed(actor models.Actor, cardID uuid.UUID, check cardCheck) bool {
+	var blocked *models.Card
+	reason := "превышено число попыток ввода реквизитов"
+	if check == checkPIN {
+		reason = "превышено число попыток ввода PIN"
+	}
+	err := s.cardRepo.WithTx(func(tx repo.TxContext) error {
+		blocked = nil
+		card, err := s.cardRepo.GetByIDForUpdateTx(tx, cardID)
+		if err != nil {
+			return err
+		}
+		var n, max int
+		if check == checkPIN {
+			card.PINFailures, err = s.cardRepo.AddPINFailureTx(tx, card.ID)
+			n, max = card.PINFailures, s.cfg.CardPINMaxAttempts
+		} else {
+			card.CVVFailures, err = s.cardRepo.AddCVVFailureTx(tx, card.ID)
+			n, max = card.CVVFailures, s.cfg.CardCVVMaxAttempts
+		}
+		if err != nil {
+			return err
+		}
+		if n < max || card.Status != models.CardActive {
+			return nil
+		}
+		blocked = card
+		return s.setCardStatus(tx, actor, card, models.CardTempBlocked, models.BlockedByBank, reason, "card.auto_block")
+	})
+	if err != nil {
+		logrus.Errorf("неудачная попытка по карте %s: %v", cardID, err)
+		return false
+	}
+	if blocked != nil {
+		go s.notifyCardAutoBlocked(blocked, reason)
+	}
+	return blocked != nil
+}
+
+func (s *BankService) notifyCardAutoBlocked(card *models.Card, reason string) {
+	acc, err := s.accountRepo.GetByID(card.AccountID)
+	if err != nil {
+		return
+	}
+	u, err := s.userRepo.GetByID(acc.UserID)
+	if err != nil {
+		return
+	}
+	if err := sendEmailNotification(
+		s.cfg,
+		u.Email,
+		"Карта заблокирована",
+		fmt.Sprintf("Здравствуйте, %s!\n\nКарта к счёту %s заблокирована: %s. "+
+			"Если это были не вы, перевыпустите карту; чтобы снять блокировку, обратитесь в поддержку.",
+			u.Username, acc.Number, reason),
+	); err != nil {
+		logrus.Warnf("письмо о блокировке карты %s: %v", card.ID, err)
+	}
+}
+
+// карта под блокировкой строки и счёт с проверкой доступа
+func (s *BankService) lockOwnCard(tx repo.TxContext, userID, cardID uuid.UUID) (*models.Card, *models.Account, error) {
+	card, err := s.cardRepo.GetByIDForUpdateTx(tx, cardID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrCardNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	acc, err := s.accountRepo.GetByIDForUpdateTx(tx, card.AccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.authorizeAccount(userID, acc, models.AccessOperate); err != nil {
+		// чужая карта выглядит как несуществующая
+		if errors.Is(err, ErrForbidden) {
+			return nil, nil, ErrCardNotFound
+		}
+		return nil, nil, err
+	}
+	return card, acc, nil
+}
+
+// смена статуса карты клиентом или банком с записью в аудит
+func (s *BankService) setCardStatus(tx repo.TxContext, actor models.Actor, card *models.Card, to, by, reason, action string) error {
+	if err := cardTransition(card, to, by); err != nil {
+		return err
+	}
+	before := card.Status
+	card.Status, card.StatusReason, card.BlockedBy = to, reason, nil
+	if to == models.CardTempBlocked {
+		card.BlockedBy = &by
+	}
+	// разблокированной карте — новые попытки ввода CVV и PIN
+	if to == models.CardActive {
+		card.CVVFailures, card.PINFailures = 0, 0
+	}
+	if err := s.cardRepo.SetStatusTx(tx, card); err != nil {
+		return err
+	}
+	return s.auditTx(tx, actor, auditEntry{
+		Action:       action,
+		ResourceType: "card",
+		ResourceID:   card.ID.String(),
+		Before:       map[string]string{"status": before},
+		After:        map[string]string{"status": to},
+		Details:      map[string]string{"reason": reason, "by": by},
+	})
+}
+
+func (s *BankService) customerSetCardStatus(actor models.Actor, cardID uuid.UUID, to, reason string) (*models.Card, error) {
+	var card *models.Card
+	err := s.cardRepo.WithTx(func(tx repo.TxContext) error {
+		var err error
+		if card, _, err = s.lockOwnCard(tx, actor.UserID, cardID); err != nil {
+			return err
+		}
+		return s.setCardStatus(tx, actor, card, to, models.BlockedByCustomer, reason, "card.set_status")
+	})
+	if err != nil {
+		return nil, err
+	}
+	card.CVVHash = "***"
+	return card, nil
+}
+
+// блокировка клиентом: временная или навсегда (утеряна, украдена)
+func (s *BankService) BlockCard(actor models.Actor, cardID uuid.UUID, req models.CardBlockRequest) (*models.Card, error) {
+	to := models.CardTempBlocked
+	if req.Permanent {
+		to = models.CardPermBlocked
+	}
+	return s.customerSetCardStatus(actor, cardID, to, req.Reason)
+}
+
+func (s *BankService) UnblockCard(actor models.Actor, cardID uuid.UUID) (*models.Card, error) {
+	return s.customerSetCardStatus(actor, cardID, models.CardActive, "")
+}
+
+func (s *BankService) CloseCard(actor models.Actor, cardID uuid.UUID) (*models.Card, error) {
+	return s.customerSetCardStatus(actor, cardID, models.CardClosed, "закрыта клиентом")
+}
+
+// перевыпуск: новый номер, срок и CVV к тому же счёту. Старая карта
+// закрывается (утерянная остаётся perm_blocked) и сохраняет свою историю
+func (s *BankService) ReissueCard(actor models.Actor, cardID uuid.UUID, key *models.IdempotencyKey) (*models.Card, error) {
+	if err := s.requireVerifiedEmail(actor.UserID); err != nil {
+		return nil, err
+	}
+	var cvv string
+	card, err := idempotent(s, key, func(tx repo.TxContext) (*models.Card, error) {
+		old, acc, err := s.lockOwnCard(tx, actor.UserID, cardID)
+		if err != nil {
+			return nil, err
+		}
+		if err := accountUsable(acc); err != nil {
+			return nil, err
+		}
+		if old.Status == models.CardClosed {
+			return nil, ErrCardClosed
+		}
+		// карту с ограничениями перевыпускает только владелец счёта,
+		// как и меняет сами ограничения
+		controls, err := s.cardRepo.GetControlsTx(tx, old.ID)
+		if err != nil {
+			return nil, err
+		}
+		if controls.UpdatedAt != nil && acc.UserID != actor.UserID {
+			return nil, ErrForbidden
+		}
+		card, issued, err := s.newCard(acc.ID)
+		if err != nil {
+			return nil, err
+		}
+		card.ReissuedFrom = &old.ID
+		if err := s.cardRepo.CreateTx(tx, card); err != nil {
+			// на одну карту — один перевыпуск
+			if repo.IsUniqueViolation(err) {
+				return nil, ErrCardReissued
+			}
+			return nil, err
+		}
+		// ограничения владельца и траты за период переходят на новую карту:
+		// перевыпуск не должен обнулять дневной и месячный лимиты
+		if controls.UpdatedAt != nil {
+			controls.CardID = card.ID
+			if err := s.cardRepo.UpsertControlsTx(tx, controls); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.cardRepo.CopySpendTx(tx, old.ID, card.ID); err != nil {
+			return nil, err
+		}
+		if old.Status != models.CardPermBlocked {
+			if err := s.setCardStatus(tx, actor, old, models.CardClosed, models.BlockedByCustomer, "перевыпущена", "card.set_status"); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.auditTx(tx, actor, auditEntry{
+			Action:       "card.reissue",
+			ResourceType: "card",
+			ResourceID:   card.ID.String(),
+			After:        map[string]string{"account_id": acc.ID.String(), "reissued_from": old.ID.String()},
+		}); err != nil {
+			return nil, err
+		}
+		card.CVVHash = "***"
+		cvv = issued
+		return card, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	card.CVV = issuedCVV(key, cvv)
+	return card, nil
+}
+
+// ночное гашение карт с истёкшим сроком
+func (s *BankService) ExpireCards() error {
+	ids, err := s.cardRepo.ExpireBefore(moscowDay(time.Now()))
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		logrus.Infof("погашено карт с истёкшим сроком: %d", len(ids))
+	}
+	return nil
+}
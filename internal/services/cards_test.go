@@ -0,0 +1,104 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// номер и срок карты, как их видит клиент после step-up
+func cardDetails(t *testing.T, env *testutil.Env, u *models.User, cardID uuid.UUID) *models.CardDetails {
+	t.Helper()
+	st, err := env.Svc.StepUp(testutil.Actor(u), models.StepUpRequest{Password: testutil.Password})
+	if err != nil {
+		t.Fatalf("step-up: %v", err)
+	}
+	d, err := env.Svc.RevealCardDetails(testutil.Actor(u), cardID, st.Token)
+	if err != nil {
+		t.Fatalf("реквизиты: %v", err)
+	}
+	return d
+}
+
+// оплата в интернете реквизитами из ответа на выпуск карты
+func onlinePayment(d *models.CardDetails, cvv, amount string) models.PaymentRequest {
+	return models.PaymentRequest{
+		CardNumber: d.Number,
+		Expiry:     d.Expiry,
+		CVV:        cvv,
+		Amount:     decimal.RequireFromString(amount),
+		Merchant:   "shop",
+	}
+}
+
+// CVV из ответа на выпуск подходит для оплаты; повтор выпуска с тем же
+// ключом идемпотентности отдаёт ту же карту, но CVV уже под маской
+func TestIssuedCardPaysOnline(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	acc := env.Account(t, u, "1000")
+
+	key := &models.IdempotencyKey{UserID: u.ID, Key: uuid.NewString(), Fingerprint: "card"}
+	card, err := env.Svc.GenerateCard(testutil.Actor(u), acc.ID, key)
+	if err != nil {
+		t.Fatalf("выпуск: %v", err)
+	}
+	if len(card.CVV) != 3 {
+		t.Fatalf("CVV в ответе на выпуск: %q", card.CVV)
+	}
+	replay, err := env.Svc.GenerateCard(testutil.Actor(u), acc.ID, key)
+	if err != nil {
+		t.Fatalf("повтор выпуска: %v", err)
+	}
+	if replay.ID != card.ID || replay.CVV != "***" {
+		t.Errorf("повтор: карта %s, CVV %q; ждали %s и маску", replay.ID, replay.CVV, card.ID)
+	}
+	cards, err := env.Svc.GetAccountCards(u.ID, acc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cards {
+		if c.CVV != "" {
+			t.Errorf("CVV в списке карт: %q", c.CVV)
+		}
+	}
+
+	d := cardDetails(t, env, u, card.ID)
+	tr, err := env.Svc.PayWithCard(testutil.Actor(u), onlinePayment(d, card.CVV, "100"), nil)
+	if err != nil {
+		t.Fatalf("оплата с CVV из ответа на выпуск: %v", err)
+	}
+	if !tr.Amount.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("сумма оплаты %s", tr.Amount)
+	}
+
+	// у перевыпущенной карты свой CVV, тоже один раз в ответе
+	reissued, err := env.Svc.ReissueCard(testutil.Actor(u), card.ID, nil)
+	if err != nil {
+		t.Fatalf("перевыпуск: %v", err)
+	}
+	if len(reissued.CVV) != 3 {
+		t.Fatalf("CVV в ответе на перевыпуск: %q", reissued.CVV)
+	}
+	d = cardDetails(t, env, u, reissued.ID)
+	if _, err := env.Svc.PayWithCard(testutil.Actor(u), onlinePayment(d, reissued.CVV, "50"), nil); err != nil {
+		t.Errorf("оплата перевыпущенной картой: %v", err)
+	}
+	if _, err := env.Svc.PayWithCard(testutil.Actor(u), onlinePayment(d, wrongCVV(reissued.CVV), "50"), nil); !errors.Is(err, services.ErrCardDeclined) {
+		t.Errorf("оплата с неверным CVV: %v, ждали ErrCardDeclined", err)
+	}
+}
+
+// заведомо другой CVV той же длины
+func wrongCVV(cvv string) string {
+	if cvv == "000" {
+		return "001"
+	}
+	return "000"
+}
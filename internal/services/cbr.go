@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/shopspring/decimal"
+)
+
+// адреса ЦБ РФ по умолчанию: SOAP-сервис и ежедневные курсы XML_daily
+const (
+	DefaultCBREndpoint = "https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx"
+	DefaultCBRDailyURL = "https://www.cbr.ru/scripts/XML_daily.asp"
+)
+
+// источники ставки, которые сохраняем в кредите
+const (
+	RateSourceCBR     = "cbr"
+	RateSourceDefault = "default"
+)
+
+var ErrCBRNoRate = errors.New("ЦБ РФ не вернул ключевую ставку")
+
+// ключевая ставка на дату
+type KeyRate struct {
+	Rate   decimal.Decimal // годовая, в долях (0.16 = 16%)
+	Date   time.Time       // дата установления ставки
+	Source string
+}
+
+// клиент сервисов ЦБ РФ; ключевая ставка кешируется на сутки
+type CBRClient struct {
+	endpoint string
+	dailyURL string
+	http     *http.Client
+
+	mu    sync.Mutex
+	cache map[string]KeyRate
+}
+
+func NewCBRClient(endpoint, dailyURL string, timeout time.Duration) *CBRClient {
+	if endpoint == "" {
+		endpoint = DefaultCBREndpoint
+	}
+	if dailyURL == "" {
+		dailyURL = DefaultCBRDailyURL
+	}
+	return &CBRClient{
+		endpoint: endpoint,
+		dailyURL: dailyURL,
+		http:     &http.Client{Timeout: timeout},
+		cache:    make(map[string]KeyRate),
+	}
+}
+
+// ставка, действующая на дату on
+func (c *CBRClient) KeyRate(on time.Time) (KeyRate, error) {
+	day := on.Format("2006-01-02")
+
+	c.mu.Lock()
+	kr, ok := c.cache[day]
+	c.mu.Unlock()
+	if ok {
+		return kr, nil
+	}
+
+	// берём две недели назад: на выходные и праздники ставка не публикуется
+	kr, err := c.fetch(on.AddDate(0, 0, -14), on)
+	if err != nil {
+		return KeyRate{}, err
+	}
+
+	c.mu.Lock()
+	c.cache[day] = kr
+	c.mu.Unlock()
+	return kr, nil
+}
+
+func (c *CBRClient) fetch(from, to time.Time) (KeyRate, error) {
+	body := fmt.Sprintf(keyRateEnvelope, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewBufferString(body))
+	if err != nil {
+		return KeyRate{}, err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", `"http://web.cbr.ru/KeyRateXML"`)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return KeyRate{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return KeyRate{}, fmt.Errorf("ЦБ РФ ответил %s", resp.Status)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return KeyRate{}, err
+	}
+	return parseKeyRate(raw, to)
+}
+
+// выбирает последнюю ставку с датой не позже on
+func parseKeyRate(raw []byte, on time.Time) (KeyRate, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return KeyRate{}, err
+	}
+	var best KeyRate
+	for _, kr := range doc.FindElements("//KR") {
+		dtEl, rateEl := kr.SelectElement("DT"), kr.SelectElement("Rate")
+		if dtEl == nil || rateEl == nil {
+			continue
+		}
+		dt, err := time.Parse(time.RFC3339, dtEl.Text())
+		if err != nil {
+			return KeyRate{}, fmt.Errorf("дата ставки %q: %w", dtEl.Text(), err)
+		}
+		pct, err := decimal.NewFromString(rateEl.Text())
+		if err != nil {
+			return KeyRate{}, fmt.Errorf("ставка %q: %w", rateEl.Text(), err)
+		}
+		if dt.After(on) || (!best.Date.IsZero() && !dt.After(best.Date)) {
+			continue
+		}
+		best = KeyRate{
+			Rate:   pct.Div(decimal.NewFromInt(100)),
+			Date:   dt,
+			Source: RateSourceCBR,
+		}
+	}
+	if best.Date.IsZero() {
+		return KeyRate{}, ErrCBRNoRate
+	}
+	return best, nil
+}
+
+const keyRateEnvelope = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <KeyRateXML xmlns="http://web.cbr.ru/">
+      <fromDate>%s</fromDate>
+      <ToDate>%s</ToDate>
+    </KeyRateXML>
+  </soap:Body>
+</soap:Envelope>`
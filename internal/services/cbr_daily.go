@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+
+	"github.com/beevik/etree"
+	"github.com/shopspring/decimal"
+)
+
+var ErrCBRNoDailyRates = errors.New("ЦБ РФ не вернул курсы валют")
+
+// курсы ЦБ публикуются по московскому времени
+var moscow = time.FixedZone("MSK", 3*60*60)
+
+// календарный день по Москве как дата без времени
+func moscowDay(t time.Time) time.Time {
+	y, m, d := t.In(moscow).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// официальные курсы на день on. ЦБ отвечает курсами, действующими в этот
+// день, — для выходных это курсы последнего рабочего дня; их дата
+// установления возвращается первым значением
+func (c *CBRClient) DailyRates(on time.Time) (time.Time, []models.FXRate, error) {
+	u, err := url.Parse(c.dailyURL)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	q := u.Query()
+	q.Set("date_req", on.Format("02/01/2006"))
+	u.RawQuery = q.Encode()
+
+	resp, err := c.http.Get(u.String())
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, nil, fmt.Errorf("ЦБ РФ ответил %s", resp.Status)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	return parseDailyRates(raw)
+}
+
+// разбирает ValCurs: Value с запятой в качестве разделителя, курс за Nominal единиц
+func parseDailyRates(raw []byte) (time.Time, []models.FXRate, error) {
+	doc := etree.NewDocument()
+	doc.ReadSettings.CharsetReader = charsetReader
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return time.Time{}, nil, err
+	}
+	root := doc.SelectElement("ValCurs")
+	if root == nil {
+		return time.Time{}, nil, ErrCBRNoDailyRates
+	}
+	date, err := time.Parse("02.01.2006", root.SelectAttrValue("Date", ""))
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("дата курсов %q: %w", root.SelectAttrValue("Date", ""), err)
+	}
+	text := func(el *etree.Element, tag string) string {
+		if child := el.SelectElement(tag); child != nil {
+			return strings.TrimSpace(child.Text())
+		}
+		return ""
+	}
+	var rates []models.FXRate
+	for _, v := range root.SelectElements("Valute") {
+		code := text(v, "CharCode")
+		nominal, err := strconv.Atoi(text(v, "Nominal"))
+		if err != nil || nominal <= 0 {
+			return time.Time{}, nil, fmt.Errorf("номинал %s: %q", code, text(v, "Nominal"))
+		}
+		value, err := decimal.NewFromString(strings.Replace(text(v, "Value"), ",", ".", 1))
+		if err != nil || !value.IsPositive() {
+			return time.Time{}, nil, fmt.Errorf("курс %s: %q", code, text(v, "Value"))
+		}
+		rates = append(rates, models.FXRate{
+			Date:     date,
+			Currency: code,
+			NumCode:  text(v, "NumCode"),
+			Name:     text(v, "Name"),
+			Nominal:  nominal,
+			Value:    value,
+			Rate:     value.Div(decimal.NewFromInt(int64(nominal))).Round(10),
+		})
+	}
+	if len(rates) == 0 {
+		return time.Time{}, nil, ErrCBRNoDailyRates
+	}
+	return date, rates, nil
+}
+
+// XML_daily отдаётся в windows-1251
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8":
+		return input, nil
+	case "windows-1251", "cp1251":
+		raw, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(decodeCP1251(raw)), nil
+	}
+	return nil, fmt.Errorf("неподдерживаемая кодировка %s", charset)
+}
+
+// декодер Windows-1251 для XML_daily: ASCII, кириллица, Ё/ё, № и тире
+// (те же символы, что пишет encodeCP1251); остальное — U+FFFD
+func decodeCP1251(raw []byte) []byte {
+	var sb strings.Builder
+	sb.Grow(len(raw) * 2)
+	for _, b := range raw {
+		switch {
+		case b < 0x80:
+			sb.WriteByte(b)
+		case b >= 0xC0:
+			sb.WriteRune(rune(b-0xC0) + 'А')
+		case b == 0xA8:
+			sb.WriteRune('Ё')
+		case b == 0xB8:
+			sb.WriteRune('ё')
+		case b == 0xB9:
+			sb.WriteRune('№')
+		case b == 0x96:
+			sb.WriteRune('–')
+		case b == 0x97:
+			sb.WriteRune('—')
+		default:
+			sb.WriteRune('\uFFFD')
+		}
+	}
+	return []byte(sb.String())
+}
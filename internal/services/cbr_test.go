@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseKeyRateFixture(t *testing.T) {
+	cases := []struct {
+		on       string
+		rate     string
+		rateDate string
+	}{
+		// ставка с 29.07 ещё не действует 28.07
+		{"2024-07-28", "0.16", "2024-07-26"},
+		{"2024-07-29", "0.18", "2024-07-29"},
+		{"2024-08-15", "0.18", "2024-07-29"},
+	}
+	for _, c := range cases {
+		on, _ := time.ParseInLocation("2006-01-02", c.on, moscow)
+		kr, err := parseKeyRate(cbrKeyRateFixture, on)
+		if err != nil {
+			t.Fatalf("%s: %v", c.on, err)
+		}
+		if !kr.Rate.Equal(decimal.RequireFromString(c.rate)) || kr.Date.Format("2006-01-02") != c.rateDate {
+			t.Errorf("%s: ставка %s от %s, ждали %s от %s", c.on, kr.Rate, kr.Date.Format("2006-01-02"), c.rate, c.rateDate)
+		}
+		if kr.Source != RateSourceCBR {
+			t.Errorf("%s: источник %q", c.on, kr.Source)
+		}
+	}
+	if _, err := parseKeyRate(cbrKeyRateFixture, time.Date(2024, 7, 1, 0, 0, 0, 0, moscow)); !errors.Is(err, ErrCBRNoRate) {
+		t.Errorf("дата раньше всех ставок: %v, ждали ErrCBRNoRate", err)
+	}
+}
+
+// ответ в windows-1251, курс с запятой и за Nominal единиц
+func TestParseDailyRatesFixture(t *testing.T) {
+	date, rates, err := parseDailyRates(cbrDailyFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := date.Format("2006-01-02"); got != "2024-07-27" {
+		t.Errorf("дата курсов %s", got)
+	}
+	want := map[string]string{"USD": "85.6963", "EUR": "92.9503", "JPY": "0.55679", "KZT": "0.181097"}
+	for _, r := range rates {
+		if w, ok := want[r.Currency]; ok {
+			if !r.Rate.Equal(decimal.RequireFromString(w)) {
+				t.Errorf("%s: курс %s, ждали %s", r.Currency, r.Rate, w)
+			}
+			delete(want, r.Currency)
+		}
+		if r.Currency == "USD" && r.Name != "Доллар США" {
+			t.Errorf("USD: название %q — кодировка не разобрана", r.Name)
+		}
+	}
+	for code := range want {
+		t.Errorf("нет курса %s", code)
+	}
+}
+
+// клиент целиком, через HTTP к заглушке ЦБ
+func TestCBRClientAgainstStub(t *testing.T) {
+	srv := NewCBRStub(t)
+	c := NewCBRClient(srv.URL, srv.DailyURL(), time.Second)
+
+	kr, err := c.KeyRate(time.Date(2024, 7, 30, 12, 0, 0, 0, moscow))
+	if err != nil {
+		t.Fatalf("ключевая ставка: %v", err)
+	}
+	if !kr.Rate.Equal(decimal.RequireFromString("0.18")) {
+		t.Errorf("ключевая ставка %s, ждали 0.18", kr.Rate)
+	}
+
+	date, rates, err := c.DailyRates(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("курсы: %v", err)
+	}
+	if got := date.Format("2006-01-02"); got != "2024-08-01" {
+		t.Errorf("дата курсов %s, ждали дату запроса", got)
+	}
+	if len(rates) != 6 {
+		t.Errorf("курсов %d, ждали 6", len(rates))
+	}
+}
+
+func TestCBRClientHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := NewCBRClient(srv.URL, srv.URL, time.Second)
+	if _, err := c.KeyRate(time.Now()); err == nil {
+		t.Error("ключевая ставка: ошибки нет при ответе 503")
+	}
+	if _, _, err := c.DailyRates(time.Now()); err == nil {
+		t.Error("курсы: ошибки нет при ответе 503")
+	}
+}
+
+func TestNewCBRClientDefaults(t *testing.T) {
+	c := NewCBRClient("", "", time.Second)
+	if c.endpoint != DefaultCBREndpoint || c.dailyURL != DefaultCBRDailyURL {
+		t.Errorf("адреса по умолчанию: %s, %s", c.endpoint, c.dailyURL)
+	}
+}
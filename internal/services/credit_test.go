@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAnnuityScheduleRepaysPrincipal(t *testing.T) {
+	first := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		principal string
+		annual    string
+		months    int
+	}{
+		{"100000", "0.21", 12},
+		{"1000.01", "0.16", 7},
+		{"250000", "0.075", 36},
+		{"10", "0.21", 1},
+	}
+	for _, c := range cases {
+		principal := decimal.RequireFromString(c.principal)
+		monthly := decimal.RequireFromString(c.annual).Div(decimal.NewFromInt(12))
+		annuity := annuityPayment(principal, monthly, c.months)
+		list := annuitySchedule(principal, monthly, annuity, c.months, first)
+		if len(list) != c.months {
+			t.Fatalf("%s/%d: %d платежей", c.principal, c.months, len(list))
+		}
+		sum := decimal.Zero
+		for i, p := range list {
+			if !p.Principal.Add(p.Interest).Equal(p.Amount) {
+				t.Errorf("%s/%d: платёж %d: %s + %s != %s", c.principal, c.months, i, p.Principal, p.Interest, p.Amount)
+			}
+			if i < c.months-1 && !p.Amount.Equal(annuity) {
+				t.Errorf("%s/%d: платёж %d = %s, ждали аннуитет %s", c.principal, c.months, i, p.Amount, annuity)
+			}
+			sum = sum.Add(p.Principal)
+		}
+		if !sum.Equal(principal) {
+			t.Errorf("%s/%d: тело по графику %s, выдано %s", c.principal, c.months, sum, principal)
+		}
+	}
+}
+
+func TestAnnuityScheduleDueDates(t *testing.T) {
+	first := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	list := annuitySchedule(decimal.NewFromInt(1200), decimal.NewFromFloat(0.01), decimal.NewFromInt(107), 3, first)
+	for i, want := range []string{"2026-03-15", "2026-04-15", "2026-05-15"} {
+		if got := list[i].DueDate.Format("2006-01-02"); got != want {
+			t.Errorf("платёж %d: срок %s, ждали %s", i, got, want)
+		}
+	}
+}
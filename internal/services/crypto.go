@@ -2,9 +2,13 @@ package services
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -54,6 +58,52 @@ func EncryptPGP(plainText []byte, publicKeyPath string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// расшифровка EncryptPGP закрытым ключом; ключ и сообщение — armored или бинарные
+func DecryptPGP(cipherText []byte, privateKeyPath, passphrase string) ([]byte, error) {
+	keyData, err := os.ReadFile(privateKeyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrPGPMissingKeys
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entities openpgp.EntityList
+	if block, err := armor.Decode(bytes.NewReader(keyData)); err == nil && block.Type == openpgp.PrivateKeyType {
+		entities, err = openpgp.ReadKeyRing(block.Body)
+		if err != nil {
+			return nil, err
+		}
+	} else if entities, err = openpgp.ReadKeyRing(bytes.NewReader(keyData)); err != nil {
+		return nil, err
+	}
+	// закрытые ключи под паролем расшифровываются один раз
+	pass := []byte(passphrase)
+	for _, e := range entities {
+		if e.PrivateKey != nil && e.PrivateKey.Encrypted {
+			if err := e.PrivateKey.Decrypt(pass); err != nil {
+				return nil, err
+			}
+		}
+		for _, sub := range e.Subkeys {
+			if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+				if err := sub.PrivateKey.Decrypt(pass); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var msg io.Reader = bytes.NewReader(cipherText)
+	if block, err := armor.Decode(bytes.NewReader(cipherText)); err == nil {
+		msg = block.Body
+	}
+	md, err := openpgp.ReadMessage(msg, entities, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(md.UnverifiedBody)
+}
+
 func ComputeHMAC(data string, secret []byte) string {
 	mac := hmac.New(sha256.New, secret)
 	mac.Write([]byte(data))
@@ -69,3 +119,43 @@ func CheckCVVHash(plain, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain))
 	return err == nil
 }
+
+// отдельный ключ под каждую задачу из общего секрета: HMAC(secret, purpose)
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// AES-256-GCM, nonce в начале шифротекста
+func EncryptAESGCM(plain, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func DecryptAESGCM(data, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("шифротекст слишком короткий")
+	}
+	nonce, ct := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, nil)
+}
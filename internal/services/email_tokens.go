@@ -0,0 +1,199 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const userTokenKeyPurpose = "user-tokens"
+
+var (
+	ErrInvalidUserToken     = errors.New("ссылка недействительна или устарела")
+	ErrEmailNotVerified     = errors.New("подтвердите email, чтобы выполнять операции")
+	ErrEmailAlreadyVerified = errors.New("email уже подтверждён")
+	ErrRegistrationConflict = errors.New("имя пользователя или email уже заняты")
+)
+
+// сброс пароля: ответ всегда одинаковый, есть такой email или нет.
+// Поиск и отправка идут в фоне, чтобы и время ответа ничего не выдавало.
+// Запросы считаются по email и по IP клиента одинаково для любых адресов,
+// поэтому отказ по лимиту тоже ничего не говорит о существовании email
+func (s *BankService) ForgotPassword(email string, client models.Actor) error {
+	if err := s.rateLimit(rateForgotEmail, strings.ToLower(strings.TrimSpace(email)), s.cfg.PasswordForgotPerHour, time.Hour); err != nil {
+		return err
+	}
+	if err := s.rateLimit(rateForgotIP, client.IP, s.cfg.PasswordForgotPerHourIP, time.Hour); err != nil {
+		return err
+	}
+	go func() {
+		u, err := s.userRepo.GetByEmail(email)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logrus.Errorf("сброс пароля: %v", err)
+			}
+			return
+		}
+		ttl := time.Duration(s.cfg.PasswordResetTTLMin) * time.Minute
+		token, err := s.issueUserToken(u.ID, models.TokenPasswordReset, ttl)
+		if err != nil {
+			logrus.Errorf("сброс пароля: %v", err)
+			return
+		}
+		_ = sendEmailNotification(
+			s.cfg,
+			u.Email,
+			"Восстановление пароля BankApp",
+			fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+				"Ссылка действует %d мин. Если вы не запрашивали сброс, просто проигнорируйте письмо.",
+				u.Username, s.userTokenLink("/password/reset", token), s.cfg.PasswordResetTTLMin),
+		)
+	}()
+	return nil
+}
+
+// новый пароль по токену из письма; все сессии пользователя завершаются
+func (s *BankService) ResetPassword(req models.ResetPasswordRequest) error {
+	if len(req.Password) < 6 {
+		return models.ErrInvalidPassword
+	}
+	hash, err := HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+	var userID uuid.UUID
+	err = s.userTokenRepo.WithTx(func(tx repo.TxContext) error {
+		id, err := s.userTokenRepo.ConsumeTx(tx, models.TokenPasswordReset, s.hashUserToken(req.Token))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidUserToken
+		}
+		if err != nil {
+			return err
+		}
+		userID = id
+		if err := s.userRepo.UpdatePasswordTx(tx, id, hash); err != nil {
+			return err
+		}
+		// письмо дошло до владельца — адрес заодно подтверждён
+		if err := s.userRepo.SetEmailVerifiedTx(tx, id); err != nil {
+			return err
+		}
+		if err := s.userTokenRepo.InvalidateTx(tx, id, models.TokenPasswordReset); err != nil {
+			return err
+		}
+		return s.sessionRepo.RevokeAllByUserTx(tx, id, revokePasswordReset)
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		u, err := s.userRepo.GetByID(userID)
+		if err != nil {
+			return
+		}
+		_ = sendEmailNotification(
+			s.cfg,
+			u.Email,
+			"Пароль BankApp изменён",
+			"Пароль от вашего аккаунта изменён, все сеансы завершены. Если это были не вы, срочно свяжитесь с банком.",
+		)
+	}()
+	return nil
+}
+
+// подтверждение email по ссылке из письма
+func (s *BankService) VerifyEmail(token string) error {
+	return s.userTokenRepo.WithTx(func(tx repo.TxContext) error {
+		id, err := s.userTokenRepo.ConsumeTx(tx, models.TokenEmailVerify, s.hashUserToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidUserToken
+		}
+		if err != nil {
+			return err
+		}
+		return s.userRepo.SetEmailVerifiedTx(tx, id)
+	})
+}
+
+// повторная отправка письма с подтверждением; прежние ссылки гаснут
+func (s *BankService) ResendVerification(userID uuid.UUID) error {
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if u.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	err = s.userTokenRepo.WithTx(func(tx repo.TxContext) error {
+		return s.userTokenRepo.InvalidateTx(tx, u.ID, models.TokenEmailVerify)
+	})
+	if err != nil {
+		return err
+	}
+	return s.sendVerification(u, "Подтверждение email в BankApp", "")
+}
+
+// письмо со ссылкой подтверждения; greeting — необязательный первый абзац
+func (s *BankService) sendVerification(u *models.User, subject, greeting string) error {
+	ttl := time.Duration(s.cfg.EmailVerifyTTLHours) * time.Hour
+	token, err := s.issueUserToken(u.ID, models.TokenEmailVerify, ttl)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Подтвердите адрес, перейдя по ссылке:\n%s\n\n"+
+		"Ссылка действует %d ч. До подтверждения операции по счетам недоступны.",
+		s.userTokenLink("/email/verify", token), s.cfg.EmailVerifyTTLHours)
+	if greeting != "" {
+		body = greeting + "\n\n" + body
+	}
+	go sendEmailNotification(s.cfg, u.Email, subject, body)
+	return nil
+}
+
+// операции с деньгами доступны только с подтверждённым email
+func (s *BankService) requireVerifiedEmail(userID uuid.UUID) error {
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if u.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// случайный токен для письма; в БД — только HMAC, так что утечка
+// таблицы не даёт рабочих ссылок
+func (s *BankService) issueUserToken(userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	err := s.userTokenRepo.Create(&models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: s.hashUserToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	return token, err
+}
+
+func (s *BankService) hashUserToken(token string) string {
+	return ComputeHMAC(token, deriveKey(s.cfg.HMACSecret, userTokenKeyPurpose))
+}
+
+func (s *BankService) userTokenLink(path, token string) string {
+	return s.cfg.AppBaseURL + path + "?token=" + url.QueryEscape(token)
+}
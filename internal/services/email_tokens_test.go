@@ -0,0 +1,156 @@
+package services_test
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+var tokenLink = regexp.MustCompile(`(/password/reset|/email/verify)\?token=(\S+)`)
+
+// окружение, которое шлёт письма на локальный SMTP-сервер теста
+func mailEnv(t *testing.T) (*testutil.Env, *testutil.SMTPServer) {
+	srv := testutil.NewSMTPServer(t)
+	cfg := testutil.Config()
+	cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser = srv.Host, srv.Port, "bank@example.com"
+	return testutil.NewEnv(t, cfg), srv
+}
+
+// токен из ссылки в письме
+func mailToken(t *testing.T, m testutil.Mail, path string) string {
+	t.Helper()
+	match := tokenLink.FindStringSubmatch(m.Body)
+	if match == nil || match[1] != path {
+		t.Fatalf("в письме %q нет ссылки %s: %q", m.Subject, path, m.Body)
+	}
+	token, err := url.QueryUnescape(match[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// счётчики лимитов живут в общей базе час, поэтому ключ у каждого прогона свой
+func uniqueIP() string { return "test-" + uuid.NewString() }
+
+func register(t *testing.T, env *testutil.Env) (*models.User, string) {
+	t.Helper()
+	name := "t" + uuid.NewString()[:12]
+	email := name + "@example.com"
+	u, err := env.Svc.RegisterUser(models.RegisterRequest{Username: name, Email: email, Password: testutil.Password})
+	if err != nil {
+		t.Fatalf("регистрация: %v", err)
+	}
+	return u, email
+}
+
+// до подтверждения email операции закрыты; ссылка из welcome-письма
+// подтверждает адрес и срабатывает только один раз
+func TestEmailVerificationFlow(t *testing.T) {
+	env, srv := mailEnv(t)
+	u, email := register(t, env)
+
+	if _, err := env.Svc.CreateAccount(u.ID, models.CreateAccountRequest{}, nil); !errors.Is(err, services.ErrEmailNotVerified) {
+		t.Fatalf("счёт без подтверждения: %v, ждали ErrEmailNotVerified", err)
+	}
+	token := mailToken(t, srv.Wait(t, email, 1), "/email/verify")
+	if err := env.Svc.VerifyEmail(token); err != nil {
+		t.Fatalf("подтверждение: %v", err)
+	}
+	if err := env.Svc.VerifyEmail(token); !errors.Is(err, services.ErrInvalidUserToken) {
+		t.Errorf("повторное подтверждение: %v, ждали ErrInvalidUserToken", err)
+	}
+	if _, err := env.Svc.CreateAccount(u.ID, models.CreateAccountRequest{}, nil); err != nil {
+		t.Errorf("счёт после подтверждения: %v", err)
+	}
+}
+
+// ссылка из письма задаёт новый пароль один раз; на неизвестный адрес
+// письмо не уходит, а ответ тот же
+func TestPasswordResetFlow(t *testing.T) {
+	env, srv := mailEnv(t)
+	u, email := register(t, env)
+	srv.Wait(t, email, 1) // welcome
+	client := models.Actor{IP: uniqueIP()}
+
+	unknown := "nobody-" + uuid.NewString()[:8] + "@example.com"
+	if err := env.Svc.ForgotPassword(unknown, client); err != nil {
+		t.Fatalf("сброс для неизвестного адреса: %v", err)
+	}
+	if err := env.Svc.ForgotPassword(email, client); err != nil {
+		t.Fatalf("сброс: %v", err)
+	}
+	token := mailToken(t, srv.Wait(t, email, 2), "/password/reset")
+
+	const newPassword = "new-secret-password"
+	if err := env.Svc.ResetPassword(models.ResetPasswordRequest{Token: token, Password: newPassword}); err != nil {
+		t.Fatalf("новый пароль: %v", err)
+	}
+	if err := env.Svc.ResetPassword(models.ResetPasswordRequest{Token: token, Password: "third-password"}); !errors.Is(err, services.ErrInvalidUserToken) {
+		t.Errorf("повторный сброс тем же токеном: %v, ждали ErrInvalidUserToken", err)
+	}
+	if _, err := env.Svc.LoginUser(models.LoginRequest{Username: u.Username, Password: newPassword}, client); err != nil {
+		t.Errorf("вход с новым паролем: %v", err)
+	}
+	if n := len(srv.Messages(unknown)); n != 0 {
+		t.Errorf("на неизвестный адрес ушло %d писем", n)
+	}
+}
+
+// лимит на email срабатывает одинаково для существующего и неизвестного
+// адреса, лимит на IP — независимо от адресов
+func TestForgotPasswordRateLimit(t *testing.T) {
+	env, srv := mailEnv(t)
+	env.Cfg.PasswordForgotPerHour, env.Cfg.PasswordForgotPerHourIP = 2, 5
+	_, email := register(t, env)
+	srv.Wait(t, email, 1)
+
+	for _, addr := range []string{email, "nobody-" + uuid.NewString()[:8] + "@example.com"} {
+		client := models.Actor{IP: uniqueIP()}
+		for i := 0; i < 2; i++ {
+			if err := env.Svc.ForgotPassword(addr, client); err != nil {
+				t.Fatalf("%s: запрос %d: %v", addr, i+1, err)
+			}
+		}
+		var rl *services.RateLimitedError
+		if err := env.Svc.ForgotPassword(strings.ToUpper(addr), client); !errors.As(err, &rl) || rl.RetryAfter <= 0 {
+			t.Errorf("%s: третий запрос: %v, ждали RateLimitedError", addr, err)
+		}
+	}
+
+	client := models.Actor{IP: uniqueIP()}
+	for i := 0; i < 5; i++ {
+		if err := env.Svc.ForgotPassword(uuid.NewString()+"@example.com", client); err != nil {
+			t.Fatalf("IP: запрос %d: %v", i+1, err)
+		}
+	}
+	var rl *services.RateLimitedError
+	if err := env.Svc.ForgotPassword(uuid.NewString()+"@example.com", client); !errors.As(err, &rl) {
+		t.Errorf("IP: шестой запрос: %v, ждали RateLimitedError", err)
+	}
+}
+
+// занятое имя и занятый email дают одну и ту же ошибку
+func TestRegisterConflictIsGeneric(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	other := "t" + uuid.NewString()[:12]
+	_, errName := env.Svc.RegisterUser(models.RegisterRequest{Username: u.Username, Email: other + "@example.com", Password: testutil.Password})
+	_, errEmail := env.Svc.RegisterUser(models.RegisterRequest{Username: other, Email: u.Email, Password: testutil.Password})
+	for _, err := range []error{errName, errEmail} {
+		if !errors.Is(err, services.ErrRegistrationConflict) {
+			t.Fatalf("повторная регистрация: %v, ждали ErrRegistrationConflict", err)
+		}
+	}
+	if errName.Error() != errEmail.Error() {
+		t.Errorf("ответы различаются: %q и %q", errName, errEmail)
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("неизвестная валюта")
+	ErrNoFXRate        = errors.New("нет курса для конвертации")
+	ErrAmountPrecision = errors.New("слишком много знаков после запятой для валюты счёта")
+	ErrFXAmountTooLow  = errors.New("сумма слишком мала для конвертации")
+	ErrCreditCurrency  = errors.New("кредиты выдаются только на рублёвые счета")
+)
+
+// источник курсов: сколько рублей стоит единица валюты на дату
+type FXProvider interface {
+	Rate(currency string, on time.Time) (decimal.Decimal, error)
+}
+
+// курсы из JSON-файла вида {"USD": "92.50", "EUR": "100.10"};
+// файл читается при каждом запросе, чтобы курс можно было поменять без перезапуска
+type FileFXProvider struct {
+	path string
+}
+
+func NewFileFXProvider(path string) *FileFXProvider {
+	return &FileFXProvider{path}
+}
+
+func (p *FileFXProvider) Rate(currency string, on time.Time) (decimal.Decimal, error) {
+	raw, err := os.ReadFile(p.path)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%w: %v", ErrNoFXRate, err)
+	}
+	var rates map[string]decimal.Decimal
+	if err := json.Unmarshal(raw, &rates); err != nil {
+		return decimal.Zero, fmt.Errorf("курсы %s: %w", p.path, err)
+	}
+	return StaticFXProvider(rates).Rate(currency, on)
+}
+
+// фиксированные курсы: в тестах подставляются через SetFXProvider,
+// на них же опирается FileFXProvider
+type StaticFXProvider map[string]decimal.Decimal
+
+func (p StaticFXProvider) Rate(currency string, _ time.Time) (decimal.Decimal, error) {
+	if currency == models.CurrencyRUB {
+		return decimal.NewFromInt(1), nil
+	}
+	rate, ok := p[currency]
+	if !ok || !rate.IsPositive() {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrNoFXRate, currency)
+	}
+	return rate, nil
+}
+
+// подменяет источник курсов (по умолчанию — файл FX_RATES_PATH)
+func (s *BankService) SetFXProvider(p FXProvider) {
+	s.fx = p
+}
+
+// код валюты из запроса; пустой — рубли
+func parseCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return models.CurrencyRUB, nil
+	}
+	if _, ok := models.Currencies[code]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownCurrency, code)
+	}
+	return code, nil
+}
+
+// сумма положительна и не мельче минимальной единицы валюты
+func checkAmount(amount decimal.Decimal, currency string) error {
+	if !amount.IsPositive() {
+		return errors.New("сумма должна быть >0")
+	}
+	if !models.RoundAmount(amount, currency).Equal(amount) {
+		return ErrAmountPrecision
+	}
+	return nil
+}
+
+// конвертация amount из from в to: кросс-курс через рубль минус спред
+// банка FX_SPREAD_BPS; возвращает применённый курс и сумму зачисления
+func (s *BankService) convert(amount decimal.Decimal, from, to string, on time.Time) (rate, converted decimal.Decimal, err error) {
+	fromRUB, err := s.fx.Rate(from, on)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	toRUB, err := s.fx.Rate(to, on)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	spread := decimal.New(int64(s.cfg.FXSpreadBps), -4)
+	rate = fromRUB.Div(toRUB).Mul(decimal.NewFromInt(1).Sub(spread)).Round(10)
+	converted = models.RoundAmount(amount.Mul(rate), to)
+	if !converted.IsPositive() {
+		return decimal.Zero, decimal.Zero, ErrFXAmountTooLow
+	}
+	return rate, converted, nil
+}
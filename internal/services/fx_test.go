@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestStaticFXProvider(t *testing.T) {
+	p := StaticFXProvider{"USD": decimal.RequireFromString("92.50"), "EUR": decimal.Zero}
+	if r, err := p.Rate(models.CurrencyRUB, time.Now()); err != nil || !r.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("RUB: %s, %v", r, err)
+	}
+	if r, err := p.Rate("USD", time.Now()); err != nil || !r.Equal(decimal.RequireFromString("92.50")) {
+		t.Errorf("USD: %s, %v", r, err)
+	}
+	// нулевой курс — всё равно что отсутствующий
+	for _, code := range []string{"EUR", "CNY"} {
+		if _, err := p.Rate(code, time.Now()); !errors.Is(err, ErrNoFXRate) {
+			t.Errorf("%s: %v, ждали ErrNoFXRate", code, err)
+		}
+	}
+}
+
+func TestFileFXProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fx.json")
+	p := NewFileFXProvider(path)
+	if _, err := p.Rate("USD", time.Now()); !errors.Is(err, ErrNoFXRate) {
+		t.Errorf("нет файла: %v, ждали ErrNoFXRate", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"USD": "92.50"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := p.Rate("USD", time.Now()); err != nil || !r.Equal(decimal.RequireFromString("92.50")) {
+		t.Errorf("USD: %s, %v", r, err)
+	}
+	// файл перечитывается без перезапуска
+	if err := os.WriteFile(path, []byte(`{"USD": "95"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := p.Rate("USD", time.Now()); !r.Equal(decimal.NewFromInt(95)) {
+		t.Errorf("после замены файла: %s", r)
+	}
+}
+
+// кросс-курс через рубль, спред в пользу банка, округление до валюты зачисления
+func TestConvert(t *testing.T) {
+	s := &BankService{
+		cfg: &config.Config{FXSpreadBps: 100},
+		fx: StaticFXProvider{
+			"USD": decimal.RequireFromString("90"),
+			"EUR": decimal.RequireFromString("100"),
+		},
+	}
+	cases := []struct {
+		amount, from, to string
+		rate, converted  string
+	}{
+		{"1000", "RUB", "USD", "0.011", "11.00"},
+		{"10", "USD", "RUB", "89.1", "891.00"},
+		{"100", "EUR", "USD", "1.1", "110.00"},
+		{"33.33", "USD", "EUR", "0.891", "29.70"},
+	}
+	for _, c := range cases {
+		rate, converted, err := s.convert(decimal.RequireFromString(c.amount), c.from, c.to, time.Now())
+		if err != nil {
+			t.Fatalf("%s %s->%s: %v", c.amount, c.from, c.to, err)
+		}
+		if !rate.Equal(decimal.RequireFromString(c.rate)) || !converted.Equal(decimal.RequireFromString(c.converted)) {
+			t.Errorf("%s %s->%s: курс %s, сумма %s; ждали %s, %s", c.amount, c.from, c.to, rate, converted, c.rate, c.converted)
+		}
+	}
+	if _, _, err := s.convert(decimal.RequireFromString("0.10"), "RUB", "USD", time.Now()); !errors.Is(err, ErrFXAmountTooLow) {
+		t.Errorf("копейки в доллары: %v, ждали ErrFXAmountTooLow", err)
+	}
+	if _, _, err := s.convert(decimal.NewFromInt(1), "RUB", "CNY", time.Now()); !errors.Is(err, ErrNoFXRate) {
+		t.Errorf("нет курса CNY: %v, ждали ErrNoFXRate", err)
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("некорректный курсор")
+
+	historyTypes = map[string]bool{
+		models.TxTransfer:           true,
+		models.TxDeposit:            true,
+		models.TxPayment:            true,
+		models.TxCreditPayment:      true,
+		models.TxCreditDisbursement: true,
+		models.TxInterest:           true,
+	}
+)
+
+// история операций по счёту с keyset-пагинацией по (created_at, id)
+func (s *BankService) GetTransactions(userID, accountID uuid.UUID, f models.TransactionFilter, cursor string) (*models.TransactionPage, error) {
+	if _, err := s.authorizeAccountID(userID, accountID, models.AccessView); err != nil {
+		return nil, err
+	}
+	return s.history(accountID, f, cursor)
+}
+
+// страница истории без проверки прав — её делает вызывающий
+func (s *BankService) history(accountID uuid.UUID, f models.TransactionFilter, cursor string) (*models.TransactionPage, error) {
+	for _, t := range f.Types {
+		if !historyTypes[t] {
+			return nil, fmt.Errorf("неизвестный тип операции %q", t)
+		}
+	}
+	if f.MinAmount != nil && f.MaxAmount != nil && f.MinAmount.GreaterThan(*f.MaxAmount) {
+		return nil, errors.New("min_amount больше max_amount")
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultHistoryLimit
+	}
+	if f.Limit > maxHistoryLimit {
+		f.Limit = maxHistoryLimit
+	}
+	if cursor != "" {
+		at, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		f.AfterCreatedAt, f.AfterID = &at, id
+	}
+
+	// берём на одну запись больше, чтобы понять, есть ли следующая страница
+	limit := f.Limit
+	f.Limit++
+	list, err := s.transactionRepo.History(accountID, f)
+	if err != nil {
+		return nil, err
+	}
+	page := &models.TransactionPage{Items: list}
+	if len(list) > limit {
+		page.Items = list[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	if page.Items == nil {
+		page.Items = []models.HistoryEntry{}
+	}
+	return page, nil
+}
+
+func encodeCursor(at time.Time, id uuid.UUID) string {
+	raw := at.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(c string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return at, id, nil
+}
@@ -0,0 +1,155 @@
+package services_test
+
+import (
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/shopspring/decimal"
+)
+
+// остаток после операции не зависит от страницы и фильтров: листаем по
+// одной записи и сверяем с остатком, пересчитанным от текущего баланса
+func TestHistoryBalanceAcrossPages(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	alice, bob := env.User(t), env.User(t)
+	acc := env.Account(t, alice, "1000")
+	other := env.Account(t, bob, "500")
+	for _, amount := range []int64{10, 20, 30} {
+		if _, err := env.Svc.Deposit(testutil.Actor(alice), models.DepositRequest{ToAccountID: acc.ID, Amount: decimal.NewFromInt(amount)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tr := range []struct {
+		who      *models.User
+		from, to *models.Account
+		amount   int64
+	}{{alice, acc, other, 100}, {bob, other, acc, 45}} {
+		if _, err := env.Svc.Transfer(testutil.Actor(tr.who), models.TransferRequest{
+			FromAccountID: tr.from.ID, ToAccountID: tr.to.ID, Amount: decimal.NewFromInt(tr.amount),
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var items []models.HistoryEntry
+	cursor := ""
+	for {
+		page, err := env.Svc.GetTransactions(alice.ID, acc.ID, models.TransactionFilter{Limit: 1}, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, page.Items...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(items) != 6 {
+		t.Fatalf("операций %d, ждали 6", len(items))
+	}
+	bal := decimal.RequireFromString("1000").Add(decimal.NewFromInt(60 - 100 + 45))
+	for i, e := range items {
+		if !e.BalanceAfter.Equal(bal) {
+			t.Errorf("операция %d (%s %s): остаток %s, ждали %s", i, e.Type, e.Amount, e.BalanceAfter, bal)
+		}
+		if e.To != nil && *e.To == acc.ID {
+			bal = bal.Sub(e.AmountFor(acc.ID))
+		} else {
+			bal = bal.Add(e.AmountFor(acc.ID))
+		}
+	}
+	if !bal.IsZero() {
+		t.Errorf("до первой операции остаток %s, ждали 0", bal)
+	}
+
+	// фильтр не меняет остатки
+	min := decimal.NewFromInt(40)
+	page, err := env.Svc.GetTransactions(alice.ID, acc.ID, models.TransactionFilter{MinAmount: &min, Types: []string{models.TxTransfer}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || !page.Items[0].BalanceAfter.Equal(items[0].BalanceAfter) || !page.Items[1].BalanceAfter.Equal(items[1].BalanceAfter) {
+		t.Errorf("с фильтром: %+v", page.Items)
+	}
+}
+
+// входящая конвертация фильтруется по сумме в валюте счёта (to_amount)
+func TestHistoryAmountFilterInAccountCurrency(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	env.Svc.SetFXProvider(services.StaticFXProvider{"USD": decimal.NewFromInt(90)})
+	alice, bob := env.User(t), env.User(t)
+	from := env.Account(t, alice, "10000")
+	usd, err := env.Svc.CreateAccount(bob.ID, models.CreateAccountRequest{Currency: "USD"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Svc.Transfer(testutil.Actor(alice), models.TransferRequest{
+		FromAccountID: from.ID, ToAccountID: usd.ID, Amount: decimal.NewFromInt(900),
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	filter := func(min, max string) int {
+		lo, hi := decimal.RequireFromString(min), decimal.RequireFromString(max)
+		page, err := env.Svc.GetTransactions(bob.ID, usd.ID, models.TransactionFilter{MinAmount: &lo, MaxAmount: &hi}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(page.Items)
+	}
+	// зачислено 9.90 USD за 900 RUB
+	if n := filter("9", "10"); n != 1 {
+		t.Errorf("9..10 USD: %d операций, ждали 1", n)
+	}
+	if n := filter("800", "1000"); n != 0 {
+		t.Errorf("800..1000: %d операций, ждали 0 — фильтр по сумме списания", n)
+	}
+	// у отправителя — сумма списания в рублях
+	lo, hi := decimal.NewFromInt(800), decimal.NewFromInt(1000)
+	page, err := env.Svc.GetTransactions(alice.ID, from.ID, models.TransactionFilter{MinAmount: &lo, MaxAmount: &hi}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || !page.Items[0].BalanceAfter.Equal(decimal.NewFromInt(9100)) {
+		t.Errorf("отправитель: %+v", page.Items)
+	}
+}
+
+// выплаченные проценты фильтруются по типу interest
+func TestHistoryInterestType(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	acc, err := env.Svc.CreateAccount(u.ID, models.CreateAccountRequest{Product: models.ProductSavings}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Svc.Deposit(testutil.Actor(u), models.DepositRequest{ToAccountID: acc.ID, Amount: decimal.NewFromInt(100000)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// счёт открыт и пополнен 40 дней назад: в период попадает конец месяца,
+	// когда накопительный счёт получает проценты
+	if _, err := env.DB.Exec(`UPDATE transactions SET created_at = created_at - INTERVAL '40 days' WHERE to_account_id=$1`, acc.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec(`UPDATE accounts SET accrued_through = accrued_through - 40 WHERE id=$1`, acc.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Svc.AccrueInterest(); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := env.Svc.GetTransactions(u.ID, acc.ID, models.TransactionFilter{Types: []string{models.TxInterest}}, "")
+	if err != nil {
+		t.Fatalf("фильтр interest: %v", err)
+	}
+	if len(page.Items) == 0 {
+		t.Fatal("нет выплаты процентов")
+	}
+	for _, e := range page.Items {
+		if e.Type != models.TxInterest || !e.Amount.IsPositive() {
+			t.Errorf("операция %s на %s", e.Type, e.Amount)
+		}
+	}
+}
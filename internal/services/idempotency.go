@@ -0,0 +1,77 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+)
+
+var ErrIdempotencyConflict = errors.New("ключ идемпотентности уже использован с другим запросом")
+
+// выполняет fn в транзакции. С ключом — не больше одного раза на ключ:
+// повтор с тем же телом получает сохранённый результат, с другим телом —
+// ErrIdempotencyConflict. Результат сохраняется в той же транзакции,
+// что и само движение денег.
+func idempotent[T any](s *BankService, key *models.IdempotencyKey, fn func(tx repo.TxContext) (T, error)) (T, error) {
+	var res T
+	run := func() error {
+		return s.accountRepo.WithTx(func(tx repo.TxContext) error {
+			var zero T
+			res = zero
+			if key != nil {
+				key.Replayed = false
+				rec, err := s.idempotencyRepo.GetForUpdateTx(tx, key.UserID, key.Key)
+				switch {
+				case err == nil && rec.ExpiresAt.After(time.Now()):
+					if rec.Fingerprint != key.Fingerprint {
+						return ErrIdempotencyConflict
+					}
+					key.Replayed = true
+					return json.Unmarshal(rec.Response, &res)
+				case err == nil:
+					// просроченный ключ можно использовать заново
+					if err := s.idempotencyRepo.DeleteTx(tx, key.UserID, key.Key); err != nil {
+						return err
+					}
+				case !errors.Is(err, sql.ErrNoRows):
+					return err
+				}
+			}
+
+			out, err := fn(tx)
+			if err != nil {
+				return err
+			}
+			res = out
+			if key == nil {
+				return nil
+			}
+			body, err := json.Marshal(out)
+			if err != nil {
+				return err
+			}
+			return s.idempotencyRepo.CreateTx(tx, &models.IdempotencyRecord{
+				UserID:      key.UserID,
+				Key:         key.Key,
+				Fingerprint: key.Fingerprint,
+				Response:    body,
+				ExpiresAt:   time.Now().Add(time.Duration(s.cfg.IdempotencyTTLHours) * time.Hour),
+			})
+		})
+	}
+	err := run()
+	// параллельный запрос с тем же ключом закоммитил первым — отдаём его результат
+	if key != nil && repo.IsUniqueViolation(err) {
+		err = run()
+	}
+	return res, err
+}
+
+// чистка просроченных ключей идемпотентности
+func (s *BankService) PurgeIdempotencyKeys() (int64, error) {
+	return s.idempotencyRepo.DeleteExpired()
+}
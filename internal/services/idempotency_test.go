@@ -0,0 +1,139 @@
+package services_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ключ как из заголовка Idempotency-Key: отпечаток — sha256 тела запроса
+func idemKey(u *models.User, key, body string) *models.IdempotencyKey {
+	sum := sha256.Sum256([]byte(body))
+	return &models.IdempotencyKey{UserID: u.ID, Key: key, Fingerprint: hex.EncodeToString(sum[:])}
+}
+
+// переводы со счёта и его остаток
+func transferState(t *testing.T, env *testutil.Env, accID uuid.UUID) (n int, bal decimal.Decimal) {
+	t.Helper()
+	if err := env.DB.Get(&n, `SELECT COUNT(*) FROM transactions WHERE from_account_id=$1`, accID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.DB.Get(&bal, `SELECT balance FROM accounts WHERE id=$1`, accID); err != nil {
+		t.Fatal(err)
+	}
+	return n, bal
+}
+
+// повтор с тем же ключом и телом получает сохранённый ответ без второй
+// проводки, с другим телом — ErrIdempotencyConflict
+func TestIdempotentReplay(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	alice, bob := env.User(t), env.User(t)
+	from := env.Account(t, alice, "1000")
+	to := env.Account(t, bob, "0")
+	req := models.TransferRequest{FromAccountID: from.ID, ToAccountID: to.ID, Amount: decimal.NewFromInt(100)}
+	key := uuid.NewString()
+
+	first, err := env.Svc.Transfer(testutil.Actor(alice), req, idemKey(alice, key, "100"))
+	if err != nil {
+		t.Fatalf("перевод: %v", err)
+	}
+	replayKey := idemKey(alice, key, "100")
+	replay, err := env.Svc.Transfer(testutil.Actor(alice), req, replayKey)
+	if err != nil {
+		t.Fatalf("повтор: %v", err)
+	}
+	if !replayKey.Replayed || replay.ID != first.ID || !replay.Amount.Equal(first.Amount) {
+		t.Errorf("повтор: replayed=%v, операция %s, ждали сохранённую %s", replayKey.Replayed, replay.ID, first.ID)
+	}
+	if n, bal := transferState(t, env, from.ID); n != 1 || !bal.Equal(decimal.NewFromInt(900)) {
+		t.Errorf("после повтора: переводов %d, остаток %s; ждали 1 и 900", n, bal)
+	}
+
+	other := req
+	other.Amount = decimal.NewFromInt(200)
+	if _, err := env.Svc.Transfer(testutil.Actor(alice), other, idemKey(alice, key, "200")); !errors.Is(err, services.ErrIdempotencyConflict) {
+		t.Errorf("тот же ключ с другим телом: %v, ждали ErrIdempotencyConflict", err)
+	}
+	if n, _ := transferState(t, env, from.ID); n != 1 {
+		t.Errorf("после конфликта переводов %d, ждали 1", n)
+	}
+}
+
+// после IDEMPOTENCY_TTL_HOURS ключ свободен: запрос выполняется заново
+func TestIdempotencyKeyExpires(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	alice, bob := env.User(t), env.User(t)
+	from := env.Account(t, alice, "1000")
+	to := env.Account(t, bob, "0")
+	req := models.TransferRequest{FromAccountID: from.ID, ToAccountID: to.ID, Amount: decimal.NewFromInt(100)}
+	key := uuid.NewString()
+
+	first, err := env.Svc.Transfer(testutil.Actor(alice), req, idemKey(alice, key, "100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec(`UPDATE idempotency_keys SET expires_at = NOW() - INTERVAL '1 second' WHERE user_id=$1 AND key=$2`, alice.ID, key); err != nil {
+		t.Fatal(err)
+	}
+	// другое тело тоже допустимо: старый ключ уже ни к чему не обязывает
+	req.Amount = decimal.NewFromInt(50)
+	again := idemKey(alice, key, "50")
+	second, err := env.Svc.Transfer(testutil.Actor(alice), req, again)
+	if err != nil {
+		t.Fatalf("перевод с просроченным ключом: %v", err)
+	}
+	if again.Replayed || second.ID == first.ID {
+		t.Errorf("просроченный ключ вернул сохранённый ответ")
+	}
+	if n, bal := transferState(t, env, from.ID); n != 2 || !bal.Equal(decimal.NewFromInt(850)) {
+		t.Errorf("переводов %d, остаток %s; ждали 2 и 850", n, bal)
+	}
+}
+
+// параллельные запросы с одним ключом: проводка одна, остальные получают
+// её результат
+func TestIdempotentConcurrent(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	alice, bob := env.User(t), env.User(t)
+	from := env.Account(t, alice, "1000")
+	to := env.Account(t, bob, "0")
+	req := models.TransferRequest{FromAccountID: from.ID, ToAccountID: to.ID, Amount: decimal.NewFromInt(100)}
+	key := uuid.NewString()
+
+	const workers = 8
+	ids := make([]uuid.UUID, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			tr, err := env.Svc.Transfer(testutil.Actor(alice), req, idemKey(alice, key, "100"))
+			if err == nil {
+				ids[w] = tr.ID
+			}
+			errs[w] = err
+		}(w)
+	}
+	wg.Wait()
+	for w, err := range errs {
+		if err != nil {
+			t.Errorf("запрос %d: %v", w, err)
+		} else if ids[w] != ids[0] {
+			t.Errorf("запрос %d: операция %s, у первого %s", w, ids[w], ids[0])
+		}
+	}
+	if n, bal := transferState(t, env, from.ID); n != 1 || !bal.Equal(decimal.NewFromInt(900)) {
+		t.Errorf("переводов %d, остаток %s; ждали 1 и 900", n, bal)
+	}
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrUnknownProduct     = errors.New("продукт: current, savings или term_deposit")
+	ErrProductUnavailable = errors.New("продукт недоступен в этой валюте")
+	ErrDepositLocked      = errors.New("срочный вклад: до окончания срока деньги можно забрать только досрочным расторжением")
+	ErrNotTermDeposit     = errors.New("счёт не является действующим срочным вкладом")
+	ErrCurrencyMismatch   = errors.New("счёт зачисления должен быть в валюте вклада")
+)
+
+// условия нового счёта по продукту; ставка вклада фиксируется здесь
+func (s *BankService) applyProduct(acc *models.Account, req models.CreateAccountRequest) error {
+	code := req.Product
+	if code == "" {
+		code = models.ProductCurrent
+	}
+	switch code {
+	case models.ProductCurrent, models.ProductSavings, models.ProductTermDeposit:
+	default:
+		return ErrUnknownProduct
+	}
+	p, err := s.productRepo.Get(code, acc.Currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s %s", ErrProductUnavailable, code, acc.Currency)
+	}
+	if err != nil {
+		return err
+	}
+	today := moscowDay(time.Now())
+	acc.Product = code
+	// проценты начисляются со следующего дня после открытия
+	acc.AccruedThrough = &today
+	switch code {
+	case models.ProductSavings:
+		// выплата в конце месяца на сам счёт — это и есть капитализация
+		acc.Capitalize = true
+	case models.ProductTermDeposit:
+		if req.TermMonths < p.MinTermMonths || req.TermMonths > p.MaxTermMonths {
+			return fmt.Errorf("срок вклада в %s — от %d до %d месяцев", acc.Currency, p.MinTermMonths, p.MaxTermMonths)
+		}
+		matures := today.AddDate(0, req.TermMonths, 0)
+		acc.InterestRate = &p.AnnualRate
+		acc.PenaltyRate = &p.PenaltyRate
+		acc.TermMonths = &req.TermMonths
+		acc.MaturesOn = &matures
+		acc.Capitalize = req.Capitalize
+	}
+	return nil
+}
+
+// до окончания срока со вклада нельзя списывать
+func withdrawable(acc *models.Account, now time.Time) error {
+	if acc.Product == models.ProductTermDeposit && acc.MaturesOn != nil && moscowDay(now).Before(*acc.MaturesOn) {
+		return ErrDepositLocked
+	}
+	return nil
+}
+
+func (s *BankService) ListAccountProducts() ([]models.AccountProduct, error) {
+	return s.productRepo.List()
+}
+
+// ночное начисление процентов за все прошедшие дни до вчера включительно;
+// пропущенные ночи догоняются по остаткам на конец каждого дня
+func (s *BankService) AccrueInterest() error {
+	through := moscowDay(time.Now()).AddDate(0, 0, -1)
+	ids, err := s.accountRepo.ListInterestBearing()
+	if err != nil {
+		return err
+	}
+	rates := make(map[string]decimal.Decimal) // ставки накопительных счетов по валютам
+	for _, id := range ids {
+		err := s.accountRepo.WithTx(func(tx repo.TxContext) error {
+			acc, err := s.accountRepo.GetByIDForUpdateTx(tx, id)
+			if err != nil {
+				return err
+			}
+			rate, err := s.accountRate(acc, rates)
+			if err != nil {
+				return err
+			}
+			if err := s.accrue(tx, acc, rate, through); err != nil {
+				return err
+			}
+			return s.accountRepo.UpdateInterestTx(tx, acc)
+		})
+		if err != nil {
+			logrus.Errorf("начисление процентов по счёту %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// ставка вклада зафиксирована на счёте, накопительного — текущая по продукту
+func (s *BankService) accountRate(acc *models.Account, cache map[string]decimal.Decimal) (decimal.Decimal, error) {
+	if acc.InterestRate != nil {
+		return *acc.InterestRate, nil
+	}
+	if rate, ok := cache[acc.Currency]; ok {
+		return rate, nil
+	}
+	p, err := s.productRepo.Get(acc.Product, acc.Currency)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	cache[acc.Currency] = p.AnnualRate
+	return p.AnnualRate, nil
+}
+
+// начисляет проценты по дням до through: остаток на конец дня * ставка /
+// дней в году. Точная сумма копится в Accrued, в книгу идут только целые
+// копейки, остаток переносится на следующий день
+func (s *BankService) accrue(tx repo.TxContext, acc *models.Account, rate decimal.Decimal, through time.Time) error {
+	if acc.AccruedThrough == nil {
+		opened := moscowDay(acc.CreatedAt)
+		acc.AccruedThrough = &opened
+	}
+	// выплаты этого прогона: BalanceAt их не видит, у них время «сейчас»
+	paid := decimal.Zero
+	for d := acc.AccruedThrough.AddDate(0, 0, 1); !d.After(through); d = d.AddDate(0, 0, 1) {
+		if acc.MaturesOn != nil && !d.Before(*acc.MaturesOn) {
+			break
+		}
+		bal, err := s.transactionRepo.BalanceAt(acc.ID, time.Date(d.Year(), d.Month(), d.Day()+1, 0, 0, 0, 0, moscow))
+		if err != nil {
+			return err
+		}
+		bal = bal.Add(paid)
+		if bal.IsPositive() && rate.IsPositive() {
+			acc.Accrued = acc.Accrued.Add(bal.Mul(rate).Div(decimal.NewFromInt(int64(daysInYear(d.Year())))).Round(6))
+		}
+		day := d
+		acc.AccruedThrough = &day
+
+		lastDay := acc.MaturesOn != nil && d.AddDate(0, 0, 1).Equal(*acc.MaturesOn)
+		monthEnd := d.AddDate(0, 0, 1).Day() == 1
+		if lastDay || (acc.Capitalize && monthEnd) {
+			amount, err := s.payInterest(tx, acc, fmt.Sprintf("проценты по счёту %s за период по %s", acc.Number, d.Format("02.01.2006")))
+			if err != nil {
+				return err
+			}
+			paid = paid.Add(amount)
+		}
+		if lastDay {
+			// доли копейки после последней выплаты в книгу не попали — списываем
+			acc.Accrued = decimal.Zero
+		}
+	}
+	return s.recognizeInterest(tx, acc)
+}
+
+func daysInYear(y int) int {
+	if time.Date(y, 12, 31, 0, 0, 0, 0, time.UTC).YearDay() == 366 {
+		return 366
+	}
+	return 365
+}
+
+// отражает в книге целые копейки начисленного: расходы -> обязательства
+func (s *BankService) recognizeInterest(tx repo.TxContext, acc *models.Account) error {
+	target := acc.Accrued.Truncate(models.Currencies[acc.Currency].Exponent)
+	delta := target.Sub(acc.AccruedPosted)
+	if !delta.IsPositive() {
+		return nil
+	}
+	if err := s.postInternal(tx, "начисление процентов по счёту "+acc.Number,
+		debit(models.SystemAccount(models.SystemInterestExpense, acc.Currency), delta),
+		credit(models.SystemAccount(models.SystemInterestPayable, acc.Currency), delta),
+	); err != nil {
+		return err
+	}
+	acc.AccruedPosted = target
+	return nil
+}
+
+// выплачивает на счёт всё начисленное в целых копейках
+func (s *BankService) payInterest(tx repo.TxContext, acc *models.Account, note string) (decimal.Decimal, error) {
+	if err := s.recognizeInterest(tx, acc); err != nil {
+		return decimal.Zero, err
+	}
+	amount := acc.AccruedPosted
+	if !amount.IsPositive() {
+		return decimal.Zero, nil
+	}
+	tr := &models.Transaction{
+		To:        &acc.ID,
+		Amount:    amount,
+		Currency:  acc.Currency,
+		Type:      models.TxInterest,
+		Note:      note,
+		CreatedAt: time.Now(),
+	}
+	if err := s.post(tx, tr,
+		debit(models.SystemAccount(models.SystemInterestPayable, acc.Currency), amount),
+		credit(acc.ID, amount),
+	); err != nil {
+		return decimal.Zero, err
+	}
+	acc.Balance = acc.Balance.Add(amount)
+	acc.Accrued = acc.Accrued.Sub(amount)
+	acc.AccruedPosted = decimal.Zero
+	acc.InterestPaid = acc.InterestPaid.Add(amount)
+	return amount, nil
+}
+
+// досрочное расторжение вклада: проценты пересчитываются по штрафной
+// ставке, весь остаток переводится на счёт toAccountID в той же валюте
+func (s *BankService) TerminateDeposit(actor models.Actor, accountID uuid.UUID, req models.TerminateDepositRequest, key *models.IdempotencyKey) (*models.DepositTermination, error) {
+	userID := actor.UserID
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, err
+	}
+	if accountID == req.ToAccountID {
+		return nil, errors.New("невозможно перевести на тот же счёт")
+	}
+	return idempotent(s, key, func(tx repo.TxContext) (*models.DepositTermination, error) {
+		accs, err := s.accountRepo.LockTx(tx, accountID, req.ToAccountID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		dep, to := accs[accountID], accs[req.ToAccountID]
+		if err := s.authorizeAccount(userID, dep, models.AccessOperate); err != nil {
+			return nil, err
+		}
+		if to.UserID == models.SystemUserID {
+			return nil, ErrAccountNotFound
+		}
+		for _, a := range []*models.Account{dep, to} {
+			if err := accountUsable(a); err != nil {
+				return nil, err
+			}
+		}
+		if withdrawable(dep, time.Now()) == nil || dep.InterestRate == nil {
+			return nil, ErrNotTermDeposit
+		}
+		if dep.Currency != to.Currency {
+			return nil, ErrCurrencyMismatch
+		}
+		before := dep.Balance
+		today := moscowDay(time.Now())
+		// сначала доначисляем по вчерашний день, чтобы пересчитать всё
+		if err := s.accrue(tx, dep, *dep.InterestRate, today.AddDate(0, 0, -1)); err != nil {
+			return nil, err
+		}
+
+		// по штрафной ставке на тех же остатках выходит пропорционально меньше
+		earned := dep.InterestPaid.Add(dep.Accrued)
+		atPenalty := decimal.Zero
+		if dep.InterestRate.IsPositive() && dep.PenaltyRate != nil {
+			atPenalty = earned.Mul(*dep.PenaltyRate).Div(*dep.InterestRate).
+				Truncate(models.Currencies[dep.Currency].Exponent)
+		}
+		adjustment := atPenalty.Sub(dep.InterestPaid)
+		expense := models.SystemAccount(models.SystemInterestExpense, dep.Currency)
+		payable := models.SystemAccount(models.SystemInterestPayable, dep.Currency)
+		var legs []models.Posting
+		// начисленное, но не выплаченное сторнируем
+		if dep.AccruedPosted.IsPositive() {
+			legs = append(legs, debit(payable, dep.AccruedPosted), credit(expense, dep.AccruedPosted))
+		}
+		tr := &models.Transaction{
+			Currency:  dep.Currency,
+			Type:      models.TxInterest,
+			Note:      "пересчёт процентов при досрочном расторжении вклада " + dep.Number,
+			CreatedAt: time.Now(),
+		}
+		switch {
+		case adjustment.IsPositive():
+			tr.To, tr.Amount = &dep.ID, adjustment
+			legs = append(legs, debit(expense, adjustment), credit(dep.ID, adjustment))
+		case adjustment.IsNegative():
+			tr.From, tr.Amount = &dep.ID, adjustment.Neg()
+			legs = append(legs, debit(dep.ID, adjustment.Neg()), credit(expense, adjustment.Neg()))
+		}
+		if tr.Amount.IsPositive() {
+			if err := s.post(tx, tr, legs...); err != nil {
+				return nil, err
+			}
+		} else if len(legs) > 0 {
+			if err := s.postInternal(tx, tr.Note, legs...); err != nil {
+				return nil, err
+			}
+		}
+		dep.Balance = dep.Balance.Add(adjustment)
+		dep.Accrued, dep.AccruedPosted, dep.InterestPaid = decimal.Zero, decimal.Zero, atPenalty
+		// срок закончился сегодня: начисление прекращено, списания разрешены
+		dep.MaturesOn = &today
+		if err := s.accountRepo.UpdateInterestTx(tx, dep); err != nil {
+			return nil, err
+		}
+
+		res := &models.DepositTermination{InterestPaid: atPenalty, Adjustment: adjustment}
+		if dep.Balance.IsPositive() {
+			sweep := &models.Transaction{
+				From:      &dep.ID,
+				To:        &to.ID,
+				Amount:    dep.Balance,
+				Currency:  dep.Currency,
+				Type:      models.TxTransfer,
+				Note:      "досрочное расторжение вклада " + dep.Number,
+				CreatedAt: time.Now(),
+			}
+			if err := s.post(tx, sweep, debit(dep.ID, dep.Balance), credit(to.ID, dep.Balance)); err != nil {
+				return nil, err
+			}
+			res.Transfer = sweep
+			dep.Balance = decimal.Zero
+		}
+		res.Account = *dep
+		return res, s.auditTx(tx, actor, auditEntry{
+			Action:       "deposit.terminate",
+			ResourceType: "account",
+			ResourceID:   dep.ID.String(),
+			Before:       map[string]decimal.Decimal{"balance": before, "interest_paid": earned},
+			After:        map[string]decimal.Decimal{"balance": dep.Balance, "interest_paid": atPenalty},
+			Details:      map[string]string{"to_account_id": to.ID.String(), "adjustment": adjustment.String()},
+		})
+	})
+}
+
+// смена ставок продукта из бэк-офиса
+func (s *BankService) AdminSetProductRate(actor models.Actor, code string, req models.SetProductRateRequest) (*models.AccountProduct, error) {
+	currency, err := parseCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if req.AnnualRate.IsNegative() || (req.PenaltyRate != nil && req.PenaltyRate.IsNegative()) {
+		return nil, errors.New("ставка не может быть отрицательной")
+	}
+	var p *models.AccountProduct
+	err = s.productRepo.WithTx(func(tx repo.TxContext) error {
+		var err error
+		p, err = s.productRepo.GetForUpdateTx(tx, code, currency)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s %s", ErrProductUnavailable, code, currency)
+		}
+		if err != nil {
+			return err
+		}
+		before := map[string]decimal.Decimal{"annual_rate": p.AnnualRate, "penalty_rate": p.PenaltyRate}
+		p.AnnualRate = req.AnnualRate
+		if req.PenaltyRate != nil {
+			p.PenaltyRate = *req.PenaltyRate
+		}
+		if err := s.productRepo.SetRatesTx(tx, p); err != nil {
+			return err
+		}
+		return s.auditTx(tx, actor, auditEntry{
+			Action:       "admin.product.set_rate",
+			ResourceType: "account_product",
+			ResourceID:   code + "/" + currency,
+			Before:       before,
+			After:        map[string]decimal.Decimal{"annual_rate": p.AnnualRate, "penalty_rate": p.PenaltyRate},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"bankapp/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// typ access-токена; другие токены сервиса подписаны внутренним ключом
+const accessTokenType = "access"
+
+var (
+	ErrUnknownJWTKey = errors.New("неизвестный ключ подписи токена")
+	errJWTKeyType    = errors.New("поддерживаются только ключи RSA (от 2048 бит) и Ed25519")
+)
+
+// открытый ключ в формате JWK (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type verifyKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	jwk    JWK
+}
+
+// ключи JWT: один подписывающий и несколько проверочных — на время ротации
+// старые открытые ключи остаются, пока не истекут выданные ими токены.
+// Без JWT_SIGNING_KEY_PATH работает старый режим HS256 с JWT_SECRET.
+type JWTKeySet struct {
+	signMethod jwt.SigningMethod
+	signKey    interface{}
+	signKID    string
+	verify     map[string]verifyKey
+	hmacSecret []byte
+}
+
+func LoadJWTKeySet(cfg *config.Config) (*JWTKeySet, error) {
+	if cfg.JWTSigningKeyPath == "" {
+		logrus.Warn("JWT_SIGNING_KEY_PATH не задан: токены подписываются HS256, JWKS пуст")
+		return &JWTKeySet{
+			signMethod: jwt.SigningMethodHS256,
+			hmacSecret: []byte(cfg.JWTSecret),
+		}, nil
+	}
+	ks := &JWTKeySet{verify: make(map[string]verifyKey)}
+
+	priv, err := readPrivateKey(cfg.JWTSigningKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("ключ подписи %s: %w", cfg.JWTSigningKeyPath, err)
+	}
+	vk, err := newVerifyKey(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	ks.signMethod, ks.signKey, ks.signKID = vk.method, priv, vk.jwk.Kid
+	ks.verify[vk.jwk.Kid] = vk
+
+	for _, path := range cfg.JWTVerifyKeyPaths {
+		pub, err := readPublicKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("проверочный ключ %s: %w", path, err)
+		}
+		vk, err := newVerifyKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("проверочный ключ %s: %w", path, err)
+		}
+		ks.verify[vk.jwk.Kid] = vk
+	}
+	logrus.Infof("JWT: подпись %s kid=%s, проверочных ключей: %d", ks.signMethod.Alg(), ks.signKID, len(ks.verify))
+	return ks, nil
+}
+
+// подписывает claims текущим ключом и ставит kid в заголовок
+func (ks *JWTKeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signMethod, claims)
+	if ks.hmacSecret != nil {
+		return token.SignedString(ks.hmacSecret)
+	}
+	token.Header["kid"] = ks.signKID
+	return token.SignedString(ks.signKey)
+}
+
+// разбирает и проверяет подпись любым из действующих ключей
+func (ks *JWTKeySet) Parse(tokenStr string, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	opts = append([]jwt.ParserOption{jwt.WithValidMethods(ks.methods())}, opts...)
+	return jwt.Parse(tokenStr, ks.keyFunc, opts...)
+}
+
+func (ks *JWTKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if ks.hmacSecret != nil {
+		return ks.hmacSecret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	vk, ok := ks.verify[kid]
+	if !ok {
+		return nil, ErrUnknownJWTKey
+	}
+	// алгоритм берём из ключа, а не из заголовка токена
+	if token.Method.Alg() != vk.method.Alg() {
+		return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
+	}
+	return vk.public, nil
+}
+
+func (ks *JWTKeySet) methods() []string {
+	if ks.hmacSecret != nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, vk := range ks.verify {
+		if alg := vk.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			out = append(out, alg)
+		}
+	}
+	return out
+}
+
+// открытые ключи для /.well-known/jwks.json; подписывающий — первым
+func (ks *JWTKeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	if ks.hmacSecret != nil {
+		return set
+	}
+	set.Keys = append(set.Keys, ks.verify[ks.signKID].jwk)
+	for kid, vk := range ks.verify {
+		if kid != ks.signKID {
+			set.Keys = append(set.Keys, vk.jwk)
+		}
+	}
+	return set
+}
+
+func newVerifyKey(pub crypto.PublicKey) (verifyKey, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return verifyKey{}, errJWTKeyType
+		}
+		jwk := JWK{Kty: "RSA", Use: "sig", Alg: "RS256",
+			N: b64(k.N.Bytes()), E: b64(big.NewInt(int64(k.E)).Bytes())}
+		// RFC 7638: обязательные поля в лексикографическом порядке
+		jwk.Kid = thumbprint(map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N})
+		return verifyKey{jwt.SigningMethodRS256, k, jwk}, nil
+	case ed25519.PublicKey:
+		jwk := JWK{Kty: "OKP", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: b64(k)}
+		jwk.Kid = thumbprint(map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X})
+		return verifyKey{jwt.SigningMethodEdDSA, k, jwk}, nil
+	}
+	return verifyKey{}, errJWTKeyType
+}
+
+// JWK thumbprint: json.Marshal сортирует ключи map, пробелов не добавляет
+func thumbprint(members map[string]string) string {
+	raw, _ := json.Marshal(members)
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("не найден PEM-блок")
+	}
+	return block, nil
+}
+
+// PKCS#8 (RSA, Ed25519) или PKCS#1 (RSA)
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := k.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, errJWTKeyType
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// открытый ключ (PKIX или PKCS#1); закрытый ключ тоже подходит
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	priv, err := readPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return priv.Public(), nil
+}
+
+// mfa_token и step-up токены нужны только этому сервису. Они подписываются
+// HS256 ключом из HMAC_SECRET, который не публикуется в JWKS, — сервисы,
+// проверяющие токены по JWKS, не примут их за access-токен
+const internalTokenKeyPurpose = "internal-jwt"
+
+func (s *BankService) signInternalToken(claims jwt.MapClaims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.internalTokenKey())
+}
+
+// проверяет подпись, срок и typ; claims возвращаются только у годного токена
+func (s *BankService) parseInternalToken(tokenStr, typ string) (jwt.MapClaims, bool) {
+	token, err := jwt.Parse(tokenStr, func(*jwt.Token) (interface{}, error) {
+		return s.internalTokenKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != typ {
+		return nil, false
+	}
+	return claims, true
+}
+
+func (s *BankService) internalTokenKey() []byte {
+	return deriveKey(s.cfg.HMACSecret, internalTokenKeyPurpose)
+}
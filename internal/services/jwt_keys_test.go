@@ -0,0 +1,134 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bankapp/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// сервис без базы: только конфиг и ключи, подписывающие токены
+func tokenService(t *testing.T) *BankService {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		JWTSigningKeyPath: path,
+		JWTAudience:       "bankapp",
+		HMACSecret:        "test-hmac-secret",
+		AccessTokenTTLMin: 15,
+	}
+	ks, err := LoadJWTKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &BankService{cfg: cfg, jwtKeys: ks}
+}
+
+// access-токен несёт aud и typ — по ним его отличают сервисы, проверяющие по JWKS
+func TestAccessTokenClaims(t *testing.T) {
+	s := tokenService(t)
+	tokenStr, err := s.generateJWT(uuid.NewString(), uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.jwtKeys.Parse(tokenStr, jwt.WithAudience("bankapp"))
+	if err != nil {
+		t.Fatalf("access-токен не проходит проверку по JWKS с aud: %v", err)
+	}
+	if typ := token.Claims.(jwt.MapClaims)["typ"]; typ != accessTokenType {
+		t.Errorf("typ %v, ждали %q", typ, accessTokenType)
+	}
+	if _, err := s.jwtKeys.Parse(tokenStr, jwt.WithAudience("other-service")); err == nil {
+		t.Error("токен принят с чужим aud")
+	}
+}
+
+// mfa- и step-up-токены подписаны ключом, которого нет в JWKS, поэтому
+// ни мы, ни внешний сервис не примут их за access-токен
+func TestInternalTokensNotVerifiableByJWKS(t *testing.T) {
+	s := tokenService(t)
+	userID := uuid.New()
+	mfa, err := s.generateMFAToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stepUp, err := s.signInternalToken(jwt.MapClaims{
+		"sub": userID.String(),
+		"typ": "step_up",
+		"jti": uuid.NewString(),
+		"exp": time.Now().Add(stepUpTokenTTL).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tokenStr := range map[string]string{"mfa": mfa, "step_up": stepUp} {
+		if _, err := s.jwtKeys.Parse(tokenStr); err == nil {
+			t.Errorf("%s: токен проверяется ключами из JWKS", name)
+		}
+		if _, err := s.ParseToken(tokenStr); err == nil {
+			t.Errorf("%s: принят как access-токен", name)
+		}
+	}
+
+	if got, err := s.parseMFAToken(mfa); err != nil || got != userID {
+		t.Errorf("mfa: %v, %v", got, err)
+	}
+	if _, err := s.parseStepUpToken(stepUp, userID); err != nil {
+		t.Errorf("step_up: %v", err)
+	}
+	// typ сверяется: step-up не годится вместо mfa и наоборот
+	if _, err := s.parseMFAToken(stepUp); err == nil {
+		t.Error("step-up токен принят как mfa")
+	}
+	if _, err := s.parseStepUpToken(mfa, userID); err == nil {
+		t.Error("mfa-токен принят как step-up")
+	}
+}
+
+// токены, подписанные ключом JWKS, но без aud или с другим typ, не годятся
+// как access; до проверки сессии дело не доходит
+func TestParseTokenRequiresAudienceAndType(t *testing.T) {
+	s := tokenService(t)
+	base := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"aud": "bankapp",
+			"typ": accessTokenType,
+			"sub": uuid.NewString(),
+			"sid": uuid.NewString(),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	noAud, noTyp, mfaTyp := base(), base(), base()
+	delete(noAud, "aud")
+	delete(noTyp, "typ")
+	mfaTyp["typ"] = "mfa"
+	for name, claims := range map[string]jwt.MapClaims{"без aud": noAud, "без typ": noTyp, "typ=mfa": mfaTyp} {
+		tokenStr, err := s.jwtKeys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.ParseToken(tokenStr); err == nil {
+			t.Errorf("%s: токен принят", name)
+		}
+	}
+}
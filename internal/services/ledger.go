@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrUnbalancedEntry   = errors.New("проводка не сбалансирована")
+	ErrInsufficientFunds = errors.New("недостаточно средств")
+)
+
+func debit(accountID uuid.UUID, amount decimal.Decimal) models.Posting {
+	return models.Posting{AccountID: accountID, Direction: models.PostingDebit, Amount: amount}
+}
+
+func credit(accountID uuid.UUID, amount decimal.Decimal) models.Posting {
+	return models.Posting{AccountID: accountID, Direction: models.PostingCredit, Amount: amount}
+}
+
+// единственный способ двигать деньги: пишет операцию в transactions
+// и привязанную к ней проводку, в которой дебет равен кредиту в каждой валюте
+func (s *BankService) post(tx repo.TxContext, tr *models.Transaction, legs ...models.Posting) error {
+	if err := s.checkBalanced(tx, legs); err != nil {
+		return err
+	}
+	if err := s.transactionRepo.CreateTx(tx, tr); err != nil {
+		return err
+	}
+	if err := s.ledgerRepo.CreateEntryTx(tx, &models.JournalEntry{
+		TransactionID: &tr.ID,
+		Description:   tr.Note,
+		Postings:      legs,
+	}); err != nil {
+		return err
+	}
+	// остатки после операции — для истории и выписок
+	return s.transactionRepo.SetBalancesAfterTx(tx, tr.ID)
+}
+
+// проводка только между внутренними счетами банка (начисление процентов
+// в обязательства): клиенту она не видна, поэтому без записи в transactions
+func (s *BankService) postInternal(tx repo.TxContext, description string, legs ...models.Posting) error {
+	// счёт системный, если у него задан system_code, — по самим данным,
+	// а не по виду id
+	ids := make([]uuid.UUID, len(legs))
+	for i, l := range legs {
+		ids[i] = l.AccountID
+	}
+	clients, err := s.accountRepo.ClientAccountsTx(tx, ids)
+	if err != nil {
+		return err
+	}
+	if len(clients) > 0 {
+		return fmt.Errorf("%w: клиентский счёт %s во внутренней проводке", ErrUnbalancedEntry, clients[0])
+	}
+	if err := s.checkBalanced(tx, legs); err != nil {
+		return err
+	}
+	return s.ledgerRepo.CreateEntryTx(tx, &models.JournalEntry{Description: description, Postings: legs})
+}
+
+// дебет равен кредиту в каждой валюте, суммы не мельче единицы валюты
+func (s *BankService) checkBalanced(tx repo.TxContext, legs []models.Posting) error {
+	if len(legs) < 2 {
+		return fmt.Errorf("%w: меньше двух сторон", ErrUnbalancedEntry)
+	}
+	ids := make([]uuid.UUID, len(legs))
+	for i, l := range legs {
+		ids[i] = l.AccountID
+	}
+	currencies, err := s.accountRepo.CurrenciesTx(tx, ids)
+	if err != nil {
+		return err
+	}
+	debits := make(map[string]decimal.Decimal)
+	credits := make(map[string]decimal.Decimal)
+	for _, l := range legs {
+		if !l.Amount.IsPositive() {
+			return fmt.Errorf("%w: сумма %s", ErrUnbalancedEntry, l.Amount)
+		}
+		cur, ok := currencies[l.AccountID]
+		if !ok {
+			return fmt.Errorf("%w: нет счёта %s", ErrUnbalancedEntry, l.AccountID)
+		}
+		if !models.RoundAmount(l.Amount, cur).Equal(l.Amount) {
+			return fmt.Errorf("%w: сумма %s мельче единицы %s", ErrUnbalancedEntry, l.Amount, cur)
+		}
+		switch l.Direction {
+		case models.PostingDebit:
+			debits[cur] = debits[cur].Add(l.Amount)
+		case models.PostingCredit:
+			credits[cur] = credits[cur].Add(l.Amount)
+		default:
+			return fmt.Errorf("%w: направление %q", ErrUnbalancedEntry, l.Direction)
+		}
+	}
+	for cur := range models.Currencies {
+		if !debits[cur].Equal(credits[cur]) {
+			return fmt.Errorf("%w: %s дебет %s, кредит %s", ErrUnbalancedEntry, cur, debits[cur], credits[cur])
+		}
+	}
+	return nil
+}
+
+// сверка: остатки счетов совпадают с проводками, а книга сходится в ноль
+// по каждой валюте
+func (s *BankService) CheckLedger() error {
+	list, err := s.ledgerRepo.Mismatches()
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		m := list[0]
+		return fmt.Errorf("расхождение по %d счетам, например %s: остаток %s, по проводкам %s",
+			len(list), m.AccountID, m.Balance, m.Posted)
+	}
+	totals, err := s.ledgerRepo.TrialBalance()
+	if err != nil {
+		return err
+	}
+	for cur, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf("книга не сходится: сумма остатков в %s %s", cur, total)
+		}
+	}
+	return nil
+}
+
+// сверка из планировщика: расхождение — авария, а не строка в логе.
+// пишем в аудит и шлём письмо дежурному, ошибку возвращаем вызывающему
+func (s *BankService) ReportLedger() error {
+	err := s.CheckLedger()
+	if err == nil {
+		return nil
+	}
+	logrus.Errorf("сверка книги не прошла: %v", err)
+	s.auditBestEffort(models.Actor{UserAgent: "scheduler"}, auditEntry{
+		Action:       "ledger.mismatch",
+		ResourceType: "ledger",
+		Details:      map[string]string{"error": err.Error()},
+	})
+	if s.cfg.LedgerAlertEmail != "" {
+		if mailErr := sendEmailNotification(s.cfg, s.cfg.LedgerAlertEmail,
+			"Расхождение в книге проводок", err.Error()); mailErr != nil {
+			logrus.Errorf("письмо о расхождении книги: %v", mailErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrCloseBalance  = errors.New("на счёте остаток: укажите счёт, на который его перевести")
+	ErrActiveCredit  = errors.New("к счёту привязан непогашенный кредит")
+	ErrSweepCurrency = errors.New("остаток переводится только на счёт в той же валюте")
+)
+
+// закрытие счёта владельцем: проценты выплачиваются по вчерашний день,
+// остаток уходит на req.ToAccountID, карты закрываются
+func (s *BankService) CloseAccount(actor models.Actor, accountID uuid.UUID, req models.CloseAccountRequest, key *models.IdempotencyKey) (*models.AccountClosure, error) {
+	userID := actor.UserID
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, err
+	}
+	if req.ToAccountID != nil && *req.ToAccountID == accountID {
+		return nil, errors.New("невозможно перевести на тот же счёт")
+	}
+	return idempotent(s, key, func(tx repo.TxContext) (*models.AccountClosure, error) {
+		ids := []uuid.UUID{accountID}
+		if req.ToAccountID != nil {
+			ids = append(ids, *req.ToAccountID)
+		}
+		accs, err := s.accountRepo.LockTx(tx, ids...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		acc := accs[accountID]
+		// закрыть счёт может только владелец, не делегат
+		if acc.UserID != userID {
+			return nil, ErrForbidden
+		}
+		if err := accountUsable(acc); err != nil {
+			return nil, err
+		}
+		// вклад до срока закрывается досрочным расторжением
+		if err := withdrawable(acc, time.Now()); err != nil {
+			return nil, err
+		}
+		active, err := s.creditRepo.HasActiveTx(tx, acc.ID)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			return nil, ErrActiveCredit
+		}
+		before := acc.Balance
+
+		res := &models.AccountClosure{InterestPaid: decimal.Zero}
+		if acc.Product != models.ProductCurrent {
+			rate, err := s.accountRate(acc, map[string]decimal.Decimal{})
+			if err != nil {
+				return nil, err
+			}
+			if err := s.accrue(tx, acc, rate, moscowDay(time.Now()).AddDate(0, 0, -1)); err != nil {
+				return nil, err
+			}
+			if res.InterestPaid, err = s.payInterest(tx, acc, "проценты при закрытии счёта "+acc.Number); err != nil {
+				return nil, err
+			}
+			// доли копейки в книгу не попали — списываем
+			acc.Accrued = decimal.Zero
+			if err := s.accountRepo.UpdateInterestTx(tx, acc); err != nil {
+				return nil, err
+			}
+		}
+
+		if acc.Balance.IsPositive() {
+			if req.ToAccountID == nil {
+				return nil, ErrCloseBalance
+			}
+			to := accs[*req.ToAccountID]
+			if to.UserID == models.SystemUserID {
+				return nil, ErrAccountNotFound
+			}
+			if err := accountUsable(to); err != nil {
+				return nil, err
+			}
+			if to.Currency != acc.Currency {
+				return nil, ErrSweepCurrency
+			}
+			sweep := &models.Transaction{
+				From:      &acc.ID,
+				To:        &to.ID,
+				Amount:    acc.Balance,
+				Currency:  acc.Currency,
+				Type:      models.TxTransfer,
+				Note:      "перевод остатка при закрытии счёта " + acc.Number,
+				CreatedAt: time.Now(),
+			}
+			if err := s.post(tx, sweep, debit(acc.ID, acc.Balance), credit(to.ID, acc.Balance)); err != nil {
+				return nil, err
+			}
+			res.Transfer = sweep
+			acc.Balance = decimal.Zero
+		}
+
+		reason := req.Reason
+		if reason == "" {
+			reason = "закрыт клиентом"
+		}
+		if err := s.accountRepo.SetStatusTx(tx, acc.ID, models.AccountClosed, reason); err != nil {
+			return nil, err
+		}
+		if err := s.userRepo.ClearDefaultAccountTx(tx, acc.ID); err != nil {
+			return nil, err
+		}
+		closedCards, err := s.cardRepo.CloseByAccountTx(tx, acc.ID, "счёт закрыт")
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		acc.Status, acc.StatusReason, acc.ClosedAt = models.AccountClosed, reason, &now
+		res.Account = *acc
+
+		details := map[string]interface{}{"reason": reason, "cards_closed": closedCards}
+		if res.Transfer != nil {
+			details["to_account_id"] = res.Transfer.To.String()
+		}
+		return res, s.auditTx(tx, actor, auditEntry{
+			Action:       "account.close",
+			ResourceType: "account",
+			ResourceID:   acc.ID.String(),
+			Before:       map[string]interface{}{"status": models.AccountActive, "balance": before},
+			After:        map[string]interface{}{"status": models.AccountClosed, "balance": acc.Balance},
+			Details:      details,
+		})
+	})
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"bankapp/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("неверное имя или пароль")
+	ErrUnlockTarget       = errors.New("укажите username или ip")
+)
+
+// вход временно запрещён; RetryAfter — через сколько можно пробовать снова
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "вход временно заблокирован из-за неудачных попыток"
+	}
+	return "слишком много попыток входа, повторите позже"
+}
+
+type loginKey struct{ scope, key string }
+
+func loginKeys(username, ip string) []loginKey {
+	keys := make([]loginKey, 0, 2)
+	if username != "" {
+		keys = append(keys, loginKey{models.LoginScopeUser, username})
+	}
+	if ip != "" {
+		keys = append(keys, loginKey{models.LoginScopeIP, ip})
+	}
+	return keys
+}
+
+// отказывает, пока действует блокировка или задержка после неудач
+// по имени пользователя или по IP
+func (s *BankService) checkLoginAllowed(username, ip string) error {
+	now := time.Now()
+	var wait time.Duration
+	locked := false
+	for _, k := range loginKeys(username, ip) {
+		a, err := s.loginAttemptRepo.Get(k.scope, k.key)
+		if err != nil {
+			return err
+		}
+		if w, l := s.loginWait(a, now); w > wait {
+			wait, locked = w, l
+		}
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait, Locked: locked}
+	}
+	return nil
+}
+
+func (s *BankService) loginWait(a *models.LoginAttempt, now time.Time) (time.Duration, bool) {
+	if a == nil {
+		return 0, false
+	}
+	if a.LockedUntil != nil && now.Before(*a.LockedUntil) {
+		return a.LockedUntil.Sub(now), true
+	}
+	window := time.Duration(s.cfg.LoginFailureWindowMin) * time.Minute
+	if a.Failures == 0 || now.Sub(a.LastFailureAt) > window {
+		return 0, false
+	}
+	if next := a.LastFailureAt.Add(s.loginBackoff(a.Failures)); now.Before(next) {
+		return next.Sub(now), false
+	}
+	return 0, false
+}
+
+// base, 2·base, 4·base… но не больше max
+func (s *BankService) loginBackoff(failures int) time.Duration {
+	d := time.Duration(s.cfg.LoginBackoffBaseSec) * time.Second
+	max := time.Duration(s.cfg.LoginBackoffMaxSec) * time.Second
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// учитывает неудачу; несуществующие имена считаются так же,
+// чтобы по поведению нельзя было понять, есть ли пользователь.
+// stage — на каком шаге отказ: password или mfa
+func (s *BankService) recordLoginFailure(username string, client models.Actor, stage string) {
+	ip := client.IP
+	s.auditBestEffort(client, auditEntry{
+		Action:       "auth.login_failed",
+		ResourceType: "user",
+		ResourceID:   username,
+		Details:      map[string]string{"stage": stage},
+	})
+	window := time.Duration(s.cfg.LoginFailureWindowMin) * time.Minute
+	lockUntil := time.Now().Add(time.Duration(s.cfg.LoginLockoutMin) * time.Minute)
+	for _, k := range loginKeys(username, ip) {
+		max := s.cfg.LoginMaxFailures
+		if k.scope == models.LoginScopeIP {
+			max = s.cfg.LoginMaxFailuresIP
+		}
+		_, locked, err := s.loginAttemptRepo.RecordFailure(k.scope, k.key, window, max, lockUntil)
+		if err != nil {
+			logrus.Errorf("учёт неудачного входа %s/%s: %v", k.scope, k.key, err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+		logrus.Warnf("вход заблокирован до %s: %s=%s", lockUntil.Format(time.RFC3339), k.scope, k.key)
+		s.auditBestEffort(client, auditEntry{
+			Action:       "auth.lockout",
+			ResourceType: "login_" + k.scope,
+			ResourceID:   k.key,
+			After:        map[string]time.Time{"locked_until": lockUntil},
+		})
+		if k.scope == models.LoginScopeUser {
+			go s.notifyLoginLockout(username, ip, lockUntil)
+		}
+	}
+}
+
+func (s *BankService) resetLoginFailures(username string) {
+	if err := s.loginAttemptRepo.Reset(models.LoginScopeUser, username); err != nil {
+		logrus.Errorf("сброс счётчика входа %s: %v", username, err)
+	}
+}
+
+func (s *BankService) notifyLoginLockout(username, ip string, until time.Time) {
+	u, err := s.userRepo.GetByUsername(username)
+	if err != nil {
+		return
+	}
+	_ = sendEmailNotification(
+		s.cfg,
+		u.Email,
+		"Вход в BankApp временно заблокирован",
+		fmt.Sprintf("Здравствуйте, %s!\n\nПосле нескольких неудачных попыток вход в аккаунт заблокирован до %s (последняя попытка с адреса %s).\n"+
+			"Если это были не вы, смените пароль через «Забыли пароль?».",
+			u.Username, until.Format("02.01.2006 15:04 MST"), ip),
+	)
+}
+
+// снимает блокировку и обнуляет счётчики (служебное API)
+func (s *BankService) UnlockLogin(req models.UnlockLoginRequest) error {
+	keys := loginKeys(req.Username, req.IP)
+	if len(keys) == 0 {
+		return ErrUnlockTarget
+	}
+	for _, k := range keys {
+		if err := s.loginAttemptRepo.Reset(k.scope, k.key); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("вход разблокирован: username=%q ip=%q", req.Username, req.IP)
+	return nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+)
+
+const phoneCodeKeyPurpose = "phone-codes"
+
+// попыток ввода одного кода и пауза перед повторной отправкой
+const (
+	phoneCodeMaxAttempts = 5
+	phoneCodeResendAfter = time.Minute
+)
+
+var (
+	ErrInvalidPhone    = errors.New("телефон в международном формате, например +79991234567")
+	ErrPhoneTaken      = errors.New("номер уже привязан к другому пользователю")
+	ErrPhoneCode       = errors.New("неверный или устаревший код")
+	ErrPhoneCodeLocked = errors.New("слишком много неверных кодов, запросите новый")
+	ErrPhoneCodeResend = errors.New("код уже отправлен, повторите через минуту")
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{9,14}$`)
+
+// приводит номер к E.164; российские 8XXXXXXXXXX и 7XXXXXXXXXX — к +7
+func normalizePhone(p string) (string, error) {
+	p = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(p))
+	if len(p) == 11 && (p[0] == '8' || p[0] == '7') {
+		p = "+7" + p[1:]
+	}
+	if !e164.MatchString(p) {
+		return "", ErrInvalidPhone
+	}
+	return p, nil
+}
+
+// отправляет код подтверждения; номер привязывается только после ввода кода
+func (s *BankService) StartPhoneVerification(userID uuid.UUID, req models.PhoneRequest) error {
+	phone, err := normalizePhone(req.Phone)
+	if err != nil {
+		return err
+	}
+	owner, err := s.userRepo.GetByPhone(phone)
+	if err == nil && owner.ID != userID {
+		return ErrPhoneTaken
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	prev, err := s.phoneRepo.Get(userID)
+	if err == nil && time.Since(prev.CreatedAt) < phoneCodeResendAfter {
+		return ErrPhoneCodeResend
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	if err := s.phoneRepo.Upsert(&models.PhoneVerification{
+		UserID:    userID,
+		Phone:     phone,
+		CodeHash:  s.hashPhoneCode(userID, phone, code),
+		ExpiresAt: time.Now().Add(time.Duration(s.cfg.PhoneCodeTTLMin) * time.Minute),
+	}); err != nil {
+		return err
+	}
+	return s.sms.Send(phone, fmt.Sprintf("Код подтверждения телефона в BankApp: %s. Никому его не сообщайте.", code))
+}
+
+// проверяет код из SMS и привязывает номер
+func (s *BankService) ConfirmPhone(userID uuid.UUID, req models.PhoneConfirmRequest) error {
+	var wrong bool
+	err := s.phoneRepo.WithTx(func(tx repo.TxContext) error {
+		wrong = false
+		v, err := s.phoneRepo.GetForUpdateTx(tx, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPhoneCode
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(v.ExpiresAt) {
+			return ErrPhoneCode
+		}
+		if v.Attempts >= phoneCodeMaxAttempts {
+			return ErrPhoneCodeLocked
+		}
+		if !hmac.Equal([]byte(v.CodeHash), []byte(s.hashPhoneCode(userID, v.Phone, req.Code))) {
+			// попытку нужно сохранить, поэтому ошибку вернём после коммита
+			wrong = true
+			return s.phoneRepo.AddAttemptTx(tx, userID)
+		}
+		if err := s.userRepo.SetPhoneVerifiedTx(tx, userID, v.Phone); err != nil {
+			if repo.IsUniqueViolation(err) {
+				return ErrPhoneTaken
+			}
+			return err
+		}
+		return s.phoneRepo.DeleteTx(tx, userID)
+	})
+	if err == nil && wrong {
+		return ErrPhoneCode
+	}
+	return err
+}
+
+// счёт, на который зачисляются переводы по имени и телефону
+func (s *BankService) SetDefaultAccount(userID uuid.UUID, req models.DefaultAccountRequest) error {
+	acc, err := s.ownAccount(userID, req.AccountID)
+	if err != nil {
+		return err
+	}
+	if err := accountUsable(acc); err != nil {
+		return err
+	}
+	return s.userRepo.SetDefaultAccount(userID, &acc.ID)
+}
+
+func (s *BankService) hashPhoneCode(userID uuid.UUID, phone, code string) string {
+	return ComputeHMAC(userID.String()+"\n"+phone+"\n"+code, deriveKey(s.cfg.HMACSecret, phoneCodeKeyPurpose))
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ограничиваемые ручки: имя bucket в rate_limits
+const (
+	rateForgotEmail = "forgot_email"
+	rateForgotIP    = "forgot_ip"
+	rateRatesIP     = "rates_ip"
+	// просмотр получателя перевода, по пользователю
+	rateTransferPreview = "transfer_preview"
+)
+
+// запросов больше лимита; RetryAfter — когда закончится окно
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return "слишком много запросов, повторите позже"
+}
+
+// учитывает запрос по ключу и отказывает, если в окне их больше max.
+// max <= 0 — без ограничения
+func (s *BankService) rateLimit(bucket, key string, max int, window time.Duration) error {
+	if max <= 0 || key == "" {
+		return nil
+	}
+	hits, start, err := s.rateLimitRepo.Hit(bucket, key, window)
+	if err != nil {
+		return err
+	}
+	if hits <= max {
+		return nil
+	}
+	if hits == max+1 {
+		logrus.Warnf("лимит запросов %s превышен: %s", bucket, key)
+	}
+	return &RateLimitedError{RetryAfter: time.Until(start.Add(window))}
+}
+
+// чистка счётчиков, окна которых давно закончились
+func (s *BankService) PurgeRateLimits() (int64, error) {
+	return s.rateLimitRepo.Purge(24 * time.Hour)
+}
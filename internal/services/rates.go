@@ -0,0 +1,150 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrRatesNotPublished = errors.New("курсы на будущую дату ещё не опубликованы")
+	ErrRatesOutOfRange   = errors.New("курсы доступны только за последние FX_BACKFILL_DAYS дней")
+	ErrRatesNotLoaded    = errors.New("курсы на эту дату ещё не загружены, повторите позже")
+)
+
+// курсы для конвертации переводов из официальных курсов ЦБ (FX_SOURCE=cbr)
+type cbrFXProvider struct {
+	s *BankService
+}
+
+func (p cbrFXProvider) Rate(currency string, on time.Time) (decimal.Decimal, error) {
+	r, err := p.s.officialRate(currency, on)
+	if errors.Is(err, ErrUnknownCurrency) {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrNoFXRate, currency)
+	}
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return r.Rate, nil
+}
+
+// загружает у ЦБ курсы на день day и запоминает дату их установления
+func (s *BankService) loadRates(day time.Time) error {
+	rateDate, rates, err := s.cbr.DailyRates(day)
+	if err != nil {
+		return fmt.Errorf("курсы ЦБ на %s: %w", day.Format("2006-01-02"), err)
+	}
+	if rateDate.After(day) {
+		return fmt.Errorf("курсы ЦБ на %s: в ответе курсы на %s", day.Format("2006-01-02"), rateDate.Format("2006-01-02"))
+	}
+	return s.fxRateRepo.WithTx(func(tx repo.TxContext) error {
+		return s.fxRateRepo.SaveDayTx(tx, day, rateDate, rates)
+	})
+}
+
+// догружает курсы за дни, пропущенные за последние FX_BACKFILL_DAYS;
+// вызывается шедулером, возвращает число загруженных дней
+func (s *BankService) RefreshRates() (int, error) {
+	today := moscowDay(time.Now())
+	days, err := s.fxRateRepo.MissingDays(today.AddDate(0, 0, -s.cfg.FXBackfillDays), today)
+	if err != nil {
+		return 0, err
+	}
+	for i, day := range days {
+		if err := s.loadRates(day); err != nil {
+			return i, err
+		}
+	}
+	return len(days), nil
+}
+
+// дата установления курсов, действующих в день on. Отдаются только
+// загруженные дни за последние FX_BACKFILL_DAYS: к ЦБ ходит лишь шедулер,
+// иначе публичные /rates позволяли бы гонять запросы к ЦБ на любую дату
+func (s *BankService) rateDate(on time.Time) (day, rateDate time.Time, err error) {
+	day = moscowDay(on)
+	today := moscowDay(time.Now())
+	if day.After(today) {
+		return day, time.Time{}, ErrRatesNotPublished
+	}
+	if day.Before(today.AddDate(0, 0, -s.cfg.FXBackfillDays)) {
+		return day, time.Time{}, ErrRatesOutOfRange
+	}
+	rateDate, err = s.fxRateRepo.RateDateFor(day)
+	if errors.Is(err, sql.ErrNoRows) {
+		return day, time.Time{}, ErrRatesNotLoaded
+	}
+	return day, rateDate, err
+}
+
+// публичные /rates считаются по IP клиента
+func (s *BankService) limitRates(client models.Actor) error {
+	return s.rateLimit(rateRatesIP, client.IP, s.cfg.RatesPerMinIP, time.Minute)
+}
+
+// все официальные курсы на день on
+func (s *BankService) RatesOn(on time.Time, client models.Actor) (*models.FXRateTable, error) {
+	if err := s.limitRates(client); err != nil {
+		return nil, err
+	}
+	day, rateDate, err := s.rateDate(on)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.fxRateRepo.ListOn(rateDate)
+	if err != nil {
+		return nil, err
+	}
+	return &models.FXRateTable{Requested: day, Date: rateDate, Rates: list}, nil
+}
+
+// официальный курс валюты на день on; рубль — 1
+func (s *BankService) officialRate(currency string, on time.Time) (*models.FXRate, error) {
+	day, rateDate, err := s.rateDate(on)
+	if err != nil {
+		return nil, err
+	}
+	if currency == models.CurrencyRUB {
+		one := decimal.NewFromInt(1)
+		return &models.FXRate{Date: rateDate, Currency: currency, NumCode: "643", Nominal: 1, Value: one, Rate: one}, nil
+	}
+	r, err := s.fxRateRepo.GetOn(day, currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCurrency, currency)
+	}
+	return r, err
+}
+
+// пересчёт суммы по официальному кросс-курсу через рубль, без спреда
+func (s *BankService) ConvertOfficial(from, to string, amount decimal.Decimal, on time.Time, client models.Actor) (*models.FXConversion, error) {
+	from, to = strings.ToUpper(strings.TrimSpace(from)), strings.ToUpper(strings.TrimSpace(to))
+	if !amount.IsPositive() {
+		return nil, errors.New("сумма должна быть >0")
+	}
+	if err := s.limitRates(client); err != nil {
+		return nil, err
+	}
+	fr, err := s.officialRate(from, on)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := s.officialRate(to, on)
+	if err != nil {
+		return nil, err
+	}
+	rate := fr.Rate.Div(tr.Rate).Round(10)
+	result := amount.Mul(rate)
+	if _, ok := models.Currencies[to]; ok {
+		result = models.RoundAmount(result, to)
+	} else {
+		result = result.Round(4)
+	}
+	return &models.FXConversion{From: from, To: to, Amount: amount, Rate: rate, Result: result, Date: fr.Date}, nil
+}
@@ -0,0 +1,97 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/shopspring/decimal"
+)
+
+func ratesEnv(t *testing.T) (*testutil.Env, *services.CBRStub) {
+	stub := services.NewCBRStub(t)
+	cfg := testutil.Config()
+	cfg.CBREndpoint, cfg.CBRDailyURL = stub.URL, stub.DailyURL()
+	cfg.FXBackfillDays = 3
+	return testutil.NewEnv(t, cfg), stub
+}
+
+// запросы к /rates не ходят к ЦБ: до прогона шедулера дня нет, даты вне
+// окна FX_BACKFILL_DAYS отклоняются; после RefreshRates день отдаётся из базы
+func TestRatesServeOnlyStoredDays(t *testing.T) {
+	env, stub := ratesEnv(t)
+	// окно загружается заново с заглушки
+	if _, err := env.DB.Exec(`DELETE FROM fx_rate_days WHERE day >= CURRENT_DATE - 4`); err != nil {
+		t.Fatal(err)
+	}
+	client := models.Actor{IP: uniqueIP()}
+	now := time.Now()
+
+	if _, err := env.Svc.RatesOn(now, client); !errors.Is(err, services.ErrRatesNotLoaded) {
+		t.Errorf("незагруженный день: %v, ждали ErrRatesNotLoaded", err)
+	}
+	if _, err := env.Svc.RatesOn(now.AddDate(0, 0, -5), client); !errors.Is(err, services.ErrRatesOutOfRange) {
+		t.Errorf("дата вне окна: %v, ждали ErrRatesOutOfRange", err)
+	}
+	if _, err := env.Svc.RatesOn(now.AddDate(0, 0, 2), client); !errors.Is(err, services.ErrRatesNotPublished) {
+		t.Errorf("будущая дата: %v, ждали ErrRatesNotPublished", err)
+	}
+	if _, err := env.Svc.ConvertOfficial("USD", "EUR", decimal.NewFromInt(100), now.AddDate(-1, 0, 0), client); !errors.Is(err, services.ErrRatesOutOfRange) {
+		t.Errorf("пересчёт на дату вне окна: %v, ждали ErrRatesOutOfRange", err)
+	}
+	if n := stub.Requests.Load(); n != 0 {
+		t.Fatalf("запросы клиентов дошли до ЦБ: %d", n)
+	}
+
+	n, err := env.Svc.RefreshRates()
+	if err != nil {
+		t.Fatalf("загрузка курсов: %v", err)
+	}
+	if n < 4 || stub.Requests.Load() != int64(n) {
+		t.Errorf("загружено дней %d, запросов к ЦБ %d", n, stub.Requests.Load())
+	}
+	requests := stub.Requests.Load()
+
+	table, err := env.Svc.RatesOn(now, client)
+	if err != nil {
+		t.Fatalf("курсы на сегодня: %v", err)
+	}
+	if len(table.Rates) != 6 {
+		t.Errorf("курсов %d, ждали 6", len(table.Rates))
+	}
+	conv, err := env.Svc.ConvertOfficial("usd", "EUR", decimal.NewFromInt(100), now, client)
+	if err != nil {
+		t.Fatalf("пересчёт: %v", err)
+	}
+	rate := decimal.RequireFromString("85.6963").Div(decimal.RequireFromString("92.9503")).Round(10)
+	if !conv.Rate.Equal(rate) || !conv.Result.Equal(models.RoundAmount(decimal.NewFromInt(100).Mul(rate), "EUR")) {
+		t.Errorf("пересчёт: курс %s, сумма %s", conv.Rate, conv.Result)
+	}
+	if n := stub.Requests.Load(); n != requests {
+		t.Errorf("загруженные дни снова запрошены у ЦБ: %d запросов", n-requests)
+	}
+}
+
+func TestRatesRateLimit(t *testing.T) {
+	env, _ := ratesEnv(t)
+	env.Cfg.RatesPerMinIP = 2
+	client := models.Actor{IP: uniqueIP()}
+	// до лимита ответ любой, лимит считается раньше поиска курсов
+	for i := 0; i < 2; i++ {
+		var rl *services.RateLimitedError
+		if _, err := env.Svc.RatesOn(time.Now(), client); errors.As(err, &rl) {
+			t.Fatalf("запрос %d: %v", i+1, err)
+		}
+	}
+	var rl *services.RateLimitedError
+	if _, err := env.Svc.ConvertOfficial("USD", "EUR", decimal.NewFromInt(1), time.Now(), client); !errors.As(err, &rl) {
+		t.Errorf("третий запрос: %v, ждали RateLimitedError", err)
+	}
+	if _, err := env.Svc.RatesOn(time.Now(), models.Actor{IP: uniqueIP()}); errors.As(err, &rl) {
+		t.Errorf("другой IP: %v", err)
+	}
+}
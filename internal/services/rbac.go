@@ -0,0 +1,64 @@
+package services
+
+import (
+	"bankapp/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// права бэк-офиса
+const (
+	PermUsersRead      = "users:read"
+	PermUsersSetRole   = "users:set_role"
+	PermAccountsRead   = "accounts:read"
+	PermAccountsFreeze = "accounts:freeze"
+	PermCardsBlock     = "cards:block"
+	PermLoginUnlock    = "login:unlock"
+	PermSchedulerRun   = "scheduler:run"
+	PermAuditRead      = "audit:read"
+	PermProductsManage = "products:manage"
+)
+
+// каждая следующая роль получает права предыдущей
+var rolePermissions = func() map[string]map[string]bool {
+	support := []string{PermUsersRead, PermAccountsRead}
+	operator := append(append([]string{}, support...),
+		PermAccountsFreeze, PermCardsBlock, PermLoginUnlock)
+	admin := append(append([]string{}, operator...),
+		PermUsersSetRole, PermSchedulerRun, PermAuditRead, PermProductsManage)
+
+	set := func(perms []string) map[string]bool {
+		m := make(map[string]bool, len(perms))
+		for _, p := range perms {
+			m[p] = true
+		}
+		return m
+	}
+	return map[string]map[string]bool{
+		models.RoleCustomer: {},
+		models.RoleSupport:  set(support),
+		models.RoleOperator: set(operator),
+		models.RoleAdmin:    set(admin),
+	}
+}()
+
+func HasPermission(role, perm string) bool {
+	return rolePermissions[role][perm]
+}
+
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// роль берётся из БД на каждый запрос, чтобы снятие роли действовало сразу
+func (s *BankService) Authorize(userID uuid.UUID, perm string) (string, error) {
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return "", ErrForbidden
+	}
+	if !HasPermission(u.Role, perm) {
+		return u.Role, ErrForbidden
+	}
+	return u.Role, nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bankapp/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRecipientNotFound  = errors.New("получатель не найден")
+	ErrRecipientAmbiguous = errors.New("укажите получателя одним способом: to_account_id, to_account_number, to_username или to_phone")
+	ErrInvalidAccountNum  = errors.New("номер счёта — 16 цифр с верной контрольной цифрой")
+)
+
+// проверка контрольной цифры Луна, как в generateAccountNumber
+func luhnValid(num string) bool {
+	sum := 0
+	for i := 0; i < len(num); i++ {
+		c := num[len(num)-1-i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return len(num) > 1 && sum%10 == 0
+}
+
+// находит счёт получателя и записывает его в req.ToAccountID.
+// По имени и телефону деньги идут на счёт по умолчанию, а если он не
+// выбран — на первый открытый расчётный счёт в валюте отправителя
+func (s *BankService) resolveRecipient(req *models.TransferRequest, currency string) (*models.Account, *models.User, error) {
+	given := 0
+	for _, set := range []bool{req.ToAccountID != uuid.Nil, req.ToAccountNumber != "", req.ToUsername != "", req.ToPhone != ""} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, nil, ErrRecipientAmbiguous
+	}
+
+	var u *models.User
+	var err error
+	switch {
+	case req.ToAccountID != uuid.Nil:
+		acc, err := s.accountRepo.GetByID(req.ToAccountID)
+		return s.recipientAccount(acc, err)
+	case req.ToAccountNumber != "":
+		num := strings.ReplaceAll(req.ToAccountNumber, " ", "")
+		if len(num) != 16 || !luhnValid(num) {
+			return nil, nil, ErrInvalidAccountNum
+		}
+		acc, err := s.accountRepo.GetByNumber(num)
+		return s.recipientAccount(acc, err)
+	case req.ToUsername != "":
+		u, err = s.userRepo.GetByUsername(req.ToUsername)
+	default:
+		phone, perr := normalizePhone(req.ToPhone)
+		if perr != nil {
+			return nil, nil, perr
+		}
+		u, err = s.userRepo.GetByPhone(phone)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrRecipientNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var acc *models.Account
+	if u.DefaultAccountID != nil {
+		acc, err = s.accountRepo.GetByID(*u.DefaultAccountID)
+	} else {
+		acc, err = s.accountRepo.FirstActive(u.ID, currency)
+	}
+	acc, _, err = s.recipientAccount(acc, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.ToAccountID = acc.ID
+	return acc, u, nil
+}
+
+func (s *BankService) recipientAccount(acc *models.Account, err error) (*models.Account, *models.User, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrRecipientNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// системные счета банка получателями не бывают
+	if acc.UserID == models.SystemUserID {
+		return nil, nil, ErrRecipientNotFound
+	}
+	return acc, nil, nil
+}
+
+// получатель и сумма зачисления до подтверждения перевода; имя маскируется.
+// Сумма обязательна, а просмотры считаются по пользователю
+// (TRANSFER_PREVIEW_PER_HOUR): иначе ручка — бесплатный перебор номеров
+// счетов, имён и телефонов с выдачей имён владельцев
+func (s *BankService) PreviewTransfer(userID uuid.UUID, req models.TransferRequest) (*models.TransferPreview, error) {
+	if !req.Amount.IsPositive() {
+		return nil, errors.New("сумма должна быть >0")
+	}
+	if err := s.rateLimit(rateTransferPreview, userID.String(), s.cfg.TransferPreviewPerHour, time.Hour); err != nil {
+		return nil, err
+	}
+	from, err := s.authorizeAccountID(userID, req.FromAccountID, models.AccessOperate)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAmount(req.Amount, from.Currency); err != nil {
+		return nil, err
+	}
+	to, u, err := s.resolveRecipient(&req, from.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := accountUsable(to); err != nil {
+		return nil, err
+	}
+	if u == nil {
+		if u, err = s.userRepo.GetByID(to.UserID); err != nil {
+			return nil, err
+		}
+	}
+	p := &models.TransferPreview{
+		RecipientName: maskName(u.Username),
+		AccountNumber: maskAccountNumber(to.Number),
+		Currency:      to.Currency,
+		Amount:        req.Amount,
+		FromCurrency:  from.Currency,
+	}
+	toAmount := req.Amount
+	if from.Currency != to.Currency {
+		// курс на момент просмотра; при переводе он может измениться
+		rate, converted, err := s.convert(req.Amount, from.Currency, to.Currency, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		toAmount, p.FXRate = converted, &rate
+	}
+	p.ToAmount = &toAmount
+	return p, nil
+}
+
+// «Иван» -> «И***н»: достаточно, чтобы узнать получателя, но не подсмотреть
+func maskName(name string) string {
+	if utf8.RuneCountInString(name) <= 2 {
+		r, _ := utf8.DecodeRuneInString(name)
+		return string(r) + "***"
+	}
+	first, _ := utf8.DecodeRuneInString(name)
+	last, _ := utf8.DecodeLastRuneInString(name)
+	return string(first) + "***" + string(last)
+}
+
+func maskAccountNumber(num string) string {
+	if len(num) <= 4 {
+		return num
+	}
+	return "•••• " + num[len(num)-4:]
+}
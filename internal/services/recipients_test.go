@@ -0,0 +1,48 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/shopspring/decimal"
+)
+
+// без суммы получатель не показывается, просмотры сверх лимита
+// отклоняются до поиска получателя
+func TestPreviewTransferThrottled(t *testing.T) {
+	cfg := testutil.Config()
+	cfg.TransferPreviewPerHour = 2
+	env := testutil.NewEnv(t, cfg)
+	alice, bob := env.User(t), env.User(t)
+	from := env.Account(t, alice, "1000")
+	to := env.Account(t, bob, "0")
+
+	req := models.TransferRequest{FromAccountID: from.ID, ToAccountNumber: to.Number}
+	if _, err := env.Svc.PreviewTransfer(alice.ID, req); err == nil {
+		t.Error("просмотр без суммы прошёл")
+	}
+	req.Amount = decimal.NewFromInt(100)
+	for i := 0; i < 2; i++ {
+		p, err := env.Svc.PreviewTransfer(alice.ID, req)
+		if err != nil {
+			t.Fatalf("просмотр %d: %v", i+1, err)
+		}
+		if p.RecipientName == bob.Username || p.ToAmount == nil || !p.ToAmount.Equal(req.Amount) {
+			t.Errorf("просмотр %d: %+v", i+1, p)
+		}
+	}
+	var rl *services.RateLimitedError
+	if _, err := env.Svc.PreviewTransfer(alice.ID, req); !errors.As(err, &rl) {
+		t.Errorf("третий просмотр: %v, ждали RateLimitedError", err)
+	}
+	// лимит у каждого пользователя свой
+	if _, err := env.Svc.PreviewTransfer(bob.ID, models.TransferRequest{
+		FromAccountID: to.ID, ToAccountNumber: from.Number, Amount: decimal.NewFromInt(1),
+	}); errors.As(err, &rl) {
+		t.Errorf("другой пользователь: %v", err)
+	}
+}
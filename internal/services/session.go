@@ -0,0 +1,134 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// причины отзыва сессии
+const (
+	revokeLogout        = "logout"
+	revokeLogoutAll     = "logout_all"
+	revokeTokenReuse    = "refresh_reuse"
+	revokePasswordReset = "password_reset"
+)
+
+var (
+	ErrInvalidRefresh = errors.New("некорректный refresh-токен")
+	ErrSessionRevoked = errors.New("сессия завершена")
+)
+
+// открывает новую сессию и выдаёт первую пару токенов
+func (s *BankService) startSession(userID uuid.UUID) (*models.TokenPair, error) {
+	var pair *models.TokenPair
+	err := s.sessionRepo.WithTx(func(tx repo.TxContext) error {
+		sess := &models.Session{UserID: userID}
+		if err := s.sessionRepo.CreateTx(tx, sess); err != nil {
+			return err
+		}
+		var err error
+		pair, err = s.issueTokens(tx, userID, sess.ID)
+		return err
+	})
+	return pair, err
+}
+
+// новый access-токен и новый refresh-токен в той же сессии
+func (s *BankService) issueTokens(tx repo.TxContext, userID, sessionID uuid.UUID) (*models.TokenPair, error) {
+	access, err := s.generateJWT(userID.String(), sessionID.String())
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(raw)
+	if err := s.sessionRepo.CreateRefreshTx(tx, &models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hashRefresh(refresh),
+		ExpiresAt: time.Now().Add(time.Duration(s.cfg.RefreshTokenTTLHour) * time.Hour),
+	}); err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    s.cfg.AccessTokenTTLMin * 60,
+	}, nil
+}
+
+// ротация: старый refresh-токен гасится, выдаётся новый.
+// Повторное предъявление уже использованного токена значит, что его украли:
+// отзываем всю сессию целиком.
+func (s *BankService) RefreshTokens(refresh string) (*models.TokenPair, error) {
+	var pair *models.TokenPair
+	reused := false
+	err := s.sessionRepo.WithTx(func(tx repo.TxContext) error {
+		pair, reused = nil, false
+		rt, err := s.sessionRepo.GetRefreshByHashForUpdateTx(tx, hashRefresh(refresh))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidRefresh
+		}
+		if err != nil {
+			return err
+		}
+		sess, err := s.sessionRepo.GetByIDForUpdateTx(tx, rt.SessionID)
+		if err != nil {
+			return err
+		}
+		if sess.RevokedAt != nil {
+			return ErrSessionRevoked
+		}
+		if rt.UsedAt != nil {
+			// отзыв должен закоммититься, поэтому не возвращаем ошибку из транзакции
+			reused = true
+			return s.sessionRepo.RevokeTx(tx, sess.ID, revokeTokenReuse)
+		}
+		if time.Now().After(rt.ExpiresAt) {
+			return ErrInvalidRefresh
+		}
+		if err := s.sessionRepo.MarkRefreshUsedTx(tx, rt.ID); err != nil {
+			return err
+		}
+		pair, err = s.issueTokens(tx, sess.UserID, sess.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		logrus.Warnf("повторное использование refresh-токена, сессия отозвана")
+		return nil, ErrSessionRevoked
+	}
+	return pair, nil
+}
+
+// завершает текущую сессию
+func (s *BankService) Logout(sessionID uuid.UUID) error {
+	return s.sessionRepo.WithTx(func(tx repo.TxContext) error {
+		return s.sessionRepo.RevokeTx(tx, sessionID, revokeLogout)
+	})
+}
+
+// завершает все сессии пользователя на всех устройствах
+func (s *BankService) LogoutAll(userID uuid.UUID) error {
+	return s.sessionRepo.RevokeAllByUser(userID, revokeLogoutAll)
+}
+
+func hashRefresh(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+)
+
+func login(t *testing.T, env *testutil.Env, u *models.User) *models.TokenPair {
+	t.Helper()
+	resp, err := env.Svc.LoginUser(models.LoginRequest{Username: u.Username, Password: testutil.Password}, testutil.Actor(u))
+	if err != nil || resp.TokenPair == nil {
+		t.Fatalf("вход: %v", err)
+	}
+	return resp.TokenPair
+}
+
+// каждый refresh-токен меняется на новую пару один раз; сессия та же
+func TestRefreshRotation(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	first := login(t, env, u)
+
+	second, err := env.Svc.RefreshTokens(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("обновление: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("обновление вернуло те же токены")
+	}
+	c1, err := env.Svc.ParseToken(first.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := env.Svc.ParseToken(second.AccessToken)
+	if err != nil {
+		t.Fatalf("новый access-токен: %v", err)
+	}
+	if c1.SessionID != c2.SessionID {
+		t.Errorf("обновление сменило сессию: %s -> %s", c1.SessionID, c2.SessionID)
+	}
+	if _, err := env.Svc.RefreshTokens(second.RefreshToken); err != nil {
+		t.Errorf("второе обновление: %v", err)
+	}
+	if _, err := env.Svc.RefreshTokens("no-such-token"); !errors.Is(err, services.ErrInvalidRefresh) {
+		t.Errorf("неизвестный токен: %v, ждали ErrInvalidRefresh", err)
+	}
+}
+
+// повторно предъявленный старый refresh-токен отзывает сессию целиком:
+// не действуют ни свежий refresh, ни выданные в ней access-токены
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	first := login(t, env, u)
+	other := login(t, env, u)
+	second, err := env.Svc.RefreshTokens(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.Svc.RefreshTokens(first.RefreshToken); !errors.Is(err, services.ErrSessionRevoked) {
+		t.Fatalf("повтор старого токена: %v, ждали ErrSessionRevoked", err)
+	}
+	if _, err := env.Svc.RefreshTokens(second.RefreshToken); !errors.Is(err, services.ErrSessionRevoked) {
+		t.Errorf("свежий refresh отозванной сессии: %v, ждали ErrSessionRevoked", err)
+	}
+	for name, token := range map[string]string{"первый": first.AccessToken, "после обновления": second.AccessToken} {
+		if _, err := env.Svc.ParseToken(token); !errors.Is(err, services.ErrSessionRevoked) {
+			t.Errorf("access-токен %s: %v, ждали ErrSessionRevoked", name, err)
+		}
+	}
+	// другие сессии пользователя не задеты
+	if _, err := env.Svc.ParseToken(other.AccessToken); err != nil {
+		t.Errorf("другая сессия: %v", err)
+	}
+}
+
+// выход завершает только текущую сессию, выход везде — все
+func TestLogoutRevokesSessions(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	u := env.User(t)
+	a, b, c := login(t, env, u), login(t, env, u), login(t, env, u)
+
+	claims, err := env.Svc.ParseToken(a.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Svc.Logout(claims.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Svc.ParseToken(a.AccessToken); !errors.Is(err, services.ErrSessionRevoked) {
+		t.Errorf("access-токен после выхода: %v, ждали ErrSessionRevoked", err)
+	}
+	if _, err := env.Svc.RefreshTokens(a.RefreshToken); !errors.Is(err, services.ErrSessionRevoked) {
+		t.Errorf("refresh после выхода: %v, ждали ErrSessionRevoked", err)
+	}
+	if _, err := env.Svc.ParseToken(b.AccessToken); err != nil {
+		t.Errorf("другая сессия после выхода: %v", err)
+	}
+
+	if err := env.Svc.LogoutAll(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*models.TokenPair{b, c} {
+		if _, err := env.Svc.ParseToken(p.AccessToken); !errors.Is(err, services.ErrSessionRevoked) {
+			t.Errorf("access-токен после выхода везде: %v, ждали ErrSessionRevoked", err)
+		}
+		if _, err := env.Svc.RefreshTokens(p.RefreshToken); !errors.Is(err, services.ErrSessionRevoked) {
+			t.Errorf("refresh после выхода везде: %v, ждали ErrSessionRevoked", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// отправка SMS; коды подтверждения телефона
+type SMSSender interface {
+	Send(phone, text string) error
+}
+
+// HTTP-шлюз SMS: POST {"phone": "+7...", "text": "..."}, любой 2xx — успех
+type HTTPSMSGateway struct {
+	url  string
+	http *http.Client
+}
+
+func NewHTTPSMSGateway(url string, timeout time.Duration) *HTTPSMSGateway {
+	return &HTTPSMSGateway{url: url, http: &http.Client{Timeout: timeout}}
+}
+
+func (g *HTTPSMSGateway) Send(phone, text string) error {
+	body, err := json.Marshal(map[string]string{"phone": phone, "text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := g.http.Post(g.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("SMS-шлюз ответил %s", resp.Status)
+	}
+	return nil
+}
+
+// без шлюза (локальный запуск) SMS только пишется в лог
+type LogSMSSender struct{}
+
+func (LogSMSSender) Send(phone, text string) error {
+	logrus.Warnf("SMS_GATEWAY_URL не задан, SMS на %s: %s", phone, text)
+	return nil
+}
+
+// подмена отправителя SMS, например в тестах
+func (s *BankService) SetSMSSender(sender SMSSender) {
+	s.sms = sender
+}
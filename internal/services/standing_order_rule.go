@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+)
+
+var ErrStandingOrderRule = errors.New("правило: monthly с day_of_month, weekly с weekday или cron «день месяц день_недели»")
+
+// поручения исполняются раз в сутки, поэтому из crontab берётся только
+// дневная часть: «день_месяца месяц день_недели», например «1 * *» или
+// «*/14 * *». Поддерживаются *, числа, диапазоны, списки и шаг
+type cronDays struct {
+	dom, month, dow  uint64 // биты разрешённых значений
+	domStar, dowStar bool
+}
+
+func parseCronDays(expr string) (*cronDays, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("cron %q: нужно три поля — день месяц день_недели", expr)
+	}
+	var c cronDays
+	var err error
+	if c.dom, err = parseCronField(fields[0], 1, 31); err != nil {
+		return nil, fmt.Errorf("cron %q: день месяца: %w", expr, err)
+	}
+	if c.month, err = parseCronField(fields[1], 1, 12); err != nil {
+		return nil, fmt.Errorf("cron %q: месяц: %w", expr, err)
+	}
+	if c.dow, err = parseCronField(fields[2], 0, 7); err != nil {
+		return nil, fmt.Errorf("cron %q: день недели: %w", expr, err)
+	}
+	// 7 — тоже воскресенье
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[0], "*")
+	c.dowStar = strings.HasPrefix(fields[2], "*")
+	return &c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("шаг %q", part[i+1:])
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("значение %q", bounds[0])
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("значение %q", bounds[1])
+				}
+			} else if step > 1 {
+				// «5/10» — с пятого до конца с шагом 10
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q вне диапазона %d-%d", rng, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// как в cron: если заданы и день месяца, и день недели, подходит любой из них
+func (c *cronDays) match(d time.Time) bool {
+	if c.month&(1<<uint(d.Month())) == 0 {
+		return false
+	}
+	domOK := c.dom&(1<<uint(d.Day())) != 0
+	dowOK := c.dow&(1<<uint(d.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// проверяет правило поручения
+func validateRule(o *models.StandingOrder) error {
+	switch o.Rule {
+	case models.RuleMonthly:
+		if o.DayOfMonth == nil || *o.DayOfMonth < 1 || *o.DayOfMonth > 31 {
+			return fmt.Errorf("%w: day_of_month от 1 до 31", ErrStandingOrderRule)
+		}
+		o.Weekday, o.Cron = nil, ""
+	case models.RuleWeekly:
+		if o.Weekday == nil || *o.Weekday < 0 || *o.Weekday > 6 {
+			return fmt.Errorf("%w: weekday от 0 (вс) до 6 (сб)", ErrStandingOrderRule)
+		}
+		o.DayOfMonth, o.Cron = nil, ""
+	case models.RuleCron:
+		if _, err := parseCronDays(o.Cron); err != nil {
+			return err
+		}
+		o.DayOfMonth, o.Weekday = nil, nil
+	default:
+		return ErrStandingOrderRule
+	}
+	return nil
+}
+
+// горизонт поиска даты по cron: «30 2 *» не наступит никогда
+const cronSearchDays = 5 * 366
+
+// первая дата исполнения не раньше from с учётом срока и числа исполнений;
+// false — исполнять больше нечего
+func nextRun(o *models.StandingOrder, from time.Time) (time.Time, bool) {
+	if o.MaxRuns != nil && o.Runs >= *o.MaxRuns {
+		return time.Time{}, false
+	}
+	if from.Before(o.StartDate) {
+		from = o.StartDate
+	}
+	var d time.Time
+	switch o.Rule {
+	case models.RuleMonthly:
+		d = monthlyDay(from.Year(), from.Month(), *o.DayOfMonth)
+		if d.Before(from) {
+			d = monthlyDay(from.Year(), from.Month()+1, *o.DayOfMonth)
+		}
+	case models.RuleWeekly:
+		d = from.AddDate(0, 0, (*o.Weekday-int(from.Weekday())+7)%7)
+	case models.RuleCron:
+		c, err := parseCronDays(o.Cron)
+		if err != nil {
+			return time.Time{}, false
+		}
+		found := false
+		for i := 0; i < cronSearchDays; i++ {
+			if d = from.AddDate(0, 0, i); c.match(d) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return time.Time{}, false
+		}
+	default:
+		return time.Time{}, false
+	}
+	if o.EndDate != nil && d.After(*o.EndDate) {
+		return time.Time{}, false
+	}
+	return d, true
+}
+
+// день месяца; если в месяце столько дней нет — последний день
+func monthlyDay(y int, m time.Month, day int) time.Time {
+	first := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrStandingOrderNotFound = errors.New("поручение не найдено")
+	ErrStandingOrderInactive = errors.New("поручение завершено или отменено")
+	ErrStandingOrderNoRuns   = errors.New("по этому правилу не будет ни одного перевода")
+)
+
+// сколько исполнений одного поручения догоняется за прогон,
+// если шедулер долго не запускался
+const maxCatchUpRuns = 31
+
+func (s *BankService) CreateStandingOrder(userID uuid.UUID, req models.StandingOrderRequest, key *models.IdempotencyKey) (*models.StandingOrder, error) {
+	if err := s.requireVerifiedEmail(userID); err != nil {
+		return nil, err
+	}
+	o := &models.StandingOrder{UserID: userID, Status: models.StandingOrderActive}
+	if err := s.applyStandingOrder(o, req); err != nil {
+		return nil, err
+	}
+	return idempotent(s, key, func(tx repo.TxContext) (*models.StandingOrder, error) {
+		if err := s.standingOrderRepo.CreateTx(tx, o); err != nil {
+			return nil, err
+		}
+		return o, nil
+	})
+}
+
+func (s *BankService) ListStandingOrders(userID uuid.UUID) ([]models.StandingOrder, error) {
+	return s.standingOrderRepo.GetByUserID(userID)
+}
+
+func (s *BankService) GetStandingOrder(userID, id uuid.UUID) (*models.StandingOrder, error) {
+	o, err := s.standingOrderRepo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrStandingOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// чужие поручения не видны вовсе
+	if o.UserID != userID {
+		return nil, ErrStandingOrderNotFound
+	}
+	return o, nil
+}
+
+// новые условия действуют со следующего исполнения; число исполнений сохраняется
+func (s *BankService) UpdateStandingOrder(userID, id uuid.UUID, req models.StandingOrderRequest) (*models.StandingOrder, error) {
+	o, err := s.GetStandingOrder(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status != models.StandingOrderActive {
+		return nil, ErrStandingOrderInactive
+	}
+	if err := s.applyStandingOrder(o, req); err != nil {
+		return nil, err
+	}
+	o.Attempts, o.LastError = 0, ""
+	if err := s.standingOrderRepo.Update(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (s *BankService) CancelStandingOrder(userID, id uuid.UUID) (*models.StandingOrder, error) {
+	o, err := s.GetStandingOrder(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status != models.StandingOrderActive {
+		return nil, ErrStandingOrderInactive
+	}
+	o.Status, o.NextRunOn = models.StandingOrderCancelled, nil
+	if err := s.standingOrderRepo.Update(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// переносит условия из запроса в поручение и считает ближайшую дату.
+// Доступ и счета проверяются здесь и ещё раз при каждом переводе
+func (s *BankService) applyStandingOrder(o *models.StandingOrder, req models.StandingOrderRequest) error {
+	if req.Amount.LessThanOrEqual(decimal.Zero) {
+		return errors.New("сумма должна быть >0")
+	}
+	if req.FromAccountID == req.ToAccountID {
+		return errors.New("невозможно перевести на тот же счёт")
+	}
+	from, err := s.authorizeAccountID(o.UserID, req.FromAccountID, models.AccessOperate)
+	if err != nil {
+		return err
+	}
+	if err := accountUsable(from); err != nil {
+		return err
+	}
+	if err := checkAmount(req.Amount, from.Currency); err != nil {
+		return err
+	}
+	to, err := s.accountRepo.GetByID(req.ToAccountID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && to.UserID == models.SystemUserID) {
+		return ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := accountUsable(to); err != nil {
+		return err
+	}
+
+	today := moscowDay(time.Now())
+	start := today
+	if req.StartDate != "" {
+		if start, err = time.Parse("2006-01-02", req.StartDate); err != nil {
+			return errors.New("start_date: формат YYYY-MM-DD")
+		}
+	}
+	var end *time.Time
+	if req.EndDate != "" {
+		e, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			return errors.New("end_date: формат YYYY-MM-DD")
+		}
+		if e.Before(start) {
+			return errors.New("end_date раньше start_date")
+		}
+		end = &e
+	}
+	if req.MaxRuns != nil && *req.MaxRuns <= 0 {
+		return errors.New("max_runs должно быть >0")
+	}
+
+	o.FromAccountID, o.ToAccountID = req.FromAccountID, req.ToAccountID
+	o.Amount, o.Note = req.Amount, req.Note
+	o.Rule, o.DayOfMonth, o.Weekday, o.Cron = req.Rule, req.DayOfMonth, req.Weekday, req.Cron
+	o.StartDate, o.EndDate, o.MaxRuns = start, end, req.MaxRuns
+	if err := validateRule(o); err != nil {
+		return err
+	}
+	next, ok := nextRun(o, today)
+	if !ok {
+		return ErrStandingOrderNoRuns
+	}
+	o.NextRunOn = &next
+	return nil
+}
+
+// исполняет поручения, срок которых наступил. Нехватка средств
+// повторяется на следующих прогонах STANDING_ORDER_RETRY_DAYS дней,
+// потом исполнение пропускается и клиент получает письмо
+func (s *BankService) ProcessStandingOrders() error {
+	today := moscowDay(time.Now())
+	due, err := s.standingOrderRepo.ListDue(today)
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		if err := s.runStandingOrder(&due[i], today); err != nil {
+			logrus.Errorf("поручение %s: %v", due[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *BankService) runStandingOrder(o *models.StandingOrder, today time.Time) error {
+	for i := 0; i < maxCatchUpRuns && o.Status == models.StandingOrderActive &&
+		o.NextRunOn != nil && !o.NextRunOn.After(today); i++ {
+		occ := *o.NextRunOn
+		_, err := s.Transfer(models.Actor{
+			UserID:    o.UserID,
+			Role:      models.RoleCustomer,
+			UserAgent: "standing-order",
+		}, models.TransferRequest{
+			FromAccountID: o.FromAccountID,
+			ToAccountID:   o.ToAccountID,
+			Amount:        o.Amount,
+		}, standingOrderKey(o, occ))
+
+		retry := false
+		switch {
+		case err == nil:
+			now := time.Now()
+			o.Runs++
+			o.Attempts, o.LastRunAt, o.LastError = 0, &now, ""
+		case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrNoFXRate):
+			// временная проблема: пробуем на следующих прогонах
+			o.Attempts++
+			o.LastError = err.Error()
+			if o.Attempts <= s.cfg.StandingOrderRetryDays {
+				retry = true
+				break
+			}
+			s.notifyStandingOrderFailed(o, occ, err)
+			o.Attempts = 0
+		case errors.Is(err, ErrAccountClosed), errors.Is(err, ErrAccountNotFound), errors.Is(err, ErrForbidden):
+			// так исполнить уже не получится никогда
+			o.LastError = err.Error()
+			o.Status = models.StandingOrderCancelled
+			s.notifyStandingOrderFailed(o, occ, err)
+		case errors.Is(err, ErrIdempotencyConflict):
+			return err
+		default:
+			o.LastError = err.Error()
+			o.Attempts = 0
+			s.notifyStandingOrderFailed(o, occ, err)
+		}
+
+		if !retry && o.Status == models.StandingOrderActive {
+			next, ok := nextRun(o, occ.AddDate(0, 0, 1))
+			if ok {
+				o.NextRunOn = &next
+			} else {
+				o.NextRunOn, o.Status = nil, models.StandingOrderFinished
+			}
+		} else if o.Status != models.StandingOrderActive {
+			o.NextRunOn = nil
+		}
+		saved, serr := s.standingOrderRepo.SaveRun(o, occ)
+		if serr != nil {
+			return serr
+		}
+		// клиент поменял поручение во время прогона — исполним по новым условиям завтра
+		if !saved || retry {
+			return nil
+		}
+	}
+	return nil
+}
+
+// ключ идемпотентности исполнения: повторный прогон того же дня
+// получает сохранённый результат, а не второй перевод
+func standingOrderKey(o *models.StandingOrder, occ time.Time) *models.IdempotencyKey {
+	h := sha256.New()
+	fmt.Fprintf(h, "standing-order\n%s\n%s\n%s\n%s", o.FromAccountID, o.ToAccountID, o.Amount, occ.Format("2006-01-02"))
+	return &models.IdempotencyKey{
+		UserID:      o.UserID,
+		Key:         fmt.Sprintf("standing-order:%s:%s", o.ID, occ.Format("2006-01-02")),
+		Fingerprint: hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+func (s *BankService) notifyStandingOrderFailed(o *models.StandingOrder, occ time.Time, cause error) {
+	u, err := s.userRepo.GetByID(o.UserID)
+	if err != nil {
+		return
+	}
+	what := "Перевод по этому поручению пропущен, следующий будет выполнен по расписанию."
+	if o.Status == models.StandingOrderCancelled {
+		what = "Поручение отменено: исполнить его больше невозможно."
+	}
+	if err := sendEmailNotification(
+		s.cfg,
+		u.Email,
+		"Постоянное поручение не исполнено",
+		fmt.Sprintf("Здравствуйте, %s!\n\nНе удалось перевести %s по постоянному поручению %q за %s: %v.\n%s",
+			u.Username, o.Amount, o.Note, occ.Format("02.01.2006"), cause, what),
+	); err != nil {
+		logrus.Warnf("письмо о поручении %s: %v", o.ID, err)
+	}
+}
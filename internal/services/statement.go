@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bankapp/internal/models"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// форматы выписки
+const (
+	StatementCSV = "csv"
+	StatementPDF = "pdf"
+	Statement1C  = "1c"
+)
+
+var ErrUnknownStatementFormat = errors.New("формат выписки: csv, pdf или 1c")
+
+// выписка за [from, to) с входящим и исходящим остатком
+func (s *BankService) GetStatement(userID, accountID uuid.UUID, from, to time.Time) (*models.Statement, error) {
+	acc, err := s.authorizeAccountID(userID, accountID, models.AccessView)
+	if err != nil {
+		return nil, err
+	}
+	if !from.Before(to) {
+		return nil, errors.New("начало периода должно быть раньше конца")
+	}
+	owner, err := s.userRepo.GetByID(acc.UserID)
+	if err != nil {
+		return nil, err
+	}
+	st := &models.Statement{
+		Account:  *acc,
+		Owner:    owner.Username,
+		From:     from,
+		To:       to,
+		TotalIn:  decimal.Zero,
+		TotalOut: decimal.Zero,
+	}
+	if st.Opening, err = s.transactionRepo.BalanceAt(acc.ID, from); err != nil {
+		return nil, err
+	}
+	if st.Closing, err = s.transactionRepo.BalanceAt(acc.ID, to); err != nil {
+		return nil, err
+	}
+	st.Entries, err = s.transactionRepo.History(acc.ID, models.TransactionFilter{
+		From:      &from,
+		To:        &to,
+		Ascending: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range st.Entries {
+		if isIncoming(e, acc.ID) {
+			st.TotalIn = st.TotalIn.Add(e.AmountFor(acc.ID))
+		} else {
+			st.TotalOut = st.TotalOut.Add(e.Amount)
+		}
+	}
+	return st, nil
+}
+
+// пишет выписку в нужном формате
+func (s *BankService) RenderStatement(w io.Writer, st *models.Statement, format string) error {
+	switch format {
+	case StatementCSV:
+		return renderStatementCSV(w, st)
+	case StatementPDF:
+		return renderStatementPDF(w, st, s.cfg.StatementFontPath, time.Now())
+	case Statement1C:
+		return renderStatement1C(w, st, time.Now())
+	}
+	return ErrUnknownStatementFormat
+}
+
+func isIncoming(e models.HistoryEntry, accountID uuid.UUID) bool {
+	return e.To != nil && *e.To == accountID
+}
+
+func counterparty(e models.HistoryEntry) string {
+	if e.CounterpartyNumber != nil {
+		return *e.CounterpartyNumber
+	}
+	return ""
+}
+
+var txTypeTitles = map[string]string{
+	models.TxTransfer:           "Перевод",
+	models.TxDeposit:            "Пополнение",
+	models.TxPayment:            "Оплата картой",
+	models.TxCreditPayment:      "Платёж по кредиту",
+	models.TxCreditDisbursement: "Выдача кредита",
+	models.TxInterest:           "Проценты",
+}
+
+// CSV через «;» — так его без настроек открывает русский Excel
+func renderStatementCSV(w io.Writer, st *models.Statement) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	_ = cw.Write([]string{"Дата", "Тип", "Контрагент", "Назначение", "Приход", "Расход", "Остаток"})
+	for _, e := range st.Entries {
+		in, out := "", ""
+		if isIncoming(e, st.Account.ID) {
+			in = e.AmountFor(st.Account.ID).StringFixed(2)
+		} else {
+			out = e.Amount.StringFixed(2)
+		}
+		_ = cw.Write([]string{
+			e.CreatedAt.Format("2006-01-02 15:04:05"),
+			e.Type,
+			counterparty(e),
+			e.Note,
+			in,
+			out,
+			e.BalanceAfter.StringFixed(2),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// PDF собирается локально; для кириллицы нужен TTF-шрифт (STATEMENT_FONT_PATH).
+// Дата создания — now, словари в фиксированном порядке: одинаковые данные
+// дают одинаковый файл
+func renderStatementPDF(w io.Writer, st *models.Statement, fontPath string, now time.Time) error {
+	font, err := os.ReadFile(fontPath)
+	if err != nil {
+		return fmt.Errorf("шрифт для PDF: %w", err)
+	}
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("main", "", font)
+	pdf.SetCatalogSort(true)
+	pdf.SetCreationDate(now)
+	pdf.SetModificationDate(now)
+	pdf.SetCreator("BankApp", true)
+	pdf.SetTitle("Выписка по счёту "+st.Account.Number, true)
+	pdf.AliasNbPages("{nb}")
+
+	cols := []struct {
+		title string
+		width float64
+		align string
+	}{
+		{"Дата", 24, "L"},
+		{"Операция", 50, "L"},
+		{"Контрагент", 36, "L"},
+		{"Приход", 26, "R"},
+		{"Расход", 26, "R"},
+		{"Остаток", 28, "R"},
+	}
+	tableHeader := func() {
+		pdf.SetFont("main", "", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for _, c := range cols {
+			pdf.CellFormat(c.width, 7, c.title, "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("main", "", 12)
+		pdf.CellFormat(0, 8, "Выписка по счёту "+st.Account.Number+" ("+st.Account.Currency+")", "", 1, "L", false, 0, "")
+		pdf.SetFont("main", "", 9)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Владелец: %s   Период: %s — %s",
+			st.Owner, st.From.Format("02.01.2006"), st.To.Add(-time.Nanosecond).Format("02.01.2006")),
+			"", 1, "L", false, 0, "")
+		pdf.Ln(2)
+		if pdf.PageNo() > 1 {
+			tableHeader()
+		}
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("main", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("стр. %d из {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("main", "", 10)
+	pdf.CellFormat(0, 6, "Входящий остаток: "+st.Opening.StringFixed(2), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+	tableHeader()
+	for _, e := range st.Entries {
+		in, out := "", ""
+		if isIncoming(e, st.Account.ID) {
+			in = e.AmountFor(st.Account.ID).StringFixed(2)
+		} else {
+			out = e.Amount.StringFixed(2)
+		}
+		title := txTypeTitles[e.Type]
+		if e.Note != "" {
+			title += ": " + e.Note
+		}
+		row := []string{
+			e.CreatedAt.Format("02.01.2006 15:04"),
+			truncateRunes(title, 32),
+			counterparty(e),
+			in,
+			out,
+			e.BalanceAfter.StringFixed(2),
+		}
+		pdf.SetFont("main", "", 8)
+		for i, c := range cols {
+			pdf.CellFormat(c.width, 6, row[i], "1", 0, c.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(3)
+	pdf.SetFont("main", "", 10)
+	pdf.CellFormat(0, 6, "Поступило: "+st.TotalIn.StringFixed(2), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 6, "Списано: "+st.TotalOut.StringFixed(2), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 6, "Исходящий остаток: "+st.Closing.StringFixed(2), "", 1, "L", false, 0, "")
+	return pdf.Output(w)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// формат обмена 1С:Предприятие «1CClientBankExchange» версии 1.03,
+// кодировка Windows-1251, строки через CRLF
+func renderStatement1C(w io.Writer, st *models.Statement, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	tag := func(k string) { bw.Write(encodeCP1251(k + "\r\n")) }
+	line := func(k, v string) { bw.Write(encodeCP1251(k + "=" + v + "\r\n")) }
+	date := func(t time.Time) string { return t.Format("02.01.2006") }
+	lastDay := st.To.Add(-time.Nanosecond)
+
+	tag("1CClientBankExchange")
+	line("ВерсияФормата", "1.03")
+	line("Кодировка", "Windows")
+	line("Отправитель", "BankApp")
+	line("Получатель", "")
+	line("ДатаСоздания", date(now))
+	line("ВремяСоздания", now.Format("15:04:05"))
+	line("ДатаНачала", date(st.From))
+	line("ДатаКонца", date(lastDay))
+	line("РасчСчет", st.Account.Number)
+
+	tag("СекцияРасчСчет")
+	line("ДатаНачала", date(st.From))
+	line("ДатаКонца", date(lastDay))
+	line("РасчСчет", st.Account.Number)
+	line("НачальныйОстаток", st.Opening.StringFixed(2))
+	line("ВсегоПоступило", st.TotalIn.StringFixed(2))
+	line("ВсегоСписано", st.TotalOut.StringFixed(2))
+	line("КонечныйОстаток", st.Closing.StringFixed(2))
+	tag("КонецРасчСчет")
+
+	for i, e := range st.Entries {
+		payer, payee := st.Account.Number, counterparty(e)
+		payerName, payeeName := st.Owner, ""
+		if isIncoming(e, st.Account.ID) {
+			payer, payee = payee, payer
+			payerName, payeeName = payeeName, payerName
+		}
+		purpose := txTypeTitles[e.Type]
+		if e.Note != "" {
+			purpose = e.Note
+		}
+		line("СекцияДокумент", "Банковский ордер")
+		line("Номер", fmt.Sprintf("%d", i+1))
+		line("Дата", date(e.CreatedAt))
+		line("Сумма", e.AmountFor(st.Account.ID).StringFixed(2))
+		line("ПлательщикСчет", payer)
+		line("Плательщик", payerName)
+		line("ПолучательСчет", payee)
+		line("Получатель", payeeName)
+		if isIncoming(e, st.Account.ID) {
+			line("ДатаПоступило", date(e.CreatedAt))
+		} else {
+			line("ДатаСписано", date(e.CreatedAt))
+		}
+		line("НазначениеПлатежа", strings.ReplaceAll(purpose, "\n", " "))
+		tag("КонецДокумента")
+	}
+	tag("КонецФайла")
+	return bw.Flush()
+}
+
+// минимальный кодировщик в Windows-1251: ASCII, кириллица, Ё/ё и №
+func encodeCP1251(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			out = append(out, byte(r))
+		case r >= 'А' && r <= 'я':
+			out = append(out, byte(r-'А'+0xC0))
+		case r == 'Ё':
+			out = append(out, 0xA8)
+		case r == 'ё':
+			out = append(out, 0xB8)
+		case r == '№':
+			out = append(out, 0xB9)
+		case r == '–':
+			out = append(out, 0x96)
+		case r == '—':
+			out = append(out, 0x97)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
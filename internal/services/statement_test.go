@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bankapp/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// go test ./internal/services -run Statement -update перезаписывает golden-файлы
+var update = flag.Bool("update", false, "перезаписать golden-файлы в testdata")
+
+const statementFont = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+
+// выписка с пополнением, исходящим переводом, входящей конвертацией,
+// выдачей кредита и выплатой процентов; время и идентификаторы фиксированы
+func sampleStatement() *models.Statement {
+	msk := time.FixedZone("MSK", 3*60*60)
+	accID := uuid.MustParse("6f1c1a52-3f9d-4c57-8f43-6a0b2e8b9a10")
+	other := uuid.MustParse("0b7d9e1a-52c4-4c1e-9d2b-7e3f5a6c8d20")
+	otherNum := "4081781000000042"
+	d := decimal.RequireFromString
+	ptr := func(v decimal.Decimal) *decimal.Decimal { return &v }
+	entry := func(tr models.Transaction, cp *string, balance string) models.HistoryEntry {
+		return models.HistoryEntry{Transaction: tr, CounterpartyNumber: cp, BalanceAfter: d(balance)}
+	}
+	return &models.Statement{
+		Account: models.Account{ID: accID, Number: "4081781000000017", Currency: models.CurrencyRUB},
+		Owner:   "ivanov",
+		From:    time.Date(2026, 3, 1, 0, 0, 0, 0, msk),
+		To:      time.Date(2026, 4, 1, 0, 0, 0, 0, msk),
+		Opening: d("1000.00"),
+		Closing: d("57792.80"),
+		TotalIn: d("61792.80"),
+		// расход — в валюте счёта
+		TotalOut: d("5000.00"),
+		Entries: []models.HistoryEntry{
+			entry(models.Transaction{To: &accID, Amount: d("5000"), Currency: models.CurrencyRUB,
+				Type: models.TxDeposit, Note: "пополнение через кассу", CreatedAt: time.Date(2026, 3, 2, 10, 15, 0, 0, msk)}, nil, "6000.00"),
+			entry(models.Transaction{From: &accID, To: &other, Amount: d("5000"), Currency: models.CurrencyRUB,
+				Type: models.TxTransfer, Note: "за квартиру №12", CreatedAt: time.Date(2026, 3, 5, 18, 40, 12, 0, msk)}, &otherNum, "1000.00"),
+			entry(models.Transaction{From: &other, To: &accID, Amount: d("100"), Currency: "USD",
+				ToAmount: ptr(d("6350.50")), ToCurrency: strPtr(models.CurrencyRUB), FXRate: ptr(d("63.505")),
+				Type: models.TxTransfer, Note: "внутренний перевод", CreatedAt: time.Date(2026, 3, 12, 9, 0, 0, 0, msk)}, &otherNum, "7350.50"),
+			entry(models.Transaction{To: &accID, Amount: d("50000"), Currency: models.CurrencyRUB,
+				Type: models.TxCreditDisbursement, Note: "выдача кредита", CreatedAt: time.Date(2026, 3, 20, 12, 0, 0, 0, msk)}, nil, "57350.50"),
+			entry(models.Transaction{To: &accID, Amount: d("442.30"), Currency: models.CurrencyRUB,
+				Type: models.TxInterest, Note: "проценты по счёту 4081781000000017 за период по 31.03.2026", CreatedAt: time.Date(2026, 3, 31, 23, 59, 0, 0, msk)}, nil, "57792.80"),
+		},
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (запустите с -update)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s не совпадает с golden-файлом; проверьте изменения и запустите с -update", name)
+	}
+}
+
+func TestStatementCSVGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderStatementCSV(&buf, sampleStatement()); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "statement.csv", buf.Bytes())
+}
+
+func TestStatement1CGolden(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2026, 4, 1, 9, 30, 0, 0, time.FixedZone("MSK", 3*60*60))
+	if err := renderStatement1C(&buf, sampleStatement(), now); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "statement_1c.txt", buf.Bytes())
+	// файл целиком в Windows-1251: обратное преобразование без потерь
+	if back := decodeCP1251(buf.Bytes()); strings.ContainsRune(string(back), '�') ||
+		!strings.Contains(string(back), "НазначениеПлатежа=за квартиру №12") {
+		t.Errorf("1С: кодировка испорчена")
+	}
+}
+
+// PDF встраивает подмножество шрифта, поэтому golden годится только для
+// того же файла шрифта: его sha256 лежит рядом, с другим шрифтом тест
+// проверяет лишь повторяемость
+func TestStatementPDFGolden(t *testing.T) {
+	font, err := os.ReadFile(statementFont)
+	if err != nil {
+		t.Skipf("нет шрифта %s", statementFont)
+	}
+	sum := sha256.Sum256(font)
+	fontHash := hex.EncodeToString(sum[:])
+	now := time.Date(2026, 4, 1, 9, 30, 0, 0, time.UTC)
+	render := func() []byte {
+		var buf bytes.Buffer
+		if err := renderStatementPDF(&buf, sampleStatement(), statementFont, now); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	got := render()
+	if !bytes.HasPrefix(got, []byte("%PDF-")) {
+		t.Fatalf("не PDF: %q", got[:min(len(got), 16)])
+	}
+	if !bytes.Equal(got, render()) {
+		t.Fatal("PDF отличается от прогона к прогону")
+	}
+	if *update {
+		checkGolden(t, "statement.pdf.font", []byte(fontHash+"\n"))
+		checkGolden(t, "statement.pdf", got)
+		return
+	}
+	recorded, err := os.ReadFile(filepath.Join("testdata", "statement.pdf.font"))
+	if err != nil {
+		t.Fatalf("%v (запустите с -update)", err)
+	}
+	if strings.TrimSpace(string(recorded)) != fontHash {
+		t.Skipf("шрифт отличается от того, с которым записан golden-файл")
+	}
+	checkGolden(t, "statement.pdf", got)
+}
+
+// каждый тип из фильтра истории попадает в выписку со своим названием
+func TestStatementTitlesCoverHistoryTypes(t *testing.T) {
+	for typ := range historyTypes {
+		if txTypeTitles[typ] == "" {
+			t.Errorf("нет названия для типа %q", typ)
+		}
+	}
+}
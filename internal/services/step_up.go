@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"bankapp/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// step-up токен живёт недолго и годится на одно чувствительное действие
+const stepUpTokenTTL = 5 * time.Minute
+
+var (
+	ErrInvalidStepUp = errors.New("подтвердите личность заново: step-up токен недействителен или уже использован")
+	ErrWrongPassword = errors.New("неверный пароль")
+)
+
+// повторная проверка пароля или TOTP перед чувствительным действием.
+// Неудачи идут в счётчик входа, чтобы здесь нельзя было подбирать пароль
+func (s *BankService) StepUp(actor models.Actor, req models.StepUpRequest) (*models.StepUpToken, error) {
+	u, err := s.userRepo.GetByID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLoginAllowed(u.Username, actor.IP); err != nil {
+		return nil, err
+	}
+	method := "password"
+	switch {
+	case req.Code != "":
+		method = "totp"
+		if !u.TOTPEnabled {
+			return nil, ErrTOTPNotEnrolled
+		}
+		err = s.checkTOTP(u, req.Code)
+	case CheckPasswordHash(req.Password, u.PasswordHash):
+		err = nil
+	default:
+		err = ErrWrongPassword
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) || errors.Is(err, ErrWrongPassword) {
+			s.recordLoginFailure(u.Username, actor, "step_up")
+		}
+		return nil, err
+	}
+	s.resetLoginFailures(u.Username)
+
+	token, err := s.signInternalToken(jwt.MapClaims{
+		"sub": u.ID.String(),
+		"typ": "step_up",
+		"jti": uuid.New().String(),
+		"exp": time.Now().Add(stepUpTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.auditBestEffort(actor, auditEntry{
+		Action:       "auth.step_up",
+		ResourceType: "user",
+		ResourceID:   u.ID.String(),
+		Details:      map[string]string{"method": method},
+	})
+	return &models.StepUpToken{Token: token, ExpiresIn: int(stepUpTokenTTL.Seconds())}, nil
+}
+
+// возвращает jti токена; токен должен принадлежать userID
+func (s *BankService) parseStepUpToken(tokenStr string, userID uuid.UUID) (uuid.UUID, error) {
+	claims, ok := s.parseInternalToken(tokenStr, "step_up")
+	if !ok || claims["sub"] != userID.String() {
+		return uuid.Nil, ErrInvalidStepUp
+	}
+	jtiStr, _ := claims["jti"].(string)
+	jti, err := uuid.Parse(jtiStr)
+	if err != nil {
+		return uuid.Nil, ErrInvalidStepUp
+	}
+	return jti, nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// RFC 6238: HMAC-SHA1, шаг 30 секунд, 6 цифр
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpIssuer        = "BankApp"
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+
+	totpKeyPurpose     = "totp-secret"
+	recoveryKeyPurpose = "recovery-codes"
+)
+
+var (
+	ErrInvalidMFACode  = errors.New("неверный код подтверждения")
+	ErrTOTPNotEnrolled = errors.New("двухфакторная аутентификация не подключена")
+	ErrTOTPAlreadyOn   = errors.New("двухфакторная аутентификация уже включена")
+	ErrInvalidMFAToken = errors.New("некорректный или просроченный mfa_token")
+
+	b32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	// 10^totpDigits: код — остаток от деления
+	totpModulus = func() uint32 {
+		m := uint32(1)
+		for i := 0; i < totpDigits; i++ {
+			m *= 10
+		}
+		return m
+	}()
+)
+
+// шаг 1: новый секрет, пока не подтверждён — вход не меняется
+func (s *BankService) EnrollTOTP(userID uuid.UUID) (*models.TOTPEnrollment, error) {
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTPEnabled {
+		return nil, ErrTOTPAlreadyOn
+	}
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	enc, err := EncryptAESGCM(raw, s.totpKey())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetTOTPSecret(userID, enc); err != nil {
+		return nil, err
+	}
+	secret := b32NoPad.EncodeToString(raw)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + totpIssuer + ":" + u.Username,
+		RawQuery: q.Encode(),
+	}
+	return &models.TOTPEnrollment{Secret: secret, URI: uri.String()}, nil
+}
+
+// шаг 2: подтверждение кодом из приложения; возвращает коды восстановления
+// (показываются один раз)
+func (s *BankService) ConfirmTOTP(userID uuid.UUID, code string) ([]string, error) {
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTPEnabled {
+		return nil, ErrTOTPAlreadyOn
+	}
+	if u.TOTPSecret == nil {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if err := s.checkTOTP(u, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.recoveryRepo.WithTx(func(tx repo.TxContext) error {
+		if err := s.userRepo.SetTOTPEnabledTx(tx, userID, true); err != nil {
+			return err
+		}
+		return s.recoveryRepo.ReplaceTx(tx, userID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// отключение требует пароль и второй фактор; неверные пароль и коды идут
+// в счётчик входа, иначе украденный access-токен позволял бы перебирать
+// TOTP здесь без ограничений
+func (s *BankService) DisableTOTP(userID uuid.UUID, req models.TOTPDisableRequest, client models.Actor) error {
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLoginAllowed(u.Username, client.IP); err != nil {
+		return err
+	}
+	if !CheckPasswordHash(req.Password, u.PasswordHash) {
+		s.recordLoginFailure(u.Username, client, "totp_disable")
+		return ErrWrongPassword
+	}
+	if !u.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+	if err := s.checkSecondFactor(u, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordLoginFailure(u.Username, client, "totp_disable")
+		}
+		return err
+	}
+	s.resetLoginFailures(u.Username)
+	return s.recoveryRepo.WithTx(func(tx repo.TxContext) error {
+		if err := s.userRepo.ClearTOTPTx(tx, userID); err != nil {
+			return err
+		}
+		return s.recoveryRepo.DeleteAllTx(tx, userID)
+	})
+}
+
+// второй шаг входа: mfa_token из /login плюс TOTP или код восстановления
+func (s *BankService) LoginMFA(req models.MFALoginRequest, client models.Actor) (*models.TokenPair, error) {
+	userID, err := s.parseMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil || !u.TOTPEnabled {
+		return nil, ErrInvalidMFAToken
+	}
+	// неверные коды идут в тот же счётчик, что и неверные пароли
+	if err := s.checkLoginAllowed(u.Username, client.IP); err != nil {
+		return nil, err
+	}
+	if err := s.checkSecondFactor(u, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordLoginFailure(u.Username, client, "mfa")
+		}
+		return nil, err
+	}
+	s.resetLoginFailures(u.Username)
+	pair, err := s.startSession(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	client.UserID = u.ID
+	s.auditBestEffort(client, auditEntry{
+		Action:       "auth.login",
+		ResourceType: "user",
+		ResourceID:   u.ID.String(),
+		Details:      map[string]bool{"mfa": true, "recovery_code": req.Code == ""},
+	})
+	return pair, nil
+}
+
+func (s *BankService) checkSecondFactor(u *models.User, code, recovery string) error {
+	if code != "" {
+		return s.checkTOTP(u, code)
+	}
+	if recovery != "" {
+		ok, err := s.recoveryRepo.Use(u.ID, s.hashRecoveryCode(recovery))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// проверяет код и не даёт предъявить тот же код повторно
+func (s *BankService) checkTOTP(u *models.User, code string) error {
+	secret, err := DecryptAESGCM(u.TOTPSecret, s.totpKey())
+	if err != nil {
+		return err
+	}
+	step, ok := verifyTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	fresh, err := s.userRepo.AdvanceTOTPStep(u.ID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *BankService) totpKey() []byte {
+	return deriveKey(s.cfg.HMACSecret, totpKeyPurpose)
+}
+
+// короткий токен между первым и вторым шагом входа; подписан внутренним
+// ключом, поэтому как access-токен не принимается ни нами, ни по JWKS
+func (s *BankService) generateMFAToken(userID uuid.UUID) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID.String(),
+		"typ": "mfa",
+		"exp": time.Now().Add(mfaTokenTTL).Unix(),
+	}
+	return s.signInternalToken(claims)
+}
+
+func (s *BankService) parseMFAToken(tokenStr string) (uuid.UUID, error) {
+	claims, ok := s.parseInternalToken(tokenStr, "mfa")
+	if !ok {
+		return uuid.Nil, ErrInvalidMFAToken
+	}
+	sub, _ := claims["sub"].(string)
+	id, err := uuid.Parse(sub)
+	if err != nil {
+		return uuid.Nil, ErrInvalidMFAToken
+	}
+	return id, nil
+}
+
+// коды вида XXXXX-XXXXX; в БД — только HMAC
+func (s *BankService) newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		c := b32NoPad.EncodeToString(raw)[:10]
+		codes = append(codes, c[:5]+"-"+c[5:])
+		hashes = append(hashes, s.hashRecoveryCode(c))
+	}
+	return codes, hashes, nil
+}
+
+func (s *BankService) hashRecoveryCode(code string) string {
+	norm := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return ComputeHMAC(norm, deriveKey(s.cfg.HMACSecret, recoveryKeyPurpose))
+}
+
+func totpAt(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%totpModulus)
+}
+
+// допускаем сдвиг часов на один шаг в обе стороны; возвращает совпавший шаг
+func verifyTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for _, step := range []int64{cur - 1, cur, cur + 1} {
+		if subtle.ConstantTimeCompare([]byte(totpAt(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,51 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+)
+
+// неверные пароль и код при отключении 2FA идут в счётчик входа: после
+// LOGIN_MAX_FAILURES даже верный пароль получает отказ
+func TestDisableTOTPThrottled(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	max := env.Cfg.LoginMaxFailures
+
+	cases := []struct {
+		name   string
+		enable bool
+		req    models.TOTPDisableRequest
+	}{
+		{"неверный пароль", false, models.TOTPDisableRequest{Password: "wrong-password", Code: "000000"}},
+		{"неверный код", true, models.TOTPDisableRequest{Password: testutil.Password, Code: "000000"}},
+	}
+	for _, c := range cases {
+		u := env.User(t)
+		if c.enable {
+			if _, err := env.Svc.EnrollTOTP(u.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.DB.Exec(`UPDATE users SET totp_enabled = TRUE WHERE id=$1`, u.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		client := testutil.Actor(u)
+		client.IP = uniqueIP()
+		for i := 0; i < max; i++ {
+			err := env.Svc.DisableTOTP(u.ID, c.req, client)
+			var te *services.LoginThrottledError
+			if err == nil || errors.As(err, &te) {
+				t.Fatalf("%s: попытка %d: %v", c.name, i+1, err)
+			}
+		}
+		var te *services.LoginThrottledError
+		err := env.Svc.DisableTOTP(u.ID, models.TOTPDisableRequest{Password: testutil.Password, Code: "123456"}, client)
+		if !errors.As(err, &te) || !te.Locked {
+			t.Errorf("%s: после %d неудач: %v, ждали блокировку", c.name, max, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// тестовые векторы RFC 6238 (SHA1), последние totpDigits цифр
+func TestTOTPVectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		code string // 8 цифр из RFC
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+	for _, c := range cases {
+		want := c.code[len(c.code)-totpDigits:]
+		if got := totpAt(secret, c.unix/totpPeriod); got != want {
+			t.Errorf("t=%d: %s, ждали %s", c.unix, got, want)
+		}
+	}
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	cur := now.Unix() / totpPeriod
+	for _, step := range []int64{cur - 1, cur, cur + 1} {
+		if got, ok := verifyTOTP(secret, totpAt(secret, step), now); !ok || got != step {
+			t.Errorf("шаг %d: не принят", step-cur)
+		}
+	}
+	for _, step := range []int64{cur - 2, cur + 2} {
+		if _, ok := verifyTOTP(secret, totpAt(secret, step), now); ok {
+			t.Errorf("шаг %d: принят вне окна", step-cur)
+		}
+	}
+	if _, ok := verifyTOTP(secret, "12345", now); ok {
+		t.Error("принят код короче totpDigits")
+	}
+}
@@ -0,0 +1,117 @@
+package services_test
+
+import (
+	"sync"
+	"testing"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/testutil"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// встречные переводы между одними и теми же счетами и пополнения через
+// общий счёт кассы: все операции должны пройти (конфликты сериализации
+// повторяются), деньги не теряются, остатки совпадают с проводками
+func TestTransferConcurrent(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	alice, bob := env.User(t), env.User(t)
+	accA := env.Account(t, alice, "10000")
+	accB := env.Account(t, bob, "10000")
+
+	const workers, perWorker = 8, 25
+	amount := decimal.NewFromInt(3)
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				from, to, who := accA, accB, alice
+				if (w+i)%2 == 1 {
+					from, to, who = accB, accA, bob
+				}
+				if _, err := env.Svc.Transfer(testutil.Actor(who), models.TransferRequest{
+					FromAccountID: from.ID,
+					ToAccountID:   to.ID,
+					Amount:        amount,
+				}, nil); err != nil {
+					errs <- err
+				}
+				if _, err := env.Svc.Deposit(testutil.Actor(who), models.DepositRequest{
+					ToAccountID: from.ID,
+					Amount:      decimal.NewFromInt(1),
+				}, nil); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("операция не прошла: %v", err)
+	}
+
+	var total decimal.Decimal
+	for _, acc := range []*models.Account{accA, accB} {
+		var bal decimal.Decimal
+		if err := env.DB.Get(&bal, `SELECT balance FROM accounts WHERE id=$1`, acc.ID); err != nil {
+			t.Fatal(err)
+		}
+		posted, err := env.Ledger.PostedBalance(acc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bal.Equal(posted) {
+			t.Errorf("счёт %s: остаток %s, по проводкам %s", acc.ID, bal, posted)
+		}
+		total = total.Add(bal)
+	}
+	want := decimal.NewFromInt(20000 + workers*perWorker)
+	if !total.Equal(want) {
+		t.Errorf("сумма остатков %s, ждали %s", total, want)
+	}
+}
+
+// перевод с рублёвого счёта на долларовый: курс из подменённого
+// источника со спредом записан в транзакции, зачислены доллары
+func TestTransferCrossCurrency(t *testing.T) {
+	env := testutil.NewEnv(t, testutil.Config())
+	env.Svc.SetFXProvider(services.StaticFXProvider{"USD": decimal.NewFromInt(90)})
+	alice, bob := env.User(t), env.User(t)
+	from := env.Account(t, alice, "10000")
+	to, err := env.Svc.CreateAccount(bob.ID, models.CreateAccountRequest{Currency: "USD"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := env.Svc.Transfer(testutil.Actor(alice), models.TransferRequest{
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        decimal.NewFromInt(1000),
+	}, nil)
+	if err != nil {
+		t.Fatalf("перевод: %v", err)
+	}
+	if tr.FXRate == nil || !tr.FXRate.Equal(decimal.RequireFromString("0.011")) {
+		t.Errorf("курс в транзакции %v, ждали 0.011", tr.FXRate)
+	}
+	if tr.ToAmount == nil || !tr.ToAmount.Equal(decimal.NewFromInt(11)) || tr.ToCurrency == nil || *tr.ToCurrency != "USD" {
+		t.Errorf("зачисление %v %v, ждали 11 USD", tr.ToAmount, tr.ToCurrency)
+	}
+	for acc, want := range map[uuid.UUID]string{from.ID: "9000", to.ID: "11"} {
+		var bal decimal.Decimal
+		if err := env.DB.Get(&bal, `SELECT balance FROM accounts WHERE id=$1`, acc); err != nil {
+			t.Fatal(err)
+		}
+		if !bal.Equal(decimal.RequireFromString(want)) {
+			t.Errorf("счёт %s: остаток %s, ждали %s", acc, bal, want)
+		}
+	}
+	if err := env.Svc.CheckLedger(); err != nil {
+		t.Errorf("проводки не сходятся: %v", err)
+	}
+}
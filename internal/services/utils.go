@@ -8,17 +8,8 @@ import (
 
 	"bankapp/internal/config"
 	"github.com/go-mail/mail/v2"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(pw string) (string, error) {
-	b, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
-	return string(b), err
-}
-func CheckPasswordHash(pw, hash string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
-}
-
 // Генерация номера счета
 func generateAccountNumber() string {
 	base := "400000" // условный BIN
@@ -0,0 +1,163 @@
+package testutil
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// письмо, принятое SMTPServer
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// SMTP-сервер на 127.0.0.1, который принимает любые письма и хранит их
+// для проверок. Без TLS и AUTH: go-mail в таком случае шлёт открытым текстом
+type SMTPServer struct {
+	Host string
+	Port int
+
+	ln   net.Listener
+	mu   sync.Mutex
+	mail []Mail
+	got  chan struct{}
+}
+
+func NewSMTPServer(t testing.TB) *SMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("smtp: %v", err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &SMTPServer{Host: "127.0.0.1", Port: addr.Port, ln: ln, got: make(chan struct{}, 1)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// письма, полученные на адрес to
+func (s *SMTPServer) Messages(to string) []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Mail
+	for _, m := range s.mail {
+		for _, rcpt := range m.To {
+			if strings.EqualFold(rcpt, to) {
+				out = append(out, m)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// ждёт n-е письмо на адрес to: отправка у сервиса идёт в фоне
+func (s *SMTPServer) Wait(t testing.TB, to string, n int) Mail {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		if list := s.Messages(to); len(list) >= n {
+			return list[n-1]
+		}
+		select {
+		case <-s.got:
+		case <-deadline:
+			t.Fatalf("smtp: за 5 с не пришло письмо №%d на %s", n, to)
+		}
+	}
+}
+
+func (s *SMTPServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *SMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	var cur Mail
+	_ = tp.PrintfLine("220 bankapp-test ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			_ = tp.PrintfLine("250 bankapp-test")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			cur = Mail{From: smtpAddr(line[len("MAIL FROM:"):])}
+			_ = tp.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			cur.To = append(cur.To, smtpAddr(line[len("RCPT TO:"):]))
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			_ = tp.PrintfLine("354 end with <CRLF>.<CRLF>")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			cur.Subject, cur.Body = parseMail(data)
+			s.mu.Lock()
+			s.mail = append(s.mail, cur)
+			s.mu.Unlock()
+			select {
+			case s.got <- struct{}{}:
+			default:
+			}
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "RSET", cmd == "NOOP":
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func smtpAddr(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(s, "<>")
+}
+
+// тема и текст письма с раскодированными заголовком и quoted-printable
+func parseMail(data []byte) (subject, body string) {
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+	if err != nil {
+		return "", string(data)
+	}
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	r := msg.Body
+	if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		r = quotedprintable.NewReader(r)
+	}
+	b, _ := io.ReadAll(r)
+	// перевод строки перед завершающей точкой DATA — не часть текста
+	return subject, strings.TrimSuffix(string(b), "\n")
+}
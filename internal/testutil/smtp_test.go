@@ -0,0 +1,34 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// письмо через go-mail, как шлёт сервис, доходит с раскодированной
+// кириллицей в теме и тексте
+func TestSMTPServerCapturesMail(t *testing.T) {
+	srv := NewSMTPServer(t)
+	m := mail.NewMessage()
+	m.SetHeader("From", "bank@example.com")
+	m.SetHeader("To", "client@example.com")
+	m.SetHeader("Subject", "Восстановление пароля BankApp")
+	m.SetBody("text/plain", "Здравствуйте!\n\nСсылка: http://localhost:8080/password/reset?token=abc%2Bdef")
+	if err := mail.NewDialer(srv.Host, srv.Port, "", "").DialAndSend(m); err != nil {
+		t.Fatalf("отправка: %v", err)
+	}
+	got := srv.Wait(t, "client@example.com", 1)
+	if got.From != "bank@example.com" {
+		t.Errorf("from = %q", got.From)
+	}
+	if got.Subject != "Восстановление пароля BankApp" {
+		t.Errorf("subject = %q", got.Subject)
+	}
+	if want := "Здравствуйте!\n\nСсылка: http://localhost:8080/password/reset?token=abc%2Bdef"; got.Body != want {
+		t.Errorf("body = %q, ждали %q", got.Body, want)
+	}
+	if n := len(srv.Messages("other@example.com")); n != 0 {
+		t.Errorf("чужому адресу пришло %d писем", n)
+	}
+}
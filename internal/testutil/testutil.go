@@ -0,0 +1,201 @@
+// Package testutil — общее окружение интеграционных тестов: база, сервис,
+// пользователи со счетами. Тесты с базой идут только при заданном
+// BANKAPP_TEST_DSN (Postgres с применёнными migrations), иначе пропускаются.
+package testutil
+
+import (
+	"crypto"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/internal/repo"
+	"bankapp/internal/services"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const DSNEnv = "BANKAPP_TEST_DSN"
+
+// конфиг без внешних зависимостей: HS256, курсы из файла в корне репозитория,
+// письма в никуда (SMTP на закрытом порту)
+func Config() *config.Config {
+	return &config.Config{
+		HMACSecret:             "test-hmac-secret",
+		JWTSecret:              "test-jwt-secret",
+		AccessTokenTTLMin:      15,
+		RefreshTokenTTLHour:    24,
+		SMTPHost:               "127.0.0.1",
+		SMTPPort:               1,
+		LoginMaxFailures:       5,
+		LoginMaxFailuresIP:     20,
+		LoginLockoutMin:        15,
+		LoginFailureWindowMin:  15,
+		LoginBackoffBaseSec:    0,
+		LoginBackoffMaxSec:     0,
+		AppBaseURL:             "http://localhost:8080",
+		PasswordResetTTLMin:    30,
+		EmailVerifyTTLHours:    48,
+		IdempotencyTTLHours:    24,
+		CBRTimeoutSec:          1,
+		FXSource:               "file",
+		FXRatesPath:            "../../fx_rates.json",
+		FXSpreadBps:            100,
+		StandingOrderRetryDays: 3,
+		PhoneCodeTTLMin:        10,
+		CardCVVMaxAttempts:     3,
+		CardRevealPerHour:      5,
+		CardPINMaxAttempts:     3,
+	}
+}
+
+// подключение к тестовой базе; без BANKAPP_TEST_DSN тест пропускается
+func DB(t testing.TB) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s не задан: тест с базой пропущен", DSNEnv)
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("подключение к тестовой базе: %v", err)
+	}
+	db.SetMaxOpenConns(50)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type Env struct {
+	DB     *sqlx.DB
+	Cfg    *config.Config
+	Svc    *services.BankService
+	Ledger *repo.LedgerRepo
+}
+
+// сервис на тестовой базе, собранный так же, как в cmd/api. Без ключей PGP
+// в cfg создаёт временную пару, чтобы выпускались карты
+func NewEnv(t testing.TB, cfg *config.Config) *Env {
+	t.Helper()
+	db := DB(t)
+	if cfg.PGPPublicKeyPath == "" {
+		cfg.PGPPublicKeyPath, cfg.PGPPrivateKeyPath = PGPKeys(t)
+	}
+	keys, err := services.LoadJWTKeySet(cfg)
+	if err != nil {
+		t.Fatalf("jwt keys: %v", err)
+	}
+	ledger := repo.NewLedgerRepo(db)
+	svc := services.NewBankService(
+		repo.NewUserRepo(db), repo.NewAccountRepo(db), repo.NewCardRepo(db), repo.NewTransactionRepo(db),
+		repo.NewCreditRepo(db), repo.NewScheduleRepo(db), ledger, repo.NewIdempotencyRepo(db),
+		repo.NewAccessRepo(db), repo.NewSessionRepo(db), repo.NewRecoveryCodeRepo(db), repo.NewUserTokenRepo(db),
+		repo.NewLoginAttemptRepo(db), repo.NewAuditRepo(db), repo.NewFXRateRepo(db), repo.NewAccountProductRepo(db),
+		repo.NewStandingOrderRepo(db), repo.NewPhoneVerificationRepo(db), repo.NewRateLimitRepo(db), cfg, keys,
+	)
+	return &Env{DB: db, Cfg: cfg, Svc: svc, Ledger: ledger}
+}
+
+// пароль всех тестовых пользователей
+const Password = "secret-password"
+
+// пользователь с подтверждённым email; имя уникально, чтобы тесты
+// не мешали друг другу в общей базе
+func (e *Env) User(t testing.TB) *models.User {
+	t.Helper()
+	name := "t" + uuid.NewString()[:12]
+	u, err := e.Svc.RegisterUser(models.RegisterRequest{
+		Username: name,
+		Email:    name + "@example.com",
+		Password: Password,
+	})
+	if err != nil {
+		t.Fatalf("регистрация: %v", err)
+	}
+	if _, err := e.DB.Exec(`UPDATE users SET email_verified_at = NOW() WHERE id=$1`, u.ID); err != nil {
+		t.Fatalf("подтверждение email: %v", err)
+	}
+	return u
+}
+
+func Actor(u *models.User) models.Actor {
+	return models.Actor{UserID: u.ID, Role: models.RoleCustomer, IP: "127.0.0.1", UserAgent: "test"}
+}
+
+// рублёвый счёт пользователя, пополненный на amount
+func (e *Env) Account(t testing.TB, u *models.User, amount string) *models.Account {
+	t.Helper()
+	acc, err := e.Svc.CreateAccount(u.ID, models.CreateAccountRequest{}, nil)
+	if err != nil {
+		t.Fatalf("открытие счёта: %v", err)
+	}
+	if sum := decimal.RequireFromString(amount); sum.IsPositive() {
+		if _, err := e.Svc.Deposit(Actor(u), models.DepositRequest{ToAccountID: acc.ID, Amount: sum}, nil); err != nil {
+			t.Fatalf("пополнение: %v", err)
+		}
+	}
+	return acc
+}
+
+// access-токен пользователя, как после POST /login
+func (e *Env) Token(t testing.TB, u *models.User) string {
+	t.Helper()
+	resp, err := e.Svc.LoginUser(models.LoginRequest{Username: u.Username, Password: Password}, Actor(u))
+	if err != nil {
+		t.Fatalf("вход: %v", err)
+	}
+	if resp.TokenPair == nil {
+		t.Fatalf("вход %s: нет токена", u.Username)
+	}
+	return resp.AccessToken
+}
+
+// пара ключей PGP без пароля во временном каталоге теста
+func PGPKeys(t testing.TB) (pubPath, privPath string) {
+	t.Helper()
+	ent, err := openpgp.NewEntity("bankapp test", "", "test@example.com", &packet.Config{DefaultHash: crypto.SHA256})
+	if err != nil {
+		t.Fatalf("ключ PGP: %v", err)
+	}
+	// по умолчанию самоподпись предлагает RIPEMD160, которого нет в сборке
+	for _, id := range ent.Identities {
+		id.SelfSignature.PreferredHash = []uint8{8} // SHA256
+		if err := id.SelfSignature.SignUserId(id.UserId.Id, ent.PrimaryKey, ent.PrivateKey, nil); err != nil {
+			t.Fatalf("ключ PGP: %v", err)
+		}
+	}
+	dir := t.TempDir()
+	pubPath, privPath = filepath.Join(dir, "pub.asc"), filepath.Join(dir, "private.asc")
+	writeArmored(t, pubPath, openpgp.PublicKeyType, ent.Serialize)
+	writeArmored(t, privPath, openpgp.PrivateKeyType, func(w io.Writer) error {
+		return ent.SerializePrivate(w, nil)
+	})
+	return pubPath, privPath
+}
+
+func writeArmored(t testing.TB, path, blockType string, serialize func(io.Writer) error) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := armor.Encode(f, blockType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serialize(w); err != nil {
+		t.Fatalf("ключ PGP %s: %v", path, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
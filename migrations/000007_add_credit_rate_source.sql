@@ -0,0 +1,3 @@
+ALTER TABLE credits
+    ADD COLUMN IF NOT EXISTS rate_source VARCHAR(20) NOT NULL DEFAULT 'default',
+    ADD COLUMN IF NOT EXISTS rate_date   DATE;
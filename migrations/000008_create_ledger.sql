@@ -0,0 +1,61 @@
+-- системный пользователь — владелец внутренних счетов банка
+INSERT INTO users (id, username, email, password_hash)
+VALUES ('00000000-0000-0000-0000-000000000000', 'system', 'system@bankapp.local', '!')
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS system_code VARCHAR(30) UNIQUE;
+
+INSERT INTO accounts (id, user_id, number, system_code) VALUES
+    ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000000', '20202810000000000001', 'cash_in'),
+    ('00000000-0000-0000-0000-000000000002', '00000000-0000-0000-0000-000000000000', '30233810000000000001', 'merchant_settlement'),
+    ('00000000-0000-0000-0000-000000000003', '00000000-0000-0000-0000-000000000000', '70601810000000000001', 'loan_interest_income'),
+    ('00000000-0000-0000-0000-000000000004', '00000000-0000-0000-0000-000000000000', '45505810000000000001', 'loan_portfolio')
+ON CONFLICT (id) DO NOTHING;
+
+-- клиентский счёт не уходит в минус, системные — могут
+ALTER TABLE accounts
+    ADD CONSTRAINT accounts_customer_balance_non_negative
+    CHECK (system_code IS NOT NULL OR balance >= 0);
+
+-- пополнение из кассы и начисления банка — операции без счёта списания
+ALTER TABLE transactions ALTER COLUMN from_account_id DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id             UUID PRIMARY KEY,
+    transaction_id UUID REFERENCES transactions(id) ON DELETE RESTRICT,
+    description    TEXT NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id         UUID PRIMARY KEY,
+    entry_id   UUID          NOT NULL REFERENCES journal_entries(id) ON DELETE RESTRICT,
+    account_id UUID          NOT NULL REFERENCES accounts(id) ON DELETE RESTRICT,
+    direction  VARCHAR(6)    NOT NULL CHECK (direction IN ('debit', 'credit')),
+    amount     NUMERIC(18,2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMPTZ   NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_postings_entry   ON postings(entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_account ON postings(account_id);
+
+-- входящие остатки: переносим текущие балансы в проводки против кассы
+WITH opening AS (
+    INSERT INTO journal_entries (id, description)
+    SELECT gen_random_uuid(), 'входящий остаток ' || a.number
+    FROM accounts a
+    WHERE a.system_code IS NULL AND a.balance > 0
+    RETURNING id, description
+), legs AS (
+    SELECT o.id AS entry_id, a.id AS account_id, a.balance
+    FROM opening o
+    JOIN accounts a ON o.description = 'входящий остаток ' || a.number
+)
+INSERT INTO postings (id, entry_id, account_id, direction, amount)
+SELECT gen_random_uuid(), entry_id, account_id, 'credit', balance FROM legs
+UNION ALL
+SELECT gen_random_uuid(), entry_id, '00000000-0000-0000-0000-000000000001', 'debit', balance FROM legs;
+
+UPDATE accounts
+SET balance = -(SELECT COALESCE(SUM(balance), 0) FROM accounts WHERE system_code IS NULL)
+WHERE system_code = 'cash_in';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id     UUID         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key         VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64)     NOT NULL,
+    response    JSONB        NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ  NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_expires ON idempotency_keys(expires_at);
@@ -0,0 +1,11 @@
+-- делегированный доступ к чужому счёту (владелец счёта — accounts.user_id)
+CREATE TABLE IF NOT EXISTS account_access (
+    account_id UUID        NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    level      VARCHAR(10) NOT NULL CHECK (level IN ('view', 'operate')),
+    granted_by UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_access_user ON account_access(user_id);
@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret_enc BYTEA,
+    ADD COLUMN IF NOT EXISTS totp_enabled    BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS totp_last_step  BIGINT  NOT NULL DEFAULT 0;
+
+-- одноразовые коды восстановления, хранятся как HMAC-SHA256
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         UUID PRIMARY KEY,
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  CHAR(64)    NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,17 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- уже зарегистрированные пользователи считаются подтверждёнными
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+-- одноразовые токены из писем; хранится только HMAC токена
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id         UUID PRIMARY KEY,
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose    VARCHAR(20) NOT NULL CHECK (purpose IN ('password_reset', 'email_verify')),
+    token_hash CHAR(64)    NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens(user_id, purpose);
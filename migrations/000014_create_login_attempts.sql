@@ -0,0 +1,9 @@
+-- неудачные попытки входа: по имени пользователя и по IP клиента
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope           VARCHAR(10)  NOT NULL CHECK (scope IN ('user', 'ip')),
+    key             VARCHAR(255) NOT NULL,
+    failures        INT          NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,27 @@
+-- роли пользователей; первого администратора назначают вручную:
+--   UPDATE users SET role = 'admin' WHERE username = '...';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'customer'
+    CONSTRAINT users_role_check CHECK (role IN ('customer', 'support', 'operator', 'admin'));
+
+-- заморозка счетов и блокировка карт из бэк-офиса
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active'
+    CONSTRAINT accounts_status_check CHECK (status IN ('active', 'frozen'));
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active'
+    CONSTRAINT cards_status_check CHECK (status IN ('active', 'blocked'));
+
+-- журнал действий сотрудников
+CREATE TABLE IF NOT EXISTS audit_events (
+    id            BIGSERIAL PRIMARY KEY,
+    actor_id      UUID REFERENCES users(id),
+    actor_role    VARCHAR(20) NOT NULL,
+    action        VARCHAR(50) NOT NULL,
+    resource_type VARCHAR(30) NOT NULL,
+    resource_id   VARCHAR(64) NOT NULL DEFAULT '',
+    ip            VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent    TEXT        NOT NULL DEFAULT '',
+    details       JSONB       NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_resource ON audit_events(resource_type, resource_id);
@@ -0,0 +1,39 @@
+-- журнал аудита: значения до/после и цепочка хешей.
+-- hash = sha256(prev_hash || канонический JSON записи), см. models.AuditEvent.ChainHash;
+-- записи, сделанные до этой миграции, остаются без хеша (вне цепочки)
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS before    JSONB;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS after     JSONB;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS prev_hash CHAR(64);
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS hash      CHAR(64);
+
+-- неудачный вход пишется без сотрудника и без известного пользователя
+ALTER TABLE audit_events ALTER COLUMN actor_role SET DEFAULT '';
+
+-- голова цепочки: одна строка, которую вставка блокирует FOR UPDATE.
+-- Под SERIALIZABLE конкурентная вставка получит 40001 и повторится,
+-- а не прицепится к устаревшему хвосту
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id        BOOLEAN  PRIMARY KEY DEFAULT TRUE CHECK (id),
+    last_id   BIGINT   NOT NULL DEFAULT 0,
+    last_hash CHAR(64) NOT NULL DEFAULT '0000000000000000000000000000000000000000000000000000000000000000'
+);
+INSERT INTO audit_chain_head (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
+
+-- только добавление: UPDATE, DELETE и TRUNCATE запрещены
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events: изменение и удаление записей запрещены';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_modify ON audit_events;
+CREATE TRIGGER audit_events_no_modify
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action, created_at);
@@ -0,0 +1,33 @@
+-- валюта счёта; все поддерживаемые валюты — с двумя знаками после запятой,
+-- поэтому NUMERIC(18,2) остаётся
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB'
+    CONSTRAINT accounts_currency_check CHECK (currency IN ('RUB', 'USD', 'EUR', 'CNY'));
+
+-- amount — в валюте счёта списания; при конвертации зачисленная сумма,
+-- её валюта и применённый курс (единиц to_currency за единицу currency)
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS currency    CHAR(3) NOT NULL DEFAULT 'RUB',
+    ADD COLUMN IF NOT EXISTS to_amount   NUMERIC(18,2),
+    ADD COLUMN IF NOT EXISTS to_currency CHAR(3),
+    ADD COLUMN IF NOT EXISTS fx_rate     NUMERIC(20,10);
+ALTER TABLE transactions ADD CONSTRAINT transactions_fx_check CHECK (
+    (to_amount IS NULL AND to_currency IS NULL AND fx_rate IS NULL)
+    OR (to_amount > 0 AND to_currency IS NOT NULL AND fx_rate > 0)
+);
+
+ALTER TABLE credits ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- внутренние счета в валютах: четвёртая группа id — цифровой код валюты
+-- (см. models.SystemAccount); 47407 — расчёты по конверсионным операциям
+INSERT INTO accounts (id, user_id, number, system_code, currency) VALUES
+    ('00000000-0000-0000-0000-000000000005', '00000000-0000-0000-0000-000000000000', '47407810000000000001', 'fx_position', 'RUB'),
+    ('00000000-0000-0000-0840-000000000001', '00000000-0000-0000-0000-000000000000', '20202840000000000001', 'cash_in_usd', 'USD'),
+    ('00000000-0000-0000-0840-000000000002', '00000000-0000-0000-0000-000000000000', '30233840000000000001', 'merchant_settlement_usd', 'USD'),
+    ('00000000-0000-0000-0840-000000000005', '00000000-0000-0000-0000-000000000000', '47407840000000000001', 'fx_position_usd', 'USD'),
+    ('00000000-0000-0000-0978-000000000001', '00000000-0000-0000-0000-000000000000', '20202978000000000001', 'cash_in_eur', 'EUR'),
+    ('00000000-0000-0000-0978-000000000002', '00000000-0000-0000-0000-000000000000', '30233978000000000001', 'merchant_settlement_eur', 'EUR'),
+    ('00000000-0000-0000-0978-000000000005', '00000000-0000-0000-0000-000000000000', '47407978000000000001', 'fx_position_eur', 'EUR'),
+    ('00000000-0000-0000-0156-000000000001', '00000000-0000-0000-0000-000000000000', '20202156000000000001', 'cash_in_cny', 'CNY'),
+    ('00000000-0000-0000-0156-000000000002', '00000000-0000-0000-0000-000000000000', '30233156000000000001', 'merchant_settlement_cny', 'CNY'),
+    ('00000000-0000-0000-0156-000000000005', '00000000-0000-0000-0000-000000000000', '47407156000000000001', 'fx_position_cny', 'CNY')
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,21 @@
+-- официальные курсы ЦБ РФ (XML_daily): value рублей за nominal единиц валюты,
+-- rate — за одну единицу. Храним все валюты из ленты, не только валюты счетов
+CREATE TABLE IF NOT EXISTS fx_rates (
+    rate_date  DATE           NOT NULL,
+    currency   CHAR(3)        NOT NULL,
+    num_code   CHAR(3)        NOT NULL,
+    name       VARCHAR(100)   NOT NULL,
+    nominal    INT            NOT NULL CHECK (nominal > 0),
+    value      NUMERIC(18,4)  NOT NULL CHECK (value > 0),
+    rate       NUMERIC(20,10) NOT NULL CHECK (rate > 0),
+    fetched_at TIMESTAMPTZ    NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (rate_date, currency)
+);
+
+-- за какие дни курсы уже запрошены и на какую дату установления ответил ЦБ:
+-- в выходные и праздники действует курс последнего рабочего дня
+CREATE TABLE IF NOT EXISTS fx_rate_days (
+    day        DATE        PRIMARY KEY,
+    rate_date  DATE        NOT NULL,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,57 @@
+-- продукты счетов и ставки по валютам; ставку накопительного счёта банк
+-- меняет в любой момент, у срочного вклада она фиксируется при открытии
+CREATE TABLE IF NOT EXISTS account_products (
+    code         VARCHAR(20)  NOT NULL CHECK (code IN ('current', 'savings', 'term_deposit')),
+    currency     CHAR(3)      NOT NULL,
+    annual_rate  NUMERIC(9,6) NOT NULL DEFAULT 0 CHECK (annual_rate >= 0),
+    -- ставка при досрочном расторжении вклада
+    penalty_rate NUMERIC(9,6) NOT NULL DEFAULT 0 CHECK (penalty_rate >= 0),
+    min_term_months INT NOT NULL DEFAULT 0,
+    max_term_months INT NOT NULL DEFAULT 0,
+    updated_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (code, currency)
+);
+
+INSERT INTO account_products (code, currency, annual_rate, penalty_rate, min_term_months, max_term_months) VALUES
+    ('current',      'RUB', 0,     0,     0, 0),
+    ('current',      'USD', 0,     0,     0, 0),
+    ('current',      'EUR', 0,     0,     0, 0),
+    ('current',      'CNY', 0,     0,     0, 0),
+    ('savings',      'RUB', 0.10,  0,     0, 0),
+    ('savings',      'CNY', 0.02,  0,     0, 0),
+    ('term_deposit', 'RUB', 0.14,  0.001, 3, 36),
+    ('term_deposit', 'CNY', 0.035, 0.001, 3, 12)
+ON CONFLICT (code, currency) DO NOTHING;
+
+-- параметры продукта на счёте и состояние начисления процентов:
+-- accrued — начислено, но не выплачено (точно, до 6 знаков);
+-- accrued_posted — часть accrued, уже отражённая в книге целыми копейками
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS product         VARCHAR(20)   NOT NULL DEFAULT 'current',
+    ADD COLUMN IF NOT EXISTS interest_rate   NUMERIC(9,6),
+    ADD COLUMN IF NOT EXISTS penalty_rate    NUMERIC(9,6),
+    ADD COLUMN IF NOT EXISTS capitalize      BOOLEAN       NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS term_months     INT,
+    ADD COLUMN IF NOT EXISTS matures_on      DATE,
+    ADD COLUMN IF NOT EXISTS accrued         NUMERIC(18,6) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS accrued_posted  NUMERIC(18,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS interest_paid   NUMERIC(18,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS accrued_through DATE;
+ALTER TABLE accounts ADD CONSTRAINT accounts_product_check
+    CHECK (product IN ('current', 'savings', 'term_deposit'));
+ALTER TABLE accounts ADD CONSTRAINT accounts_term_deposit_check
+    CHECK (product <> 'term_deposit' OR (term_months > 0 AND matures_on IS NOT NULL AND interest_rate IS NOT NULL));
+
+-- процентные расходы (70606) и обязательства по начисленным процентам (47426)
+INSERT INTO accounts (id, user_id, number, system_code, currency) VALUES
+    ('00000000-0000-0000-0000-000000000006', '00000000-0000-0000-0000-000000000000', '70606810000000000001', 'interest_expense', 'RUB'),
+    ('00000000-0000-0000-0000-000000000007', '00000000-0000-0000-0000-000000000000', '47426810000000000001', 'interest_payable', 'RUB'),
+    ('00000000-0000-0000-0840-000000000006', '00000000-0000-0000-0000-000000000000', '70606840000000000001', 'interest_expense_usd', 'USD'),
+    ('00000000-0000-0000-0840-000000000007', '00000000-0000-0000-0000-000000000000', '47426840000000000001', 'interest_payable_usd', 'USD'),
+    ('00000000-0000-0000-0978-000000000006', '00000000-0000-0000-0000-000000000000', '70606978000000000001', 'interest_expense_eur', 'EUR'),
+    ('00000000-0000-0000-0978-000000000007', '00000000-0000-0000-0000-000000000000', '47426978000000000001', 'interest_payable_eur', 'EUR'),
+    ('00000000-0000-0000-0156-000000000006', '00000000-0000-0000-0000-000000000000', '70606156000000000001', 'interest_expense_cny', 'CNY'),
+    ('00000000-0000-0000-0156-000000000007', '00000000-0000-0000-0000-000000000000', '47426156000000000001', 'interest_payable_cny', 'CNY')
+ON CONFLICT (id) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_accounts_interest ON accounts(product) WHERE product <> 'current';
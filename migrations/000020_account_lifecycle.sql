@@ -0,0 +1,12 @@
+-- закрытие счетов: закрытый счёт остаётся в истории, но деньги по нему не двигаются
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_status_check;
+ALTER TABLE accounts ADD CONSTRAINT accounts_status_check
+    CHECK (status IN ('active', 'frozen', 'closed'));
+
+-- причина заморозки или закрытия
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS closed_at TIMESTAMPTZ;
+
+-- закрывается только пустой счёт
+ALTER TABLE accounts ADD CONSTRAINT accounts_closed_check
+    CHECK (status <> 'closed' OR (balance = 0 AND closed_at IS NOT NULL));
@@ -0,0 +1,38 @@
+-- постоянные поручения: регулярные переводы по правилу
+--   monthly — каждый месяц в day_of_month (31 — последний день месяца),
+--   weekly  — каждую неделю в weekday (0 — воскресенье),
+--   cron    — дневная часть crontab: «день месяц день_недели»
+CREATE TABLE IF NOT EXISTS standing_orders (
+    id              UUID PRIMARY KEY,
+    user_id         UUID          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_account_id UUID          NOT NULL REFERENCES accounts(id),
+    to_account_id   UUID          NOT NULL REFERENCES accounts(id),
+    amount          NUMERIC(18,2) NOT NULL CHECK (amount > 0),
+    note            TEXT          NOT NULL DEFAULT '',
+    rule            VARCHAR(10)   NOT NULL CHECK (rule IN ('monthly', 'weekly', 'cron')),
+    day_of_month    INT CHECK (day_of_month BETWEEN 1 AND 31),
+    weekday         INT CHECK (weekday BETWEEN 0 AND 6),
+    cron            VARCHAR(100)  NOT NULL DEFAULT '',
+    start_date      DATE          NOT NULL,
+    end_date        DATE,
+    max_runs        INT CHECK (max_runs > 0),
+    runs            INT           NOT NULL DEFAULT 0,
+    -- дата ближайшего исполнения; NULL — исполнять больше нечего
+    next_run_on     DATE,
+    -- неудачные попытки текущего исполнения (нехватка средств)
+    attempts        INT           NOT NULL DEFAULT 0,
+    status          VARCHAR(20)   NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'finished', 'cancelled')),
+    last_run_at     TIMESTAMPTZ,
+    last_error      TEXT          NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    CHECK (from_account_id <> to_account_id),
+    CHECK (end_date IS NULL OR end_date >= start_date),
+    CHECK (rule <> 'monthly' OR day_of_month IS NOT NULL),
+    CHECK (rule <> 'weekly' OR weekday IS NOT NULL),
+    CHECK (rule <> 'cron' OR cron <> '')
+);
+
+CREATE INDEX IF NOT EXISTS idx_standing_orders_user ON standing_orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_standing_orders_due ON standing_orders(next_run_on) WHERE status = 'active';
@@ -0,0 +1,20 @@
+-- получатель перевода по номеру телефона: подтверждённый номер и счёт по умолчанию
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone VARCHAR(16);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS default_account_id UUID REFERENCES accounts(id) ON DELETE SET NULL;
+
+-- номер принадлежит только одному пользователю
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone ON users(phone) WHERE phone IS NOT NULL;
+
+-- код из SMS; хранится только HMAC кода, попытки ограничены
+CREATE TABLE IF NOT EXISTS phone_verifications (
+    user_id    UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    phone      VARCHAR(16) NOT NULL,
+    code_hash  CHAR(64)    NOT NULL,
+    attempts   INT         NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- счёт получателя, если счёт по умолчанию не выбран: первый активный в валюте
+CREATE INDEX IF NOT EXISTS idx_accounts_user_currency ON accounts(user_id, currency) WHERE status = 'active';
@@ -0,0 +1,30 @@
+-- жизненный цикл карты:
+--   active        — работает
+--   temp_blocked  — временная блокировка, снимается тем, кто поставил
+--   perm_blocked  — утеряна или украдена, навсегда
+--   expired       — истёк срок, ставит ночной шедулер
+--   closed        — закрыта клиентом, при перевыпуске или закрытии счёта
+ALTER TABLE cards DROP CONSTRAINT IF EXISTS cards_status_check;
+UPDATE cards SET status = 'temp_blocked' WHERE status = 'blocked';
+ALTER TABLE cards ADD CONSTRAINT cards_status_check
+    CHECK (status IN ('active', 'temp_blocked', 'perm_blocked', 'expired', 'closed'));
+
+-- кто поставил временную блокировку: customer или bank
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS blocked_by VARCHAR(10)
+    CONSTRAINT cards_blocked_by_check CHECK (blocked_by IN ('customer', 'bank'));
+UPDATE cards SET blocked_by = 'bank' WHERE status = 'temp_blocked' AND blocked_by IS NULL;
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+
+-- срок действия в открытом виде, чтобы шедулер мог гасить карты без
+-- расшифровки; карта действует до конца месяца, выданного generateExpiryDate
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS expires_on DATE;
+UPDATE cards
+SET expires_on = (date_trunc('month', created_at + INTERVAL '3 years') + INTERVAL '1 month - 1 day')::date
+WHERE expires_on IS NULL;
+ALTER TABLE cards ALTER COLUMN expires_on SET NOT NULL;
+
+-- перевыпуск: новая карта ссылается на старую, старая остаётся с историей
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS reissued_from UUID REFERENCES cards(id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cards_reissued_from ON cards(reissued_from) WHERE reissued_from IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_cards_expiring ON cards(expires_on) WHERE status IN ('active', 'temp_blocked');
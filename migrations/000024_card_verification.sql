@@ -0,0 +1,8 @@
+-- HMAC карты теперь считается только по номеру (PAN), раньше — по номеру
+-- со сроком. Старые значения пересчитываются при первой оплате картой:
+-- секрет HMAC в БД недоступен
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cards_hmac ON cards(hmac);
+
+-- неудачные проверки реквизитов подряд; после CARD_CVV_MAX_ATTEMPTS
+-- карта блокируется банком
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS cvv_failures INT NOT NULL DEFAULT 0;
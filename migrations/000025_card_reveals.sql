@@ -0,0 +1,13 @@
+-- маскированный номер для списков карт: первые 6 и последние 4 цифры.
+-- У старых карт заполняется при старте сервиса расшифровкой number_enc
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS masked_pan VARCHAR(19);
+
+-- показы полных реквизитов: лимит в час и одноразовость step-up токена
+CREATE TABLE IF NOT EXISTS card_reveals (
+    id          UUID PRIMARY KEY,
+    card_id     UUID        NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    step_up_jti UUID        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_card_reveals_user ON card_reveals(user_id, created_at);
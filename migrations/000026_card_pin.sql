@@ -0,0 +1,6 @@
+-- PIN по схеме со смещением (IBM 3624): хранится только разница между
+-- PIN клиента и «естественным» PIN, вычисленным из ключа и id карты.
+-- Без ключа смещение ничего не говорит о PIN
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS pin_offset VARCHAR(6);
+-- неверные PIN подряд, отдельно от попыток CVV
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS pin_failures INT NOT NULL DEFAULT 0;
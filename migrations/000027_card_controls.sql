@@ -0,0 +1,22 @@
+-- ограничения карты, которые задаёт владелец счёта (родитель, компания).
+-- Лимиты — в валюте счёта, NULL — без лимита; нет строки — нет ограничений
+CREATE TABLE IF NOT EXISTS card_controls (
+    card_id         UUID PRIMARY KEY REFERENCES cards(id) ON DELETE CASCADE,
+    per_tx_limit    NUMERIC(20,2) CHECK (per_tx_limit > 0),
+    daily_limit     NUMERIC(20,2) CHECK (daily_limit > 0),
+    monthly_limit   NUMERIC(20,2) CHECK (monthly_limit > 0),
+    -- непустой allowed_mcc — белый список; blocked_mcc сильнее белого
+    allowed_mcc     TEXT[]      NOT NULL DEFAULT '{}',
+    blocked_mcc     TEXT[]      NOT NULL DEFAULT '{}',
+    online_enabled  BOOLEAN     NOT NULL DEFAULT TRUE,
+    foreign_enabled BOOLEAN     NOT NULL DEFAULT TRUE,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- траты по карте за московский день; месяц — сумма дней
+CREATE TABLE IF NOT EXISTS card_spend (
+    card_id UUID          NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+    day     DATE          NOT NULL,
+    amount  NUMERIC(20,2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (card_id, day)
+);
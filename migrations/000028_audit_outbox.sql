@@ -0,0 +1,30 @@
+-- очередь событий аудита. Транзакции с деньгами пишут событие сюда и не
+-- трогают голову цепочки: иначе все они сериализуются на одной строке
+-- audit_chain_head. Фоновый прогон (BankService.SealAudit) по порядку
+-- переносит события в audit_events, считает хеши и удаляет их из очереди
+CREATE TABLE IF NOT EXISTS audit_outbox (
+    id            BIGSERIAL PRIMARY KEY,
+    actor_id      UUID REFERENCES users(id),
+    actor_role    VARCHAR(20) NOT NULL DEFAULT '',
+    action        VARCHAR(50) NOT NULL,
+    resource_type VARCHAR(30) NOT NULL,
+    resource_id   VARCHAR(64) NOT NULL DEFAULT '',
+    ip            VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent    TEXT        NOT NULL DEFAULT '',
+    details       JSONB       NOT NULL DEFAULT '{}',
+    before        JSONB,
+    after         JSONB,
+    created_at    TIMESTAMPTZ NOT NULL
+);
+
+-- событие в очереди можно только забрать в цепочку, но не изменить
+CREATE OR REPLACE FUNCTION audit_outbox_no_update() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_outbox: изменение записей запрещено';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_outbox_no_update ON audit_outbox;
+CREATE TRIGGER audit_outbox_no_update
+    BEFORE UPDATE ON audit_outbox
+    FOR EACH ROW EXECUTE FUNCTION audit_outbox_no_update();
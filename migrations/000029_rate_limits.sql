@@ -0,0 +1,9 @@
+-- счётчики запросов к публичным ручкам: фиксированное окно на ключ
+-- (email, IP, пользователь). bucket — какая ручка считается
+CREATE TABLE IF NOT EXISTS rate_limits (
+    bucket       VARCHAR(32)  NOT NULL,
+    key          VARCHAR(255) NOT NULL,
+    hits         INT          NOT NULL DEFAULT 0,
+    window_start TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (bucket, key)
+);
@@ -0,0 +1,35 @@
+-- остаток счёта после операции хранится в самой операции (по обе стороны
+-- перевода): история отдаёт его как есть, без пересчёта по всем
+-- операциям счёта от текущего баланса
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS from_balance_after NUMERIC(18,2),
+    ADD COLUMN IF NOT EXISTS to_balance_after   NUMERIC(18,2);
+
+-- прошлые операции: один раз от текущего остатка назад, как раньше
+-- считала история; зачисления после конвертации — в валюте счёта
+WITH sides AS (
+    SELECT tr.id, a.id AS account_id, tr.created_at, a.balance,
+           tr.to_account_id = a.id AS incoming,
+           CASE WHEN tr.to_account_id = a.id THEN COALESCE(tr.to_amount, tr.amount) ELSE -tr.amount END AS signed
+    FROM transactions tr
+    JOIN accounts a ON a.id = tr.from_account_id OR a.id = tr.to_account_id
+), w AS (
+    SELECT id, incoming,
+           balance - COALESCE(SUM(signed) OVER (
+               PARTITION BY account_id
+               ORDER BY created_at DESC, id DESC
+               ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+           ), 0) AS balance_after
+    FROM sides
+), b AS (
+    SELECT id,
+           MAX(balance_after) FILTER (WHERE NOT incoming) AS from_balance_after,
+           MAX(balance_after) FILTER (WHERE incoming)     AS to_balance_after
+    FROM w
+    GROUP BY id
+)
+UPDATE transactions t
+SET from_balance_after = b.from_balance_after,
+    to_balance_after   = b.to_balance_after
+FROM b
+WHERE b.id = t.id AND t.from_balance_after IS NULL AND t.to_balance_after IS NULL;